@@ -0,0 +1,60 @@
+package cobrautil
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// FlagAliasAnnotation is the key of the pflag annotation used to record the
+// name of the flag that an alias refers to.
+const FlagAliasAnnotation = "cobrautil_flag_alias"
+
+// RegisterDeprecatedAlias adds a flag named alias that shares the value of
+// the existing flag named target, so that setting either sets both. Setting
+// the alias also marks the target as changed, so that it takes precedence
+// over environment variables and configuration files like the target would.
+//
+// The alias is hidden and marked deprecated, so using it prints a warning
+// that points to the target flag. This allows flags to be renamed without
+// breaking existing invocations.
+func RegisterDeprecatedAlias(flags *pflag.FlagSet, alias, target string) error {
+	f := flags.Lookup(target)
+	if f == nil {
+		return fmt.Errorf("failed to alias flag %s: flag %s does not exist", alias, target)
+	}
+
+	flags.Var(aliasValue{Value: f.Value, flags: flags, target: target}, alias, f.Usage)
+	aliasFlag := flags.Lookup(alias)
+	aliasFlag.NoOptDefVal = f.NoOptDefVal
+	aliasFlag.DefValue = f.DefValue
+
+	if err := flags.SetAnnotation(alias, FlagAliasAnnotation, []string{target}); err != nil {
+		return fmt.Errorf("failed to alias flag %s: %w", alias, err)
+	}
+	if err := flags.MarkDeprecated(alias, "use --"+target+" instead"); err != nil {
+		return fmt.Errorf("failed to alias flag %s: %w", alias, err)
+	}
+	return nil
+}
+
+// aliasValue is the value of an alias, which sets the value of its target
+// through the FlagSet so that the target is marked as changed.
+type aliasValue struct {
+	pflag.Value
+	flags  *pflag.FlagSet
+	target string
+}
+
+func (v aliasValue) Set(value string) error {
+	return v.flags.Set(v.target, value)
+}
+
+// AliasOf returns the name of the flag that the provided flag is an alias of,
+// or an empty string if it is not an alias.
+func AliasOf(f *pflag.Flag) string {
+	if values := f.Annotations[FlagAliasAnnotation]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+package cobrautil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// byteSizeUnits are the suffixes accepted by byte size flags, ordered so that
+// e.g. "KiB" is not parsed as "B" and the binary units, which are used to
+// print values, are largest first.
+var byteSizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"TiB", 1 << 40},
+	{"GiB", 1 << 30},
+	{"MiB", 1 << 20},
+	{"KiB", 1 << 10},
+	{"KB", 1e3},
+	{"MB", 1e6},
+	{"GB", 1e9},
+	{"TB", 1e12},
+	{"B", 1},
+}
+
+// byteSizeValue is an int64 flag value that is parsed from and printed as a
+// number of bytes with an optional unit.
+type byteSizeValue int64
+
+func (s *byteSizeValue) Set(value string) error {
+	size, err := ParseByteSize(value)
+	if err != nil {
+		return err
+	}
+	*s = byteSizeValue(size)
+	return nil
+}
+
+func (s *byteSizeValue) Type() string { return "bytes" }
+
+func (s *byteSizeValue) String() string {
+	for _, unit := range byteSizeUnits[:4] {
+		if *s != 0 && int64(*s)%unit.size == 0 {
+			return strconv.FormatInt(int64(*s)/unit.size, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(int64(*s), 10)
+}
+
+// ParseByteSize parses a number of bytes with an optional decimal ("KB",
+// "MB", "GB", "TB") or binary ("KiB", "MiB", "GiB", "TiB") unit, such as
+// "512KiB" or "10MB". Units are case-insensitive and numbers without a unit
+// are bytes.
+func ParseByteSize(value string) (int64, error) {
+	trimmed := strings.TrimSpace(value)
+	multiplier := int64(1)
+	for _, unit := range byteSizeUnits {
+		if len(trimmed) >= len(unit.suffix) && strings.EqualFold(trimmed[len(trimmed)-len(unit.suffix):], unit.suffix) {
+			trimmed = strings.TrimSpace(trimmed[:len(trimmed)-len(unit.suffix)])
+			multiplier = unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(trimmed, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid byte size: %q", value)
+	}
+	if n > 0 && multiplier > (1<<63-1)/n {
+		return 0, fmt.Errorf("byte size overflows: %q", value)
+	}
+	return n * multiplier, nil
+}
+
+// RegisterByteSizeFlag adds a flag for a number of bytes, which accepts
+// values with units as parsed by ParseByteSize.
+//
+// Values must be read with MustGetByteSize.
+func RegisterByteSizeFlag(flags *pflag.FlagSet, name string, value int64, usage string) {
+	size := byteSizeValue(value)
+	flags.Var(&size, name, usage)
+}
+
+// MustGetByteSize returns the value of a flag added by RegisterByteSizeFlag
+// with the given name and panics if that flag was never defined.
+func MustGetByteSize(cmd *cobra.Command, name string) int64 {
+	f := cmd.Flags().Lookup(name)
+	if f == nil {
+		panic("failed to find cobra flag: " + name)
+	}
+	size, ok := f.Value.(*byteSizeValue)
+	if !ok {
+		panic("cobra flag is not a byte size: " + name)
+	}
+	return int64(*size)
+}
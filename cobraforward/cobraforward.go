@@ -0,0 +1,269 @@
+// Package cobraforward implements a builder for registering flags that select
+// request headers forwarded between HTTP and gRPC servers and clients.
+//
+// Selected headers received by a server are stored in the request's context
+// by middleware or interceptors and then added to any requests made with that
+// context by the provided RoundTripper or client interceptors, preserving
+// identities such as the tenant or request ID across services.
+package cobraforward
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/jzelinskie/cobrautil/v2"
+)
+
+// Option is function used to configure header forwarding within a Cobra
+// RunFunc.
+type Option func(*Builder)
+
+// New creates a Cobra RunFunc Builder for forwarding headers.
+func New(opts ...Option) *Builder {
+	b := &Builder{
+		flagPrefix:  "forward",
+		preRunLevel: 0,
+		logger:      logr.Discard(),
+	}
+	for _, configure := range opts {
+		configure(b)
+	}
+	return b
+}
+
+// Builder is used to configure header forwarding via Cobra.
+type Builder struct {
+	flagPrefix     string
+	logger         logr.Logger
+	preRunLevel    int
+	defaultHeaders []string
+
+	// headers is the canonical form of the configured header names, which
+	// is set by RunE and read by the middleware and interceptors.
+	headers atomic.Pointer[[]string]
+}
+
+func (b *Builder) prefix(s string) string {
+	return cobrautil.PrefixJoiner(b.flagPrefix)(s)
+}
+
+// RegisterFlags adds flags for configuring header forwarding.
+//
+// The following flags are added:
+// - "$PREFIX-headers"
+func (b *Builder) RegisterFlags(flags *pflag.FlagSet) {
+	flags.StringSlice(b.prefix("headers"), b.defaultHeaders, "names of request headers (or gRPC metadata keys) forwarded from incoming to outgoing requests")
+}
+
+// RegisterNamedFlags adds the flags from RegisterFlags() to the "Forwarding"
+// section of the provided NamedFlagSets.
+func (b *Builder) RegisterNamedFlags(nfs *cobrautil.NamedFlagSets) {
+	b.RegisterFlags(nfs.FlagSet("Forwarding"))
+}
+
+// Config is the configuration of header forwarding resolved from the flags
+// registered by RegisterFlags().
+type Config struct {
+	Headers []string
+}
+
+// ConfigFromFlags resolves the configuration of header forwarding from the
+// flags registered by RegisterFlags() without configuring anything.
+//
+// Header names are returned in their canonical HTTP form.
+func (b *Builder) ConfigFromFlags(cmd *cobra.Command) Config {
+	var headers []string
+	for _, h := range cobrautil.MustGetStringSlice(cmd, b.prefix("headers")) {
+		if h = strings.TrimSpace(h); h != "" {
+			headers = append(headers, http.CanonicalHeaderKey(h))
+		}
+	}
+	return Config{Headers: headers}
+}
+
+// RunE returns a Cobra run func that configures the headers forwarded by the
+// middleware and interceptors created by the builder.
+//
+// The required flags can be added to a command by using RegisterFlags().
+func (b *Builder) RunE() cobrautil.CobraRunFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if cobrautil.IsBuiltinCommand(cmd) {
+			return nil // No-op for builtins
+		}
+
+		cfg := b.ConfigFromFlags(cmd)
+		b.headers.Store(&cfg.Headers)
+
+		b.logger.V(b.preRunLevel).Info("configured header forwarding", "headers", cfg.Headers)
+		return nil
+	}
+}
+
+func (b *Builder) configured() []string {
+	if headers := b.headers.Load(); headers != nil {
+		return *headers
+	}
+	return nil
+}
+
+type headersKey struct{}
+
+// ContextWithHeaders returns a copy of the context carrying the provided
+// headers, which are added to outgoing requests by the RoundTripper and
+// client interceptors.
+func ContextWithHeaders(ctx context.Context, h http.Header) context.Context {
+	return context.WithValue(ctx, headersKey{}, h)
+}
+
+// HeadersFromContext returns the forwarded headers carried by the context.
+func HeadersFromContext(ctx context.Context) http.Header {
+	h, _ := ctx.Value(headersKey{}).(http.Header)
+	return h
+}
+
+// selectHeaders returns the configured headers found using get, or nil if
+// none were found.
+func (b *Builder) selectHeaders(get func(name string) []string) http.Header {
+	var selected http.Header
+	for _, name := range b.configured() {
+		if values := get(name); len(values) > 0 {
+			if selected == nil {
+				selected = make(http.Header)
+			}
+			selected[name] = append([]string(nil), values...)
+		}
+	}
+	return selected
+}
+
+func (b *Builder) fromMetadata(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	if h := b.selectHeaders(md.Get); h != nil {
+		return ContextWithHeaders(ctx, h)
+	}
+	return ctx
+}
+
+func toMetadata(ctx context.Context) context.Context {
+	for name, values := range HeadersFromContext(ctx) {
+		for _, value := range values {
+			ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(name), value)
+		}
+	}
+	return ctx
+}
+
+// Middleware returns HTTP middleware that stores the configured headers of
+// incoming requests in their contexts.
+func (b *Builder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h := b.selectHeaders(r.Header.Values); h != nil {
+			r = r.WithContext(ContextWithHeaders(r.Context(), h))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RoundTripper returns an http.RoundTripper that adds the headers carried by
+// each request's context before delegating to next.
+//
+// If next is nil, http.DefaultTransport is used.
+func (b *Builder) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		h := HeadersFromContext(r.Context())
+		if len(h) == 0 {
+			return next.RoundTrip(r)
+		}
+
+		// RoundTrippers must not modify the provided request.
+		r = r.Clone(r.Context())
+		for name, values := range h {
+			r.Header[name] = append([]string(nil), values...)
+		}
+		return next.RoundTrip(r)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// UnaryServerInterceptor returns a gRPC interceptor that stores the
+// configured metadata of incoming unary calls in their contexts.
+func (b *Builder) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(b.fromMetadata(ctx), req)
+	}
+}
+
+// StreamServerInterceptor returns a gRPC interceptor that stores the
+// configured metadata of incoming streams in their contexts.
+func (b *Builder) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, serverStream{ServerStream: ss, ctx: b.fromMetadata(ss.Context())})
+	}
+}
+
+// serverStream overrides the context of a grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s serverStream) Context() context.Context { return s.ctx }
+
+// UnaryClientInterceptor returns a gRPC interceptor that adds the headers
+// carried by the context of outgoing unary calls to their metadata.
+func (b *Builder) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(toMetadata(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor returns a gRPC interceptor that adds the headers
+// carried by the context of outgoing streams to their metadata.
+func (b *Builder) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(toMetadata(ctx), desc, cc, method, opts...)
+	}
+}
+
+// WithDefaultHeaders sets the default value of the "$PREFIX-headers" flag.
+//
+// Defaults to no headers.
+func WithDefaultHeaders(headers ...string) Option {
+	return func(b *Builder) { b.defaultHeaders = headers }
+}
+
+// WithLogger configures logging of the configured headers.
+func WithLogger(logger logr.Logger) Option {
+	return func(b *Builder) { b.logger = logger }
+}
+
+// WithFlagPrefix defines prefix used with the generated flags.
+//
+// Defaults to "forward".
+func WithFlagPrefix(flagPrefix string) Option {
+	return func(b *Builder) { b.flagPrefix = flagPrefix }
+}
+
+// WithPreRunLevel defines the logging level used for pre-run log messages.
+//
+// Defaults to "debug".
+func WithPreRunLevel(preRunLevel int) Option {
+	return func(b *Builder) { b.preRunLevel = preRunLevel }
+}
@@ -0,0 +1,30 @@
+package cobraforward_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil/v2/cobraforward"
+)
+
+func ExampleBuilder_Middleware() {
+	forward := cobraforward.New()
+
+	cmd := &cobra.Command{Use: "mycmd", RunE: forward.RunE()}
+	forward.RegisterFlags(cmd.Flags())
+	cmd.SetArgs([]string{"--forward-headers", "x-tenant-id"})
+	_ = cmd.Execute()
+
+	handler := forward.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Println(cobraforward.HeadersFromContext(r.Context()))
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Tenant-Id", "acme")
+	r.Header.Set("X-Other", "ignored")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	// Output: map[X-Tenant-Id:[acme]]
+}
@@ -0,0 +1,304 @@
+// Package cobragateway implements a builder for registering flags and
+// producing an http.Handler that translates REST requests into calls to a
+// gRPC server using grpc-gateway.
+//
+// The handler is intended to be mounted on a server configured by cobrahttp,
+// serving gRPC and JSON/REST APIs side-by-side.
+package cobragateway
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-logr/logr"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/jzelinskie/stringz"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/jzelinskie/cobrautil/v2"
+)
+
+// Option is function used to configure a grpc-gateway within a Cobra
+// RunFunc.
+type Option func(b *Builder)
+
+// HandlerRegistrar registers the handlers of a service on a grpc-gateway
+// ServeMux that forward requests to the provided connection.
+//
+// The RegisterXXXHandler functions generated by protoc-gen-grpc-gateway
+// have this signature.
+type HandlerRegistrar func(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error
+
+// New creates a Cobra RunFunc Builder for a grpc-gateway.
+func New(serviceName string, opts ...Option) *Builder {
+	b := &Builder{
+		serviceName:         stringz.DefaultEmpty(serviceName, "gateway"),
+		preRunLevel:         0,
+		logger:              logr.Discard(),
+		defaultUpstreamAddr: "localhost:50051",
+		flagPrefix:          "gateway",
+	}
+	for _, configure := range opts {
+		configure(b)
+	}
+	return b
+}
+
+// Builder is used to configure a grpc-gateway via Cobra.
+type Builder struct {
+	flagPrefix          string
+	serviceName         string
+	defaultUpstreamAddr string
+	logger              logr.Logger
+	preRunLevel         int
+	registrars          []HandlerRegistrar
+	muxOpts             []runtime.ServeMuxOption
+	dialOpts            []grpc.DialOption
+
+	// handler is set by RunE and served by Handler.
+	handler atomic.Pointer[http.Handler]
+}
+
+func (b *Builder) prefix(s string) string {
+	return cobrautil.PrefixJoiner(b.flagPrefix)(s)
+}
+
+// RegisterFlags adds flags for configuring a grpc-gateway.
+//
+// The following flags are added:
+// - "$PREFIX-upstream-addr"
+// - "$PREFIX-upstream-tls-ca-path"
+// - "$PREFIX-path-prefix"
+// - "$PREFIX-emit-unpopulated"
+// - "$PREFIX-use-proto-names"
+// - "$PREFIX-discard-unknown"
+func (b *Builder) RegisterFlags(flags *pflag.FlagSet) {
+	flags.String(b.prefix("upstream-addr"), b.defaultUpstreamAddr, "address of the gRPC server that requests to "+b.serviceName+" are forwarded to")
+	flags.String(b.prefix("upstream-tls-ca-path"), "", "local path to the CA used to verify the gRPC server that requests to "+b.serviceName+" are forwarded to (plaintext if empty)")
+	flags.String(b.prefix("path-prefix"), "/", "path under which "+b.serviceName+" is served")
+	flags.Bool(b.prefix("emit-unpopulated"), false, "include fields with zero values in JSON responses from "+b.serviceName)
+	flags.Bool(b.prefix("use-proto-names"), false, "use the original protobuf field names rather than lowerCamelCase in JSON responses from "+b.serviceName)
+	flags.Bool(b.prefix("discard-unknown"), false, "ignore unknown fields in JSON requests to "+b.serviceName+" instead of rejecting them")
+}
+
+// RegisterNamedFlags adds the flags from RegisterFlags() to the "Gateway"
+// section of the provided NamedFlagSets.
+func (b *Builder) RegisterNamedFlags(nfs *cobrautil.NamedFlagSets) {
+	b.RegisterFlags(nfs.FlagSet("Gateway"))
+}
+
+// Config is the configuration of a grpc-gateway resolved from the flags
+// registered by RegisterFlags().
+type Config struct {
+	UpstreamAddr      string
+	UpstreamTLSCAPath string
+	PathPrefix        string
+
+	EmitUnpopulated bool
+	UseProtoNames   bool
+	DiscardUnknown  bool
+}
+
+// Insecure returns true if the gateway is configured to connect to its
+// upstream in plaintext.
+func (c Config) Insecure() bool {
+	return c.UpstreamTLSCAPath == ""
+}
+
+// ConfigFromFlags resolves the configuration of a grpc-gateway from the flags
+// registered by RegisterFlags() without connecting to anything.
+func (b *Builder) ConfigFromFlags(cmd *cobra.Command) (Config, error) {
+	cfg := Config{
+		UpstreamAddr:      cobrautil.MustGetStringExpanded(cmd, b.prefix("upstream-addr")),
+		UpstreamTLSCAPath: cobrautil.MustGetStringExpanded(cmd, b.prefix("upstream-tls-ca-path")),
+		PathPrefix:        cobrautil.MustGetString(cmd, b.prefix("path-prefix")),
+
+		EmitUnpopulated: cobrautil.MustGetBool(cmd, b.prefix("emit-unpopulated")),
+		UseProtoNames:   cobrautil.MustGetBool(cmd, b.prefix("use-proto-names")),
+		DiscardUnknown:  cobrautil.MustGetBool(cmd, b.prefix("discard-unknown")),
+	}
+
+	if !strings.HasPrefix(cfg.PathPrefix, "/") {
+		return Config{}, fmt.Errorf("failed to configure %s: --%s must begin with \"/\"", b.serviceName, b.prefix("path-prefix"))
+	}
+
+	if cfg.Insecure() && cobrautil.TLSRequired(cmd) {
+		return Config{}, fmt.Errorf(
+			"failed to configure %s: TLS is required but --%s was not provided",
+			b.serviceName,
+			b.prefix("upstream-tls-ca-path"),
+		)
+	}
+
+	return cfg, nil
+}
+
+// HandlerFromFlags connects to the upstream gRPC server and creates an
+// http.Handler serving the registered services as configured by the flags
+// from RegisterFlags().
+//
+// The connection is closed when the context of the command is done.
+func (b *Builder) HandlerFromFlags(cmd *cobra.Command) (http.Handler, error) {
+	cfg, err := b.ConfigFromFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := insecure.NewCredentials()
+	if !cfg.Insecure() {
+		caPEM, err := os.ReadFile(cfg.UpstreamTLSCAPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read upstream CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("failed to parse upstream CA")
+		}
+		creds = credentials.NewTLS(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12})
+	}
+
+	dialOpts := append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, b.dialOpts...)
+	conn, err := grpc.Dial(cfg.UpstreamAddr, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s upstream: %w", b.serviceName, err)
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	marshaler := &runtime.HTTPBodyMarshaler{Marshaler: &runtime.JSONPb{
+		MarshalOptions: protojson.MarshalOptions{
+			EmitUnpopulated: cfg.EmitUnpopulated,
+			UseProtoNames:   cfg.UseProtoNames,
+		},
+		UnmarshalOptions: protojson.UnmarshalOptions{
+			DiscardUnknown: cfg.DiscardUnknown,
+		},
+	}}
+	muxOpts := append([]runtime.ServeMuxOption{runtime.WithMarshalerOption(runtime.MIMEWildcard, marshaler)}, b.muxOpts...)
+	mux := runtime.NewServeMux(muxOpts...)
+
+	for _, register := range b.registrars {
+		if err := register(ctx, mux, conn); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("failed to register %s handlers: %w", b.serviceName, err)
+		}
+	}
+
+	var handler http.Handler = mux
+	if prefix := strings.TrimSuffix(cfg.PathPrefix, "/"); prefix != "" {
+		handler = http.StripPrefix(prefix, mux)
+	}
+	return handler, nil
+}
+
+// RunE returns a Cobra run func that configures the handler returned by
+// Handler().
+//
+// The required flags can be added to a command by using RegisterFlags().
+func (b *Builder) RunE() cobrautil.CobraRunFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if cobrautil.IsBuiltinCommand(cmd) {
+			return nil // No-op for builtins
+		}
+
+		handler, err := b.HandlerFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		b.handler.Store(&handler)
+
+		b.logger.V(b.preRunLevel).Info(
+			"configured grpc-gateway",
+			"service", b.serviceName,
+			"upstream", cobrautil.MustGetStringExpanded(cmd, b.prefix("upstream-addr")),
+			"pathPrefix", cobrautil.MustGetString(cmd, b.prefix("path-prefix")),
+		)
+		return nil
+	}
+}
+
+// Handler returns an http.Handler that serves the handler configured by RunE
+// and responds 503 until it has run.
+//
+// This allows the gateway to be provided to cobrahttp.WithHandler before
+// any flags have been parsed.
+func (b *Builder) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler := b.handler.Load()
+		if handler == nil {
+			http.Error(w, b.serviceName+" is not configured", http.StatusServiceUnavailable)
+			return
+		}
+		(*handler).ServeHTTP(w, r)
+	})
+}
+
+// WithLogger configures logging of the configured grpc-gateway environment.
+func WithLogger(logger logr.Logger) Option {
+	return func(b *Builder) { b.logger = logger }
+}
+
+// WithDefaultUpstreamAddress configures the default value of the address of
+// the gRPC server that requests are forwarded to.
+//
+// Defaults to "localhost:50051"
+func WithDefaultUpstreamAddress(addr string) Option {
+	return func(b *Builder) { b.defaultUpstreamAddr = addr }
+}
+
+// WithFlagPrefix defines prefix used with the generated flags.
+//
+// Defaults to "gateway".
+func WithFlagPrefix(flagPrefix string) Option {
+	return func(b *Builder) { b.flagPrefix = flagPrefix }
+}
+
+// WithPreRunLevel defines the logging level used for pre-run log messages.
+//
+// Defaults to "debug".
+func WithPreRunLevel(preRunLevel int) Option {
+	return func(b *Builder) { b.preRunLevel = preRunLevel }
+}
+
+// WithHandlerRegistrar adds a function registering the handlers of a service,
+// such as one generated by protoc-gen-grpc-gateway. It can be provided more
+// than once to serve multiple services.
+//
+// No services are registered by default.
+func WithHandlerRegistrar(register HandlerRegistrar) Option {
+	return func(b *Builder) { b.registrars = append(b.registrars, register) }
+}
+
+// WithServeMuxOptions adds options used to create the grpc-gateway ServeMux,
+// which are applied after the marshaler configured by the flags.
+//
+// No additional options are used by default.
+func WithServeMuxOptions(opts ...runtime.ServeMuxOption) Option {
+	return func(b *Builder) { b.muxOpts = append(b.muxOpts, opts...) }
+}
+
+// WithDialOptions adds options used to connect to the upstream gRPC server.
+//
+// No additional options are used by default.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(b *Builder) { b.dialOpts = append(b.dialOpts, opts...) }
+}
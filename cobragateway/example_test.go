@@ -0,0 +1,38 @@
+package cobragateway_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+
+	"github.com/jzelinskie/cobrautil/v2/cobragateway"
+	"github.com/jzelinskie/cobrautil/v2/cobrahttp"
+)
+
+func ExampleBuilder_Handler() {
+	gateway := cobragateway.New("api",
+		// Typically a generated function, e.g. pb.RegisterGreeterHandler.
+		cobragateway.WithHandlerRegistrar(func(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error {
+			return mux.HandlePath(http.MethodGet, "/v1/hello", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+				fmt.Fprint(w, "hello")
+			})
+		}),
+	)
+	server := cobrahttp.New("api", cobrahttp.WithHandler(gateway.Handler()))
+
+	cmd := &cobra.Command{Use: "mycmd", RunE: gateway.RunE()}
+	gateway.RegisterFlags(cmd.Flags())
+	server.RegisterFlags(cmd.Flags())
+	cmd.SetArgs([]string{"--gateway-path-prefix", "/api"})
+	_ = cmd.Execute()
+
+	rec := httptest.NewRecorder()
+	server.ServerFromFlags(cmd).Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/hello", nil))
+	fmt.Println(rec.Body.String())
+	// Output: hello
+}
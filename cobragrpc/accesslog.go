@@ -0,0 +1,78 @@
+package cobragrpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// accessLogger logs every connection to a server and every request it
+// handles, including those rejected by other interceptors.
+type accessLogger struct {
+	logger logr.Logger
+}
+
+func (l accessLogger) logRequest(ctx context.Context, method string, start time.Time, err error) {
+	peerAddr := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		peerAddr = p.Addr.String()
+	}
+	l.logger.Info(
+		"handled gRPC request",
+		"method", method,
+		"peer", peerAddr,
+		"code", status.Code(err).String(),
+		"duration", time.Since(start),
+	)
+}
+
+func (l accessLogger) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	l.logRequest(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+func (l accessLogger) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	l.logRequest(ss.Context(), info.FullMethod, start, err)
+	return err
+}
+
+type connInfoKey struct{}
+
+// TagConn implements stats.Handler by keeping the addresses of a connection
+// for HandleConn.
+func (l accessLogger) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	return context.WithValue(ctx, connInfoKey{}, info)
+}
+
+// HandleConn implements stats.Handler by logging when connections are opened
+// and closed.
+func (l accessLogger) HandleConn(ctx context.Context, s stats.ConnStats) {
+	peerAddr := ""
+	if info, ok := ctx.Value(connInfoKey{}).(*stats.ConnTagInfo); ok && info.RemoteAddr != nil {
+		peerAddr = info.RemoteAddr.String()
+	}
+
+	switch s.(type) {
+	case *stats.ConnBegin:
+		l.logger.Info("opened gRPC connection", "peer", peerAddr)
+	case *stats.ConnEnd:
+		l.logger.Info("closed gRPC connection", "peer", peerAddr)
+	}
+}
+
+// TagRPC implements stats.Handler; requests are logged by the interceptors.
+func (l accessLogger) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+// HandleRPC implements stats.Handler; requests are logged by the interceptors.
+func (l accessLogger) HandleRPC(context.Context, stats.RPCStats) {}
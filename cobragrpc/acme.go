@@ -0,0 +1,35 @@
+package cobragrpc
+
+import (
+	"crypto/tls"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newACMEManager creates a manager obtaining and renewing certificates for
+// the provided domains from an ACME directory, such as Let's Encrypt.
+//
+// Certificates are only kept in memory if cacheDir is empty, which risks
+// hitting the rate limits of the directory when restarting frequently.
+func newACMEManager(domains []string, cacheDir, directoryURL string) *autocert.Manager {
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Client:     &acme.Client{DirectoryURL: directoryURL},
+	}
+	if cacheDir != "" {
+		m.Cache = autocert.DirCache(cacheDir)
+	}
+	return m
+}
+
+// configureACME configures base to present certificates obtained by m and to
+// answer its TLS-ALPN-01 challenges.
+//
+// gRPC servers do not speak HTTP/1.1, so this is the only type of challenge
+// that can be completed and requires the server to be reachable on port 443.
+func configureACME(base *tls.Config, m *autocert.Manager) {
+	base.GetCertificate = m.GetCertificate
+	base.NextProtos = append(base.NextProtos, acme.ALPNProto)
+}
@@ -0,0 +1,48 @@
+package cobragrpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// healthServicePrefix is the prefix of the methods of the gRPC health
+// service, which are exempt from authentication so that probes keep working.
+const healthServicePrefix = "/grpc.health.v1.Health/"
+
+// presharedKeyAuth rejects requests that do not present the preshared key as
+// a bearer token in their "authorization" metadata.
+type presharedKeyAuth []byte
+
+func (k presharedKeyAuth) authenticate(ctx context.Context, method string) error {
+	if strings.HasPrefix(method, healthServicePrefix) {
+		return nil
+	}
+
+	for _, value := range metadata.ValueFromIncomingContext(ctx, "authorization") {
+		scheme, token, ok := strings.Cut(value, " ")
+		if ok && strings.EqualFold(scheme, "bearer") && subtle.ConstantTimeCompare([]byte(token), k) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+}
+
+func (k presharedKeyAuth) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := k.authenticate(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (k presharedKeyAuth) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := k.authenticate(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
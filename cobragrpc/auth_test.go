@@ -0,0 +1,64 @@
+package cobragrpc_test
+
+import (
+	"context"
+	"testing"
+
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/jzelinskie/cobrautil/v2/cobragrpc"
+	"github.com/jzelinskie/cobrautil/v2/cobragrpctest"
+)
+
+func TestPresharedKey(t *testing.T) {
+	s := cobragrpctest.NewServer(t, cobragrpc.New("myservice"),
+		"--grpc-channelz-enabled",
+		"--grpc-health-enabled",
+		"--grpc-preshared-key=secret",
+	)
+	client := channelzpb.NewChannelzClient(s.Conn)
+
+	for _, tt := range []struct {
+		name          string
+		authorization []string
+		expected      codes.Code
+	}{
+		{"missing", nil, codes.Unauthenticated},
+		{"wrong token", []string{"Bearer wrong"}, codes.Unauthenticated},
+		{"wrong scheme", []string{"Basic secret"}, codes.Unauthenticated},
+		{"prefix of token", []string{"Bearer secre"}, codes.Unauthenticated},
+		{"valid", []string{"Bearer secret"}, codes.OK},
+		{"case-insensitive scheme", []string{"bearer secret"}, codes.OK},
+		{"any of several", []string{"Bearer wrong", "Bearer secret"}, codes.OK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			for _, value := range tt.authorization {
+				ctx = metadata.AppendToOutgoingContext(ctx, "authorization", value)
+			}
+			_, err := client.GetTopChannels(ctx, &channelzpb.GetTopChannelsRequest{})
+			if status.Code(err) != tt.expected {
+				t.Fatalf("expected %s, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestPresharedKeyExemptsHealth(t *testing.T) {
+	s := cobragrpctest.NewServer(t, cobragrpc.New("myservice"),
+		"--grpc-health-enabled",
+		"--grpc-preshared-key=secret",
+	)
+
+	resp, err := healthpb.NewHealthClient(s.Conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("expected health checks to be exempt from authentication, got %v", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expected the server to be serving, got %s", resp.Status)
+	}
+}
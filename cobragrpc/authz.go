@@ -0,0 +1,168 @@
+package cobragrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jzelinskie/stringz"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// maxAuthzCacheEntries bounds the memory used by cached decisions; the cache
+// is cleared whenever it is exceeded.
+const maxAuthzCacheEntries = 10000
+
+// authzRequest is the body POSTed to the authorization webhook.
+type authzRequest struct {
+	Method   string              `json:"method"`
+	Peer     string              `json:"peer,omitempty"`
+	Metadata map[string][]string `json:"metadata"`
+}
+
+// authzResponse is the body expected from the authorization webhook.
+type authzResponse struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+type authzDecision struct {
+	authzResponse
+	expires time.Time
+}
+
+// webhookAuthz asks an HTTP webhook whether each request is allowed.
+//
+// Decisions are cached by method and "authorization" metadata, so webhooks
+// making decisions on other attributes of requests should be used with
+// caching disabled.
+//
+// Health checks are exempt so that probes keep working.
+type webhookAuthz struct {
+	url      string
+	client   *http.Client
+	cacheTTL time.Duration
+	logger   logr.Logger
+
+	mu    sync.Mutex
+	cache map[string]authzDecision
+}
+
+func newWebhookAuthz(url string, timeout, cacheTTL time.Duration, logger logr.Logger) *webhookAuthz {
+	return &webhookAuthz{
+		url:      url,
+		client:   &http.Client{Timeout: timeout},
+		cacheTTL: cacheTTL,
+		logger:   logger,
+		cache:    make(map[string]authzDecision),
+	}
+}
+
+func (a *webhookAuthz) authorize(ctx context.Context, method string) error {
+	if strings.HasPrefix(method, healthServicePrefix) {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	key := method + "\x00" + strings.Join(md.Get("authorization"), "\x00")
+
+	decision, ok := a.cached(key)
+	if !ok {
+		resp, err := a.check(ctx, method, md)
+		if err != nil {
+			// Fail closed without caching, since the webhook may recover.
+			a.logger.Error(err, "failed to authorize gRPC request", "method", method)
+			return status.Error(codes.Unavailable, "failed to authorize request")
+		}
+		decision = resp
+		a.store(key, decision)
+	}
+
+	if !decision.Allowed {
+		return status.Error(codes.PermissionDenied, stringz.DefaultEmpty(decision.Reason, "request denied"))
+	}
+	return nil
+}
+
+func (a *webhookAuthz) cached(key string) (authzResponse, bool) {
+	if a.cacheTTL <= 0 {
+		return authzResponse{}, false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	decision, ok := a.cache[key]
+	if !ok || time.Now().After(decision.expires) {
+		return authzResponse{}, false
+	}
+	return decision.authzResponse, true
+}
+
+func (a *webhookAuthz) store(key string, resp authzResponse) {
+	if a.cacheTTL <= 0 {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.cache) >= maxAuthzCacheEntries {
+		a.cache = make(map[string]authzDecision)
+	}
+	a.cache[key] = authzDecision{authzResponse: resp, expires: time.Now().Add(a.cacheTTL)}
+}
+
+func (a *webhookAuthz) check(ctx context.Context, method string, md metadata.MD) (authzResponse, error) {
+	body := authzRequest{Method: method, Metadata: md}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		body.Peer = p.Addr.String()
+	}
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return authzResponse{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(encoded))
+	if err != nil {
+		return authzResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return authzResponse{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return authzResponse{}, fmt.Errorf("authorization webhook responded %s", resp.Status)
+	}
+
+	var decision authzResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return authzResponse{}, fmt.Errorf("failed to decode authorization webhook response: %w", err)
+	}
+	return decision, nil
+}
+
+func (a *webhookAuthz) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := a.authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *webhookAuthz) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := a.authorize(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,158 @@
+package cobragrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// certificateHolder stores the certificate presented by a server so that it
+// can be swapped out while the server is running.
+type certificateHolder struct {
+	cert atomic.Pointer[tls.Certificate]
+}
+
+// Store replaces the certificate presented for all new connections.
+func (h *certificateHolder) Store(cert *tls.Certificate) {
+	h.cert.Store(cert)
+}
+
+// GetCertificate implements the tls.Config GetCertificate callback.
+func (h *certificateHolder) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert := h.cert.Load()
+	if cert == nil {
+		return nil, errors.New("no TLS certificate has been loaded")
+	}
+	return cert, nil
+}
+
+// certificateFiles polls the files of a certificate and its key so that the
+// certificate stored in a holder is replaced when they are renewed, e.g. by
+// cert-manager.
+type certificateFiles struct {
+	certPath, keyPath string
+	holder            *certificateHolder
+	logger            logr.Logger
+
+	lastModified [2]time.Time
+}
+
+// Load reads the certificate and key and stores them in the holder.
+func (f *certificateFiles) Load() error {
+	modified, err := f.modTimes()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(f.certPath, f.keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	f.holder.Store(&cert)
+	f.lastModified = modified
+	return nil
+}
+
+func (f *certificateFiles) modTimes() ([2]time.Time, error) {
+	var modified [2]time.Time
+	for i, path := range []string{f.certPath, f.keyPath} {
+		// Stat follows symlinks, so this also detects the atomic swaps of
+		// the directories used to mount Kubernetes Secrets.
+		info, err := os.Stat(path)
+		if err != nil {
+			return modified, fmt.Errorf("failed to stat TLS certificate: %w", err)
+		}
+		modified[i] = info.ModTime()
+	}
+	return modified, nil
+}
+
+// Watch reloads the certificate whenever either file is modified, checking
+// every interval until the provided context is canceled.
+//
+// Failures to reload are logged and the previous certificate continues to be
+// served, since the certificate and key are rarely replaced at exactly the
+// same time.
+func (f *certificateFiles) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		modified, err := f.modTimes()
+		if err != nil {
+			f.logger.Error(err, "failed to check TLS certificate for changes")
+			continue
+		}
+		if modified == f.lastModified {
+			continue
+		}
+
+		if err := f.Load(); err != nil {
+			f.logger.Error(err, "failed to reload TLS certificate; continuing to serve the last certificate")
+			continue
+		}
+		f.logger.V(1).Info("reloaded TLS certificate from files", "cert", f.certPath, "key", f.keyPath)
+	}
+}
+
+// decodeInlinePEM resolves the value of a flag holding PEM-encoded TLS
+// material, which is one of:
+// - the PEM itself
+// - "base64:" followed by the base64-encoded PEM
+// - "env:" followed by the name of an environment variable holding either of
+// the above
+func decodeInlinePEM(value string) ([]byte, error) {
+	if name, ok := strings.CutPrefix(value, "env:"); ok {
+		envValue, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", name)
+		}
+		if strings.HasPrefix(envValue, "env:") {
+			return nil, fmt.Errorf("environment variable %s cannot refer to another environment variable", name)
+		}
+		return decodeInlinePEM(envValue)
+	}
+
+	if encoded, ok := strings.CutPrefix(value, "base64:"); ok {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode base64: %w", err)
+		}
+		return decoded, nil
+	}
+
+	return []byte(value), nil
+}
+
+// loadInlineKeyPair parses a certificate and key from the values of flags
+// decoded by decodeInlinePEM.
+func loadInlineKeyPair(cert, key string) (*tls.Certificate, error) {
+	certPEM, err := decodeInlinePEM(cert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	keyPEM, err := decodeInlinePEM(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS key: %w", err)
+	}
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	return &pair, nil
+}
@@ -0,0 +1,416 @@
+package cobragrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+
+	"github.com/jzelinskie/cobrautil/v2"
+	"github.com/jzelinskie/cobrautil/v2/internal/otelctx"
+)
+
+// ClientOption is function used to configure a gRPC client within a Cobra
+// RunFunc.
+type ClientOption func(b *ClientBuilder)
+
+// NewClient creates a Cobra RunFunc Builder for a gRPC client of the named
+// service.
+func NewClient(serviceName string, opts ...ClientOption) *ClientBuilder {
+	b := &ClientBuilder{
+		serviceName: serviceName,
+		flagPrefix:  serviceName,
+		preRunLevel: 0,
+		logger:      logr.Discard(),
+	}
+	for _, configure := range opts {
+		configure(b)
+	}
+	return b
+}
+
+// ClientBuilder is used to configure a gRPC client via Cobra.
+type ClientBuilder struct {
+	flagPrefix      string
+	serviceName     string
+	defaultEndpoint string
+	logger          logr.Logger
+	preRunLevel     int
+	dialOpts        []grpc.DialOption
+}
+
+func (b *ClientBuilder) prefix(s string) string {
+	return cobrautil.PrefixJoiner(b.flagPrefix)(s)
+}
+
+// RegisterFlags adds flags for configuring a gRPC client.
+//
+// The following flags are added:
+// - "$PREFIX-endpoint"
+// - "$PREFIX-tls-ca-path"
+// - "$PREFIX-insecure"
+// - "$PREFIX-spiffe-socket"
+// - "$PREFIX-spiffe-server-id"
+// - "$PREFIX-token"
+// - "$PREFIX-timeout"
+// - "$PREFIX-wait-for-ready"
+// - "$PREFIX-retry-max-attempts"
+// - "$PREFIX-retry-initial-backoff"
+// - "$PREFIX-retry-max-backoff"
+// - "$PREFIX-retry-codes"
+// - "$PREFIX-compression"
+// - "$PREFIX-keepalive-time"
+// - "$PREFIX-keepalive-timeout"
+// - "$PREFIX-keepalive-permit-without-stream"
+func (b *ClientBuilder) RegisterFlags(flags *pflag.FlagSet) {
+	flags.String(b.prefix("endpoint"), b.defaultEndpoint, "address of the "+b.serviceName+" gRPC server")
+	flags.String(b.prefix("tls-ca-path"), "", "local path to the certificate authorities used to verify "+b.serviceName+" (defaults to the system roots)")
+	flags.Bool(b.prefix("insecure"), false, "connect to "+b.serviceName+" without TLS")
+	flags.String(b.prefix("spiffe-socket"), "", "SPIFFE Workload API socket (e.g. unix:///run/spire/agent.sock) from which the identity presented to "+b.serviceName+" and the bundle used to verify it are fetched")
+	flags.String(b.prefix("spiffe-server-id"), "", "SPIFFE ID (e.g. spiffe://example.org/"+b.serviceName+") that "+b.serviceName+" must present when using --"+b.prefix("spiffe-socket")+" (defaults to any identity trusted by the bundle)")
+	cobrautil.RegisterSecretFlag(flags, b.prefix("token"), "bearer token sent with requests to "+b.serviceName)
+	flags.Duration(b.prefix("timeout"), 0, "how long each request to "+b.serviceName+", including streams, is allowed to take (zero for no timeout)")
+	flags.Bool(b.prefix("wait-for-ready"), false, "wait for a connection to "+b.serviceName+" to become ready instead of failing requests immediately")
+	flags.Int(b.prefix("retry-max-attempts"), 1, "maximum number of attempts of each request to "+b.serviceName+", including the first (1 disables retries, at most 5)")
+	flags.Duration(b.prefix("retry-initial-backoff"), 100*time.Millisecond, "delay before the first retry of a request to "+b.serviceName+", which is randomized and doubles for each retry")
+	flags.Duration(b.prefix("retry-max-backoff"), time.Second, "maximum delay between retries of requests to "+b.serviceName)
+	flags.StringSlice(b.prefix("retry-codes"), []string{"UNAVAILABLE"}, "gRPC status codes of failed requests to "+b.serviceName+" that are retried")
+	flags.String(b.prefix("compression"), "none", "compression of requests to "+b.serviceName+` ("none", "gzip", "zstd")`)
+	flags.Duration(b.prefix("keepalive-time"), 0, "how long a connection to "+b.serviceName+" is idle before it is pinged to check that it is alive (0 disables pings, at least 10s otherwise, and servers reject pings more frequent than their enforcement policy)")
+	flags.Duration(b.prefix("keepalive-timeout"), 20*time.Second, "how long to wait for a response to a ping before closing the connection to "+b.serviceName)
+	flags.Bool(b.prefix("keepalive-permit-without-stream"), false, "ping connections to "+b.serviceName+" even when there are no requests in progress")
+}
+
+// RegisterNamedFlags adds the flags from RegisterFlags() to a section named
+// after the service in the provided NamedFlagSets.
+func (b *ClientBuilder) RegisterNamedFlags(nfs *cobrautil.NamedFlagSets) {
+	b.RegisterFlags(nfs.FlagSet(b.serviceName))
+}
+
+// ClientConfig is the configuration of a gRPC client resolved from the flags
+// registered by RegisterFlags().
+type ClientConfig struct {
+	Endpoint       string
+	TLSCAPath      string
+	Insecure       bool
+	SpiffeSocket   string
+	SpiffeServerID string
+	Token          string
+
+	Timeout             time.Duration
+	WaitForReady        bool
+	RetryMaxAttempts    int
+	RetryInitialBackoff time.Duration
+	RetryMaxBackoff     time.Duration
+	RetryCodes          []string
+
+	Compression string
+
+	KeepaliveTime                time.Duration
+	KeepaliveTimeout             time.Duration
+	KeepalivePermitWithoutStream bool
+}
+
+// ConfigFromFlags resolves the configuration of a gRPC client from the flags
+// registered by RegisterFlags() without connecting to anything.
+func (b *ClientBuilder) ConfigFromFlags(cmd *cobra.Command) (ClientConfig, error) {
+	cfg := ClientConfig{
+		Endpoint:       cobrautil.MustGetStringExpanded(cmd, b.prefix("endpoint")),
+		TLSCAPath:      cobrautil.MustGetStringExpanded(cmd, b.prefix("tls-ca-path")),
+		Insecure:       cobrautil.MustGetBool(cmd, b.prefix("insecure")),
+		SpiffeSocket:   cobrautil.MustGetStringExpanded(cmd, b.prefix("spiffe-socket")),
+		SpiffeServerID: cobrautil.MustGetString(cmd, b.prefix("spiffe-server-id")),
+		Token:          cobrautil.MustGetSecret(cmd, b.prefix("token")),
+
+		Timeout:             cobrautil.MustGetDuration(cmd, b.prefix("timeout")),
+		WaitForReady:        cobrautil.MustGetBool(cmd, b.prefix("wait-for-ready")),
+		RetryMaxAttempts:    cobrautil.MustGetInt(cmd, b.prefix("retry-max-attempts")),
+		RetryInitialBackoff: cobrautil.MustGetDuration(cmd, b.prefix("retry-initial-backoff")),
+		RetryMaxBackoff:     cobrautil.MustGetDuration(cmd, b.prefix("retry-max-backoff")),
+
+		Compression: cobrautil.MustGetString(cmd, b.prefix("compression")),
+
+		KeepaliveTime:                cobrautil.MustGetDuration(cmd, b.prefix("keepalive-time")),
+		KeepaliveTimeout:             cobrautil.MustGetDuration(cmd, b.prefix("keepalive-timeout")),
+		KeepalivePermitWithoutStream: cobrautil.MustGetBool(cmd, b.prefix("keepalive-permit-without-stream")),
+	}
+
+	for _, name := range cobrautil.MustGetStringSlice(cmd, b.prefix("retry-codes")) {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		var code codes.Code
+		if err := code.UnmarshalJSON([]byte(strconv.Quote(name))); err != nil {
+			return ClientConfig{}, fmt.Errorf("failed to connect to %s: unknown status code in --%s: %s", b.serviceName, b.prefix("retry-codes"), name)
+		}
+		cfg.RetryCodes = append(cfg.RetryCodes, name)
+	}
+
+	if _, ok := compressors[cfg.Compression]; !ok {
+		return ClientConfig{}, fmt.Errorf(`failed to connect to %s: --%s must be one of "none", "gzip", "zstd": %s`, b.serviceName, b.prefix("compression"), cfg.Compression)
+	}
+
+	// gRPC silently raises shorter intervals to its minimum.
+	if cfg.KeepaliveTime < 0 || cfg.KeepaliveTime > 0 && cfg.KeepaliveTime < 10*time.Second {
+		return ClientConfig{}, fmt.Errorf("failed to connect to %s: --%s must be 0 or at least 10s: %s", b.serviceName, b.prefix("keepalive-time"), cfg.KeepaliveTime)
+	}
+
+	if cfg.KeepaliveTime > 0 && cfg.KeepaliveTimeout <= 0 {
+		return ClientConfig{}, fmt.Errorf("failed to connect to %s: --%s must be positive when keepalive pings are enabled", b.serviceName, b.prefix("keepalive-timeout"))
+	}
+
+	if cfg.RetryMaxAttempts < 1 {
+		return ClientConfig{}, fmt.Errorf("failed to connect to %s: --%s must be at least 1", b.serviceName, b.prefix("retry-max-attempts"))
+	}
+
+	if cfg.RetryMaxAttempts > 1 && (cfg.RetryInitialBackoff <= 0 || cfg.RetryMaxBackoff <= 0) {
+		return ClientConfig{}, fmt.Errorf(
+			"failed to connect to %s: --%s and --%s must be positive when retries are enabled",
+			b.serviceName,
+			b.prefix("retry-initial-backoff"),
+			b.prefix("retry-max-backoff"),
+		)
+	}
+
+	if cfg.Endpoint == "" {
+		return ClientConfig{}, fmt.Errorf("failed to connect to %s: --%s must be provided", b.serviceName, b.prefix("endpoint"))
+	}
+
+	var exclusive []string
+	for _, set := range []struct {
+		name string
+		ok   bool
+	}{
+		{b.prefix("insecure"), cfg.Insecure},
+		{b.prefix("tls-ca-path"), cfg.TLSCAPath != ""},
+		{b.prefix("spiffe-socket"), cfg.SpiffeSocket != ""},
+	} {
+		if set.ok {
+			exclusive = append(exclusive, "--"+set.name)
+		}
+	}
+	if len(exclusive) > 1 {
+		return ClientConfig{}, fmt.Errorf("failed to connect to %s: %s are mutually exclusive", b.serviceName, strings.Join(exclusive, " and "))
+	}
+
+	if cfg.SpiffeServerID != "" {
+		if cfg.SpiffeSocket == "" {
+			return ClientConfig{}, fmt.Errorf("failed to connect to %s: --%s requires --%s", b.serviceName, b.prefix("spiffe-server-id"), b.prefix("spiffe-socket"))
+		}
+		if !strings.HasPrefix(cfg.SpiffeServerID, spiffeScheme) {
+			return ClientConfig{}, fmt.Errorf("failed to connect to %s: --%s must be a spiffe:// URI: %s", b.serviceName, b.prefix("spiffe-server-id"), cfg.SpiffeServerID)
+		}
+	}
+
+	if cfg.Insecure && cobrautil.TLSRequired(cmd) {
+		return ClientConfig{}, fmt.Errorf("failed to connect to %s: TLS is required but --%s was provided", b.serviceName, b.prefix("insecure"))
+	}
+
+	return cfg, nil
+}
+
+// DialFromFlags creates a *grpc.ClientConn as configured by the flags from
+// RegisterFlags().
+//
+// Like grpc.Dial, this does not wait for the connection to be established.
+// When tracing is configured by cobraotel, requests made with the connection
+// are traced. When an identity is fetched from the SPIFFE Workload API, it is
+// kept up to date until the context of the command is done.
+func (b *ClientBuilder) DialFromFlags(cmd *cobra.Command, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	cfg, err := b.ConfigFromFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	creds := insecure.NewCredentials()
+	switch {
+	case cfg.SpiffeSocket != "":
+		source, err := newSpiffeSource(cfg.SpiffeSocket, &certificateHolder{}, b.logger)
+		if err != nil {
+			return nil, err
+		}
+		if err := source.Start(ctx); err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(source.ClientTLSConfig(cfg.SpiffeServerID))
+
+	case !cfg.Insecure:
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if cfg.TLSCAPath != "" {
+			caPEM, err := os.ReadFile(cfg.TLSCAPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s CA: %w", b.serviceName, err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+				return nil, errors.New("failed to parse " + b.serviceName + " CA: " + cfg.TLSCAPath)
+			}
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	dialOpts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if serviceConfig := cfg.serviceConfig(); serviceConfig != "" {
+		dialOpts = append(dialOpts, grpc.WithDefaultServiceConfig(serviceConfig))
+	}
+	if cfg.KeepaliveTime > 0 {
+		dialOpts = append(dialOpts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                cfg.KeepaliveTime,
+			Timeout:             cfg.KeepaliveTimeout,
+			PermitWithoutStream: cfg.KeepalivePermitWithoutStream,
+		}))
+	}
+	if cfg.Compression != "none" {
+		dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(grpc.UseCompressor(cfg.Compression)))
+	}
+	if cfg.Token != "" {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(bearerToken{token: cfg.Token, secure: !cfg.Insecure}))
+	}
+
+	if tp, ok := otelctx.TracerProvider(ctx); ok {
+		dialOpts = append(dialOpts, grpc.WithStatsHandler(otelgrpc.NewClientHandler(
+			otelgrpc.WithTracerProvider(tp),
+			otelgrpc.WithPropagators(otel.GetTextMapPropagator()),
+		)))
+	}
+
+	dialOpts = append(append(dialOpts, b.dialOpts...), opts...)
+	conn, err := grpc.Dial(cfg.Endpoint, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", b.serviceName, err)
+	}
+
+	b.logger.V(b.preRunLevel).Info(
+		"configured grpc client",
+		"service", b.serviceName,
+		"endpoint", cfg.Endpoint,
+		"insecure", cfg.Insecure,
+	)
+	return conn, nil
+}
+
+// serviceConfig returns the gRPC service config applying the timeout, retry
+// policy, and wait-for-ready settings to every method, or an empty string if
+// they are all disabled.
+//
+// Hedging policies are not supported because gRPC-Go ignores them, sending
+// every request once instead of retrying it.
+//
+// See https://github.com/grpc/grpc/blob/master/doc/service_config.md
+func (c ClientConfig) serviceConfig() string {
+	type retryPolicy struct {
+		MaxAttempts          int      `json:"maxAttempts"`
+		InitialBackoff       string   `json:"initialBackoff"`
+		MaxBackoff           string   `json:"maxBackoff"`
+		BackoffMultiplier    float64  `json:"backoffMultiplier"`
+		RetryableStatusCodes []string `json:"retryableStatusCodes"`
+	}
+	type methodConfig struct {
+		Name         []struct{}   `json:"name"`
+		Timeout      string       `json:"timeout,omitempty"`
+		WaitForReady bool         `json:"waitForReady,omitempty"`
+		RetryPolicy  *retryPolicy `json:"retryPolicy,omitempty"`
+	}
+
+	// A single empty name matches every method of every service.
+	mc := methodConfig{Name: []struct{}{{}}, WaitForReady: c.WaitForReady}
+	if c.Timeout > 0 {
+		mc.Timeout = durationString(c.Timeout)
+	}
+	if c.RetryMaxAttempts > 1 && len(c.RetryCodes) > 0 {
+		mc.RetryPolicy = &retryPolicy{
+			MaxAttempts:          c.RetryMaxAttempts,
+			InitialBackoff:       durationString(c.RetryInitialBackoff),
+			MaxBackoff:           durationString(c.RetryMaxBackoff),
+			BackoffMultiplier:    2,
+			RetryableStatusCodes: c.RetryCodes,
+		}
+	}
+	if mc.Timeout == "" && !mc.WaitForReady && mc.RetryPolicy == nil {
+		return ""
+	}
+
+	serviceConfig, err := json.Marshal(map[string][]methodConfig{"methodConfig": {mc}})
+	if err != nil {
+		panic("failed to marshal gRPC service config: " + err.Error())
+	}
+	return string(serviceConfig)
+}
+
+// durationString formats a duration as expected by gRPC service configs,
+// e.g. "0.1s".
+func durationString(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+// bearerToken sends a token in the "authorization" metadata of every request.
+type bearerToken struct {
+	token  string
+	secure bool
+}
+
+func (t bearerToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+// RequireTransportSecurity allows tokens to be sent over connections that
+// were explicitly configured to be insecure, such as to a local server.
+func (t bearerToken) RequireTransportSecurity() bool {
+	return t.secure
+}
+
+// WithClientLogger configures logging of the configured gRPC client.
+func WithClientLogger(logger logr.Logger) ClientOption {
+	return func(b *ClientBuilder) { b.logger = logger }
+}
+
+// WithDefaultEndpoint configures the default value of the address of the
+// server.
+//
+// No endpoint is set by default.
+func WithDefaultEndpoint(endpoint string) ClientOption {
+	return func(b *ClientBuilder) { b.defaultEndpoint = endpoint }
+}
+
+// WithClientFlagPrefix defines prefix used with the generated flags.
+//
+// Defaults to the name of the service.
+func WithClientFlagPrefix(flagPrefix string) ClientOption {
+	return func(b *ClientBuilder) { b.flagPrefix = flagPrefix }
+}
+
+// WithClientPreRunLevel defines the logging level used for pre-run log
+// messages.
+//
+// Defaults to "debug".
+func WithClientPreRunLevel(preRunLevel int) ClientOption {
+	return func(b *ClientBuilder) { b.preRunLevel = preRunLevel }
+}
+
+// WithDialOptions adds options used by every connection created by
+// DialFromFlags, before any options passed to it.
+//
+// No additional options are used by default.
+func WithDialOptions(opts ...grpc.DialOption) ClientOption {
+	return func(b *ClientBuilder) { b.dialOpts = append(b.dialOpts, opts...) }
+}
@@ -0,0 +1,95 @@
+package cobragrpc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func clientConfig(t *testing.T, args ...string) (ClientConfig, error) {
+	t.Helper()
+
+	b := NewClient("backend")
+	cmd := &cobra.Command{Use: "test"}
+	b.RegisterFlags(cmd.Flags())
+	if err := cmd.ParseFlags(append([]string{"--backend-endpoint=localhost:50051"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+	return b.ConfigFromFlags(cmd)
+}
+
+func TestClientServiceConfig(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "disabled",
+			expected: "",
+		},
+		{
+			name:     "timeout",
+			args:     []string{"--backend-timeout=1.5s", "--backend-wait-for-ready"},
+			expected: `{"methodConfig":[{"name":[{}],"timeout":"1.5s","waitForReady":true}]}`,
+		},
+		{
+			name:     "retry",
+			args:     []string{"--backend-retry-max-attempts=3", "--backend-retry-codes=unavailable,resource_exhausted"},
+			expected: `{"methodConfig":[{"name":[{}],"retryPolicy":{"maxAttempts":3,"initialBackoff":"0.1s","maxBackoff":"1s","backoffMultiplier":2,"retryableStatusCodes":["UNAVAILABLE","RESOURCE_EXHAUSTED"]}}]}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := clientConfig(t, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := cfg.serviceConfig()
+			if actual != tt.expected {
+				t.Fatalf("expected service config %s, got %s", tt.expected, actual)
+			}
+			if actual == "" {
+				return
+			}
+
+			// gRPC validates the default service config when dialing.
+			conn, err := grpc.Dial("localhost:50051",
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+				grpc.WithDefaultServiceConfig(actual),
+			)
+			if err != nil {
+				t.Fatalf("gRPC rejected the service config: %v", err)
+			}
+			_ = conn.Close()
+		})
+	}
+}
+
+func TestClientConfigRetryErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "no attempts",
+			args:     []string{"--backend-retry-max-attempts=0"},
+			expected: "--backend-retry-max-attempts must be at least 1",
+		},
+		{
+			name:     "no backoff",
+			args:     []string{"--backend-retry-max-attempts=2", "--backend-retry-max-backoff=0"},
+			expected: "--backend-retry-initial-backoff and --backend-retry-max-backoff must be positive when retries are enabled",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := clientConfig(t, tt.args...)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Fatalf("expected an error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -1,20 +1,38 @@
 // Package cobragrpc implements a builder for registering flags and producing
-// a Cobra RunFunc that configures a gRPC server.
+// a Cobra RunFunc that configures a gRPC server, as well as a builder for
+// connecting to gRPC servers as a client.
 package cobragrpc
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/fs"
 	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/jzelinskie/cobrautil/v2"
+	"github.com/jzelinskie/cobrautil/v2/internal/netutil"
+	"github.com/jzelinskie/cobrautil/v2/internal/otelctx"
 
 	"github.com/go-logr/logr"
 	"github.com/jzelinskie/stringz"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"golang.org/x/crypto/acme/autocert"
 	"google.golang.org/grpc"
+	channelz "google.golang.org/grpc/channelz/service"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/keepalive"
 )
 
@@ -30,6 +48,7 @@ func New(serviceName string, opts ...Option) *Builder {
 		defaultAddr:    ":50051",
 		defaultEnabled: false,
 		flagPrefix:     "grpc",
+		health:         health.NewServer(),
 	}
 	for _, configure := range opts {
 		configure(b)
@@ -45,6 +64,21 @@ type Builder struct {
 	defaultEnabled bool
 	logger         logr.Logger
 	preRunLevel    int
+	tlsSecret      string
+	health         *health.Server
+	registrars     []func(grpc.ServiceRegistrar)
+	onServing      []func(context.Context)
+	modes          []serverMode
+
+	unaryInterceptors  []grpc.UnaryServerInterceptor
+	streamInterceptors []grpc.StreamServerInterceptor
+	accessLogging      bool
+	accessLogLevel     int
+	metricsRegisterer  prometheus.Registerer
+
+	defaultHealthEnabled bool
+	strictDisabled       bool
+	flusher              *cobrautil.Flusher
 }
 
 func (b *Builder) prefix(s string) string {
@@ -55,81 +89,856 @@ func (b *Builder) prefix(s string) string {
 //
 // The following flags are added:
 // - "$PREFIX-addr"
+// - "$PREFIX-legacy-addr"
+// - "$PREFIX-socket-mode"
+// - "$PREFIX-socket-owner"
 // - "$PREFIX-tls-cert-path"
 // - "$PREFIX-tls-key-path"
+// - "$PREFIX-tls-cert"
+// - "$PREFIX-tls-key"
+// - "$PREFIX-tls-reload-interval"
+// - "$PREFIX-tls-secret"
+// - "$PREFIX-spiffe-socket"
+// - "$PREFIX-acme-domains"
+// - "$PREFIX-acme-cache-dir"
+// - "$PREFIX-acme-directory-url"
+// - "$PREFIX-tls-client-ca-path"
+// - "$PREFIX-client-auth"
+// - "$PREFIX-preshared-key"
+// - "$PREFIX-authz-webhook-url"
+// - "$PREFIX-authz-timeout"
+// - "$PREFIX-authz-cache-ttl"
 // - "$PREFIX-max-conn-age"
+// - "$PREFIX-max-concurrent-rpcs"
+// - "$PREFIX-rps-limit"
+// - "$PREFIX-max-concurrent-streams"
+// - "$PREFIX-initial-window-size"
+// - "$PREFIX-initial-conn-window-size"
+// - "$PREFIX-num-stream-workers"
+// - "$PREFIX-compression"
+// - "$PREFIX-shutdown-grace-period"
+// - "$PREFIX-health-enabled"
+// - "$PREFIX-tracing-enabled"
+// - "$PREFIX-channelz-enabled"
+// - "$PREFIX-accept-retry"
+// - "$PREFIX-accept-retry-max-backoff"
+// - "$PREFIX-stall-check-interval"
+// - "$PREFIX-stall-action"
+// - "$PREFIX-<name>-enabled" for each mode provided by WithServerMode
 func (b *Builder) RegisterFlags(flags *pflag.FlagSet) {
 	flags.String(b.prefix("addr"), b.defaultAddr, "address to listen on to serve "+b.serviceName)
+	flags.String(b.prefix("legacy-addr"), "", "additional address to listen on to serve "+b.serviceName+" while clients migrate to --"+b.prefix("addr")+"; connections are logged (disabled if empty)")
 	flags.String(b.prefix("network"), "tcp", "network type to serve "+b.serviceName+` ("tcp", "tcp4", "tcp6", "unix", "unixpacket")`)
+	flags.String(b.prefix("socket-mode"), "", "permissions in octal (e.g. 0660) of the unix socket used to serve "+b.serviceName+" (defaults to the umask)")
+	flags.String(b.prefix("socket-owner"), "", `owner ("user[:group]") of the unix socket used to serve `+b.serviceName+" (defaults to the current user)")
 	flags.String(b.prefix("tls-cert-path"), "", "local path to the TLS certificate used to serve "+b.serviceName)
 	flags.String(b.prefix("tls-key-path"), "", "local path to the TLS key used to serve "+b.serviceName)
+	flags.String(b.prefix("tls-cert"), "", "PEM-encoded TLS certificate used to serve "+b.serviceName+` instead of a file, optionally prefixed by "base64:" or given as "env:VARIABLE"`)
+	cobrautil.RegisterSecretFlag(flags, b.prefix("tls-key"), "PEM-encoded TLS key used to serve "+b.serviceName+` instead of a file, optionally prefixed by "base64:" or given as "env:VARIABLE"`)
+	flags.Duration(b.prefix("tls-reload-interval"), time.Minute, "how often the files of the TLS certificate used to serve "+b.serviceName+" are checked for renewals (0 disables reloading)")
+	flags.String(b.prefix("tls-secret"), b.tlsSecret, "Kubernetes TLS secret (\"namespace/name\" or \"name\") watched for the certificate used to serve "+b.serviceName)
+	flags.String(b.prefix("spiffe-socket"), "", "SPIFFE Workload API socket (e.g. unix:///run/spire/agent.sock) from which the rotating identity used to serve "+b.serviceName+" is fetched")
+	flags.StringSlice(b.prefix("acme-domains"), nil, "domains for which certificates used to serve "+b.serviceName+" are obtained via ACME, which requires serving on port 443")
+	flags.String(b.prefix("acme-cache-dir"), "", "local directory in which certificates obtained via ACME for "+b.serviceName+" are stored (kept in memory if empty)")
+	flags.String(b.prefix("acme-directory-url"), autocert.DefaultACMEDirectory, "URL of the ACME directory from which certificates used to serve "+b.serviceName+" are obtained")
+	flags.String(b.prefix("tls-client-ca-path"), "", "local path to the certificate authorities used to verify client certificates presented to "+b.serviceName)
+	flags.String(b.prefix("client-auth"), "none", "policy for client certificates presented to "+b.serviceName+` ("none", "request", "require-and-verify")`)
+	cobrautil.RegisterSecretFlag(flags, b.prefix("preshared-key"), "bearer token required in the \"authorization\" metadata of requests to "+b.serviceName+", except for health checks (disabled if empty)")
+	flags.String(b.prefix("authz-webhook-url"), "", "URL of an HTTP webhook that authorizes every request to "+b.serviceName+", except for health checks (disabled if empty)")
+	flags.Duration(b.prefix("authz-timeout"), time.Second, "how long to wait for the authorization webhook before rejecting a request to "+b.serviceName+" with UNAVAILABLE")
+	flags.Duration(b.prefix("authz-cache-ttl"), 10*time.Second, "how long decisions of the authorization webhook are cached by method and \"authorization\" metadata (0 disables caching)")
 	flags.Duration(b.prefix("max-conn-age"), 30*time.Second, "how long a connection serving "+b.serviceName+" should be able to live")
+	flags.Int(b.prefix("max-concurrent-rpcs"), 0, "maximum number of requests to "+b.serviceName+" handled at once before rejecting them with RESOURCE_EXHAUSTED (0 for no limit)")
+	flags.Float64(b.prefix("rps-limit"), 0, "maximum rate of requests per second to "+b.serviceName+" before rejecting them with RESOURCE_EXHAUSTED (0 for no limit)")
+	flags.Uint32(b.prefix("max-concurrent-streams"), 0, "maximum number of concurrent streams of each HTTP/2 connection to "+b.serviceName+" (0 for the gRPC default)")
+	flags.Int32(b.prefix("initial-window-size"), 0, "initial HTTP/2 flow control window of each stream to "+b.serviceName+" in bytes (0 for the gRPC default, at least 65535 otherwise)")
+	flags.Int32(b.prefix("initial-conn-window-size"), 0, "initial HTTP/2 flow control window of each connection to "+b.serviceName+" in bytes (0 for the gRPC default, at least 65535 otherwise)")
+	flags.Uint32(b.prefix("num-stream-workers"), 0, "number of goroutines handling streams to "+b.serviceName+" instead of starting one per stream (0 disables the worker pool)")
+	flags.String(b.prefix("compression"), "none", "compression of responses from "+b.serviceName+` when supported by the client ("none", "gzip", "zstd"); compressed requests are always accepted`)
+	flags.Duration(b.prefix("shutdown-grace-period"), 10*time.Second, "how long in-flight requests to "+b.serviceName+" are given to complete when shutting down before they are canceled (0 waits indefinitely)")
 	flags.Bool(b.prefix("enabled"), b.defaultEnabled, "enable "+b.serviceName+" gRPC server")
+	flags.Bool(b.prefix("tracing-enabled"), true, "trace requests to the "+b.serviceName+" gRPC server when tracing is configured by cobraotel")
+	flags.Bool(b.prefix("health-enabled"), b.defaultHealthEnabled, "register the gRPC health service on the "+b.serviceName+" gRPC server")
+	flags.Bool(b.prefix("channelz-enabled"), false, "register the channelz service on the "+b.serviceName+" gRPC server for diagnosing connections and requests")
+	flags.Bool(b.prefix("accept-retry"), true, "retry accepting connections to "+b.serviceName+" after transient errors (e.g. running out of file descriptors) instead of stopping the server")
+	flags.Duration(b.prefix("accept-retry-max-backoff"), time.Second, "maximum delay between retries of accepting connections to "+b.serviceName)
+	flags.Duration(b.prefix("stall-check-interval"), 0, "interval between checks that "+b.serviceName+" is still accepting connections, made by dialing its own TCP listeners (disabled if zero)")
+	flags.String(b.prefix("stall-action"), "log", "action taken when "+b.serviceName+` stops accepting connections ("log", or "stop" to stop serving after three consecutive failed checks so that the process can be restarted)`)
+	for _, m := range b.modes {
+		flags.Bool(b.prefix(m.name+"-enabled"), false, m.usage)
+	}
+
+	// Listen addresses commonly differ between instances of a service.
+	if err := cobrautil.MarkFlagsInstanceLocal(flags, b.prefix("addr"), b.prefix("legacy-addr")); err != nil {
+		panic("failed to mark flag instance-local: " + err.Error())
+	}
+}
+
+// RegisterNamedFlags adds the flags from RegisterFlags() to the "gRPC"
+// section of the provided NamedFlagSets.
+func (b *Builder) RegisterNamedFlags(nfs *cobrautil.NamedFlagSets) {
+	b.RegisterFlags(nfs.FlagSet("gRPC"))
+}
+
+// Config is the configuration of a gRPC server resolved from the flags
+// registered by RegisterFlags().
+type Config struct {
+	Enabled           bool
+	Network           string
+	Addr              string
+	LegacyAddr        string
+	SocketMode        fs.FileMode
+	SocketOwner       string
+	TLSCertPath       string
+	TLSKeyPath        string
+	TLSCert           string
+	TLSKey            string
+	TLSReloadInterval time.Duration
+	TLSSecret         string
+	SpiffeSocket      string
+	ACMEDomains       []string
+	ACMECacheDir      string
+	ACMEDirectoryURL  string
+	ClientCAPath      string
+	ClientAuth        string
+	PresharedKey      string
+	AuthzWebhookURL   string
+	AuthzTimeout      time.Duration
+	AuthzCacheTTL     time.Duration
+	MaxConnAge        time.Duration
+	MaxConcurrentRPCs int
+	RPSLimit          float64
+
+	MaxConcurrentStreams  uint32
+	InitialWindowSize     int32
+	InitialConnWindowSize int32
+	NumStreamWorkers      uint32
+	Compression           string
+
+	ShutdownGracePeriod time.Duration
+	HealthEnabled       bool
+	TracingEnabled      bool
+	ChannelzEnabled     bool
+
+	AcceptRetry           bool
+	AcceptRetryMaxBackoff time.Duration
+
+	StallCheckInterval time.Duration
+	StallAction        string
+
+	// ServerMode is the name of the mode provided by WithServerMode that is
+	// enabled, or empty if the server is a *grpc.Server.
+	ServerMode string
+}
+
+// Insecure returns true if the server is configured to serve plaintext.
+func (c Config) Insecure() bool {
+	return isInsecure(c.TLSCertPath, c.TLSKeyPath) && isInsecure(c.TLSCert, c.TLSKey) && c.TLSSecret == "" && c.SpiffeSocket == "" && len(c.ACMEDomains) == 0
+}
+
+// ConfigFromFlags resolves the configuration of a gRPC server from the flags
+// registered by RegisterFlags() without constructing or starting anything.
+func (b *Builder) ConfigFromFlags(cmd *cobra.Command) (Config, error) {
+	cfg := Config{
+		Enabled:           cobrautil.MustGetBool(cmd, b.prefix("enabled")),
+		Network:           cobrautil.MustGetString(cmd, b.prefix("network")),
+		Addr:              cobrautil.MustGetStringExpanded(cmd, b.prefix("addr")),
+		LegacyAddr:        cobrautil.MustGetStringExpanded(cmd, b.prefix("legacy-addr")),
+		SocketOwner:       cobrautil.MustGetString(cmd, b.prefix("socket-owner")),
+		TLSCertPath:       cobrautil.MustGetStringExpanded(cmd, b.prefix("tls-cert-path")),
+		TLSKeyPath:        cobrautil.MustGetStringExpanded(cmd, b.prefix("tls-key-path")),
+		TLSCert:           cobrautil.MustGetString(cmd, b.prefix("tls-cert")),
+		TLSKey:            cobrautil.MustGetSecret(cmd, b.prefix("tls-key")),
+		TLSReloadInterval: cobrautil.MustGetDuration(cmd, b.prefix("tls-reload-interval")),
+		TLSSecret:         cobrautil.MustGetStringExpanded(cmd, b.prefix("tls-secret")),
+		SpiffeSocket:      cobrautil.MustGetStringExpanded(cmd, b.prefix("spiffe-socket")),
+		ACMEDomains:       cobrautil.MustGetStringSlice(cmd, b.prefix("acme-domains")),
+		ACMECacheDir:      cobrautil.MustGetStringExpanded(cmd, b.prefix("acme-cache-dir")),
+		ACMEDirectoryURL:  cobrautil.MustGetString(cmd, b.prefix("acme-directory-url")),
+		ClientCAPath:      cobrautil.MustGetStringExpanded(cmd, b.prefix("tls-client-ca-path")),
+		ClientAuth:        cobrautil.MustGetString(cmd, b.prefix("client-auth")),
+		PresharedKey:      cobrautil.MustGetSecret(cmd, b.prefix("preshared-key")),
+		AuthzWebhookURL:   cobrautil.MustGetStringExpanded(cmd, b.prefix("authz-webhook-url")),
+		AuthzTimeout:      cobrautil.MustGetDuration(cmd, b.prefix("authz-timeout")),
+		AuthzCacheTTL:     cobrautil.MustGetDuration(cmd, b.prefix("authz-cache-ttl")),
+		MaxConnAge:        cobrautil.MustGetDuration(cmd, b.prefix("max-conn-age")),
+		MaxConcurrentRPCs: cobrautil.MustGetInt(cmd, b.prefix("max-concurrent-rpcs")),
+		RPSLimit:          cobrautil.MustGetFloat64(cmd, b.prefix("rps-limit")),
+
+		MaxConcurrentStreams:  cobrautil.MustGetUint32(cmd, b.prefix("max-concurrent-streams")),
+		InitialWindowSize:     cobrautil.MustGetInt32(cmd, b.prefix("initial-window-size")),
+		InitialConnWindowSize: cobrautil.MustGetInt32(cmd, b.prefix("initial-conn-window-size")),
+		NumStreamWorkers:      cobrautil.MustGetUint32(cmd, b.prefix("num-stream-workers")),
+		Compression:           cobrautil.MustGetString(cmd, b.prefix("compression")),
+
+		ShutdownGracePeriod: cobrautil.MustGetDuration(cmd, b.prefix("shutdown-grace-period")),
+		HealthEnabled:       cobrautil.MustGetBool(cmd, b.prefix("health-enabled")),
+		TracingEnabled:      cobrautil.MustGetBool(cmd, b.prefix("tracing-enabled")),
+		ChannelzEnabled:     cobrautil.MustGetBool(cmd, b.prefix("channelz-enabled")),
+
+		AcceptRetry:           cobrautil.MustGetBool(cmd, b.prefix("accept-retry")),
+		AcceptRetryMaxBackoff: cobrautil.MustGetDuration(cmd, b.prefix("accept-retry-max-backoff")),
+
+		StallCheckInterval: cobrautil.MustGetDuration(cmd, b.prefix("stall-check-interval")),
+		StallAction:        cobrautil.MustGetString(cmd, b.prefix("stall-action")),
+	}
+
+	mode, err := netutil.ParseSocketMode(cobrautil.MustGetString(cmd, b.prefix("socket-mode")))
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to start gRPC server: --%s-socket-mode: %w", b.flagPrefix, err)
+	}
+	cfg.SocketMode = mode
+
+	for _, m := range b.modes {
+		if !cobrautil.MustGetBool(cmd, b.prefix(m.name+"-enabled")) {
+			continue
+		}
+		if cfg.ServerMode != "" {
+			return Config{}, fmt.Errorf("failed to start gRPC server: --%s cannot be combined with --%s", b.prefix(m.name+"-enabled"), b.prefix(cfg.ServerMode+"-enabled"))
+		}
+		cfg.ServerMode = m.name
+	}
+
+	if cfg.TLSSecret != "" && !isInsecure(cfg.TLSCertPath, cfg.TLSKeyPath) {
+		return Config{}, fmt.Errorf(
+			"failed to start gRPC server: --%s-tls-secret cannot be combined with --%s-tls-cert-path and --%s-tls-key-path",
+			b.flagPrefix,
+			b.flagPrefix,
+			b.flagPrefix,
+		)
+	}
+
+	if !isInsecure(cfg.TLSCert, cfg.TLSKey) && (cfg.TLSSecret != "" || !isInsecure(cfg.TLSCertPath, cfg.TLSKeyPath)) {
+		return Config{}, fmt.Errorf(
+			"failed to start gRPC server: --%s-tls-cert and --%s-tls-key cannot be combined with other sources of TLS certificates",
+			b.flagPrefix,
+			b.flagPrefix,
+		)
+	}
+
+	if !isInsecure(cfg.TLSCert, cfg.TLSKey) && !isSecure(cfg.TLSCert, cfg.TLSKey) {
+		return Config{}, fmt.Errorf(
+			"failed to start gRPC server: must provide both --%s-tls-cert and --%s-tls-key",
+			b.flagPrefix,
+			b.flagPrefix,
+		)
+	}
+
+	if cfg.SpiffeSocket != "" && (cfg.TLSSecret != "" || !isInsecure(cfg.TLSCertPath, cfg.TLSKeyPath) || !isInsecure(cfg.TLSCert, cfg.TLSKey)) {
+		return Config{}, fmt.Errorf(
+			"failed to start gRPC server: --%s-spiffe-socket cannot be combined with other sources of TLS certificates",
+			b.flagPrefix,
+		)
+	}
+
+	if len(cfg.ACMEDomains) > 0 && (cfg.TLSSecret != "" || cfg.SpiffeSocket != "" || !isInsecure(cfg.TLSCertPath, cfg.TLSKeyPath) || !isInsecure(cfg.TLSCert, cfg.TLSKey)) {
+		return Config{}, fmt.Errorf(
+			"failed to start gRPC server: --%s-acme-domains cannot be combined with other sources of TLS certificates",
+			b.flagPrefix,
+		)
+	}
+
+	if !isInsecure(cfg.TLSCertPath, cfg.TLSKeyPath) && !isSecure(cfg.TLSCertPath, cfg.TLSKeyPath) {
+		return Config{}, fmt.Errorf(
+			"failed to start gRPC server: must provide both --%s-tls-cert-path and --%s-tls-key-path",
+			b.flagPrefix,
+			b.flagPrefix,
+		)
+	}
+
+	if cfg.AuthzWebhookURL != "" {
+		if u, err := url.Parse(cfg.AuthzWebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return Config{}, fmt.Errorf("failed to start gRPC server: --%s must be an http or https URL: %s", b.prefix("authz-webhook-url"), cfg.AuthzWebhookURL)
+		}
+	}
+
+	// gRPC silently ignores windows smaller than the HTTP/2 default.
+	for name, size := range map[string]int32{"initial-window-size": cfg.InitialWindowSize, "initial-conn-window-size": cfg.InitialConnWindowSize} {
+		if size < 0 || size > 0 && size < 65535 {
+			return Config{}, fmt.Errorf("failed to start gRPC server: --%s must be 0 or at least 65535: %d", b.prefix(name), size)
+		}
+	}
+
+	if _, ok := compressors[cfg.Compression]; !ok {
+		return Config{}, fmt.Errorf(`failed to start gRPC server: --%s must be one of "none", "gzip", "zstd": %s`, b.prefix("compression"), cfg.Compression)
+	}
+
+	if cfg.StallAction != "log" && cfg.StallAction != "stop" {
+		return Config{}, fmt.Errorf(`failed to start gRPC server: --%s must be one of "log", "stop": %s`, b.prefix("stall-action"), cfg.StallAction)
+	}
+
+	if _, ok := clientAuthTypes[cfg.ClientAuth]; !ok {
+		return Config{}, fmt.Errorf(`failed to start gRPC server: --%s-client-auth must be one of "none", "request", "require-and-verify": %s`, b.flagPrefix, cfg.ClientAuth)
+	}
+
+	if cfg.ClientAuth == "require-and-verify" && cfg.ClientCAPath == "" && cfg.SpiffeSocket == "" {
+		return Config{}, fmt.Errorf("failed to start gRPC server: --%s-client-auth=require-and-verify requires --%s-tls-client-ca-path", b.flagPrefix, b.flagPrefix)
+	}
+
+	if cfg.Insecure() && (cfg.ClientAuth != "none" || cfg.ClientCAPath != "") {
+		return Config{}, fmt.Errorf("failed to start gRPC server: client certificates require TLS to be configured")
+	}
+
+	if cfg.Enabled && cfg.Insecure() && cobrautil.TLSRequired(cmd) {
+		return Config{}, fmt.Errorf(
+			"failed to start gRPC server: TLS is required but none of --%s-tls-cert-path and --%s-tls-key-path, --%s-tls-cert and --%s-tls-key, --%s-tls-secret, --%s-spiffe-socket, or --%s-acme-domains were provided",
+			b.flagPrefix,
+			b.flagPrefix,
+			b.flagPrefix,
+			b.flagPrefix,
+			b.flagPrefix,
+			b.flagPrefix,
+			b.flagPrefix,
+		)
+	}
+
+	return cfg, nil
 }
 
 // ServerFromFlags creates an *grpc.Server as configured by the flags from
 // RegisterFlags().
+//
+// Requests pass through the interceptors of the server in the following order,
+// skipping those that are not configured:
+//  1. panics of the interceptors and handlers below are recovered, logged, and
+//     returned as INTERNAL errors rather than crashing the server
+//  2. requests are logged by WithAccessLogging
+//  3. requests are authenticated with the preshared key
+//  4. requests are limited by the maximum number of concurrent requests and
+//     the rate limit
+//  5. responses are compressed
+//  6. requests are authorized by the webhook
+//  7. the interceptors provided by WithUnaryInterceptors and
+//     WithStreamInterceptors
+//  8. the interceptors provided in opts
+//
+// Requests are limited before they are authorized so that a flood of requests
+// cannot overwhelm the webhook, which is called over the network for every
+// request missing from its cache. Authenticated callers may therefore use up
+// the rate limit with requests that are then denied, which is why callers that
+// are not authenticated are rejected first. When tracing is enabled, spans are
+// started before any interceptors run.
+//
+// The contexts of requests carry the server and the address of the listener
+// that accepted their connection, which can be retrieved with
+// ServerFromContext and AddrFromContext.
+//
+// An error is returned if a mode provided by WithServerMode is enabled, since
+// its server is not an *grpc.Server; use ServerFromFlagsWithModes instead.
 func (b *Builder) ServerFromFlags(cmd *cobra.Command, opts ...grpc.ServerOption) (*grpc.Server, error) {
+	cfg, err := b.ConfigFromFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ServerMode != "" {
+		return nil, fmt.Errorf("failed to create gRPC server: --%s requires ServerFromFlagsWithModes", b.prefix(cfg.ServerMode+"-enabled"))
+	}
+
+	srv, err := b.newServer(cmd, cfg, opts, newGRPCServer)
+	if err != nil {
+		return nil, err
+	}
+	return srv.(*grpc.Server), nil
+}
+
+// newGRPCServer is the ServerFactory of servers created without a mode.
+func newGRPCServer(creds credentials.TransportCredentials, opts ...grpc.ServerOption) (Server, error) {
+	if creds != nil {
+		opts = append(opts, grpc.Creds(creds))
+	}
+	return grpc.NewServer(opts...), nil
+}
+
+// ServerFromFlagsWithModes creates a server like ServerFromFlags, or with the
+// mode provided by WithServerMode that is enabled by its flag, if any.
+func (b *Builder) ServerFromFlagsWithModes(cmd *cobra.Command, opts ...grpc.ServerOption) (Server, error) {
+	cfg, err := b.ConfigFromFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := b.mode(cfg)
+	if !ok {
+		srv, err := b.ServerFromFlags(cmd, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return srv, nil
+	}
+
+	return b.newServer(cmd, cfg, opts, func(creds credentials.TransportCredentials, opts ...grpc.ServerOption) (Server, error) {
+		srv, err := m.newServer(creds, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gRPC server with --%s: %w", b.prefix(m.name+"-enabled"), err)
+		}
+		return srv, nil
+	})
+}
+
+// newServer creates a server configured by the flags with the provided
+// factory and registers the services on it.
+func (b *Builder) newServer(cmd *cobra.Command, cfg Config, opts []grpc.ServerOption, factory ServerFactory) (Server, error) {
+	opts, creds, err := b.serverOptions(cmd, cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := &serverContext{}
+	if cfg.HealthEnabled {
+		sc.health = b.health
+	}
+	srv, err := factory(creds, append(opts, grpc.StatsHandler(sc))...)
+	if err != nil {
+		return nil, err
+	}
+	sc.srv = srv
+
+	b.register(cfg, srv)
+	return srv, nil
+}
+
+// serverOptions returns the options of a server configured by the flags, with
+// the credentials configured by the TLS flags returned separately, or nil if
+// the server is configured to serve plaintext.
+func (b *Builder) serverOptions(cmd *cobra.Command, cfg Config, opts []grpc.ServerOption) ([]grpc.ServerOption, credentials.TransportCredentials, error) {
+	// gRPC chains interceptors in the order their options are provided.
+	recoverer := panicRecoverer{logger: b.logger.WithValues("service", b.serviceName)}
+	chain := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(recoverer.unaryInterceptor),
+		grpc.ChainStreamInterceptor(recoverer.streamInterceptor),
+	}
+	if b.accessLogging {
+		access := accessLogger{logger: b.logger.V(b.accessLogLevel).WithValues("service", b.serviceName)}
+		chain = append(chain,
+			grpc.StatsHandler(access),
+			grpc.ChainUnaryInterceptor(access.unaryInterceptor),
+			grpc.ChainStreamInterceptor(access.streamInterceptor),
+		)
+	}
+	if cfg.PresharedKey != "" {
+		auth := presharedKeyAuth(cfg.PresharedKey)
+		chain = append(chain,
+			grpc.ChainUnaryInterceptor(auth.unaryInterceptor),
+			grpc.ChainStreamInterceptor(auth.streamInterceptor),
+		)
+	}
+	if cfg.MaxConcurrentRPCs > 0 || cfg.RPSLimit > 0 {
+		limiter := newRequestLimiter(cfg.MaxConcurrentRPCs, cfg.RPSLimit)
+		chain = append(chain,
+			grpc.ChainUnaryInterceptor(limiter.unaryInterceptor),
+			grpc.ChainStreamInterceptor(limiter.streamInterceptor),
+		)
+	}
+	if cfg.Compression != "none" {
+		compressor := responseCompressor(cfg.Compression)
+		chain = append(chain,
+			grpc.ChainUnaryInterceptor(compressor.unaryInterceptor),
+			grpc.ChainStreamInterceptor(compressor.streamInterceptor),
+		)
+	}
+	if cfg.AuthzWebhookURL != "" {
+		authz := newWebhookAuthz(cfg.AuthzWebhookURL, cfg.AuthzTimeout, cfg.AuthzCacheTTL, b.logger)
+		chain = append(chain,
+			grpc.ChainUnaryInterceptor(authz.unaryInterceptor),
+			grpc.ChainStreamInterceptor(authz.streamInterceptor),
+		)
+	}
+	if len(b.unaryInterceptors) > 0 {
+		chain = append(chain, grpc.ChainUnaryInterceptor(b.unaryInterceptors...))
+	}
+	if len(b.streamInterceptors) > 0 {
+		chain = append(chain, grpc.ChainStreamInterceptor(b.streamInterceptors...))
+	}
+	opts = append(chain, opts...)
+
 	opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{
-		MaxConnectionAge: cobrautil.MustGetDuration(cmd, b.prefix("max-conn-age")),
+		MaxConnectionAge: cfg.MaxConnAge,
 	}))
 
-	certPath := cobrautil.MustGetStringExpanded(cmd, b.prefix("tls-cert-path"))
-	keyPath := cobrautil.MustGetStringExpanded(cmd, b.prefix("tls-key-path"))
+	// Zero values leave the gRPC defaults in place.
+	if cfg.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(cfg.MaxConcurrentStreams))
+	}
+	if cfg.InitialWindowSize > 0 {
+		opts = append(opts, grpc.InitialWindowSize(cfg.InitialWindowSize))
+	}
+	if cfg.InitialConnWindowSize > 0 {
+		opts = append(opts, grpc.InitialConnWindowSize(cfg.InitialConnWindowSize))
+	}
+	if cfg.NumStreamWorkers > 0 {
+		opts = append(opts, grpc.NumStreamWorkers(cfg.NumStreamWorkers))
+	}
 
+	tlsConfig := &tls.Config{
+		ClientAuth: clientAuthTypes[cfg.ClientAuth],
+		MinVersion: tls.VersionTLS12,
+	}
+	if cfg.ClientCAPath != "" {
+		caPEM, err := os.ReadFile(cfg.ClientCAPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(caPEM) {
+			return nil, nil, fmt.Errorf("failed to parse client CA: %s", cfg.ClientCAPath)
+		}
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var creds credentials.TransportCredentials
 	switch {
-	case isInsecure(certPath, keyPath):
-		return grpc.NewServer(opts...), nil
+	case cfg.SpiffeSocket != "":
+		source, err := newSpiffeSource(cfg.SpiffeSocket, &certificateHolder{}, b.logger)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := source.Start(ctx); err != nil {
+			return nil, nil, err
+		}
 
-	case isSecure(certPath, keyPath):
-		creds, err := credentials.NewServerTLSFromFile(certPath, keyPath)
+		source.ServerTLSConfig(tlsConfig)
+		creds = credentials.NewTLS(tlsConfig)
+
+	case isSecure(cfg.TLSCert, cfg.TLSKey):
+		cert, err := loadInlineKeyPair(cfg.TLSCert, cfg.TLSKey)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		opts = append(opts, grpc.Creds(creds))
-		return grpc.NewServer(opts...), nil
 
-	default:
-		return nil, fmt.Errorf(
-			"failed to start gRPC server: must provide both --%s-tls-cert-path and --%s-tls-key-path",
-			b.flagPrefix,
-			b.flagPrefix,
-		)
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+		creds = credentials.NewTLS(tlsConfig)
+
+	case len(cfg.ACMEDomains) > 0:
+		configureACME(tlsConfig, newACMEManager(cfg.ACMEDomains, cfg.ACMECacheDir, cfg.ACMEDirectoryURL))
+		creds = credentials.NewTLS(tlsConfig)
+
+	case cfg.TLSSecret != "":
+		holder := &certificateHolder{}
+		namespace, name := parseKubernetesSecret(cfg.TLSSecret)
+		watcher, err := newKubernetesSecretWatcher(namespace, name, holder, b.logger)
+		if err != nil {
+			return nil, nil, err
+		}
+		resourceVersion, err := watcher.Load(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		go watcher.Watch(ctx, resourceVersion)
+
+		tlsConfig.GetCertificate = holder.GetCertificate
+		creds = credentials.NewTLS(tlsConfig)
+
+	case !cfg.Insecure():
+		holder := &certificateHolder{}
+		files := &certificateFiles{certPath: cfg.TLSCertPath, keyPath: cfg.TLSKeyPath, holder: holder, logger: b.logger}
+		if err := files.Load(); err != nil {
+			return nil, nil, err
+		}
+		if cfg.TLSReloadInterval > 0 {
+			go files.Watch(ctx, cfg.TLSReloadInterval)
+		}
+
+		tlsConfig.GetCertificate = holder.GetCertificate
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	if tp, ok := otelctx.TracerProvider(ctx); ok && cfg.TracingEnabled {
+		opts = append(opts, grpc.StatsHandler(otelgrpc.NewServerHandler(
+			otelgrpc.WithTracerProvider(tp),
+			otelgrpc.WithPropagators(otel.GetTextMapPropagator()),
+		)))
+	}
+
+	return opts, creds, nil
+}
+
+// register registers the services enabled by the flags and those provided by
+// WithServiceRegistrar.
+func (b *Builder) register(cfg Config, srv grpc.ServiceRegistrar) {
+	if cfg.HealthEnabled {
+		healthpb.RegisterHealthServer(srv, b.health)
+	}
+	if cfg.ChannelzEnabled {
+		channelz.RegisterChannelzServiceToServer(srv)
+	}
+	for _, register := range b.registrars {
+		register(srv)
+	}
+}
+
+// RunE returns a Cobra RunFunc that creates a server with
+// ServerFromFlagsWithModes, registers the services provided by
+// WithServiceRegistrar, and serves them with ListenFromFlags until the
+// command's context is canceled.
+//
+// Functions that need the running server, such as to report its address,
+// can be provided with WithOnServing. When the health service is enabled, the
+// status it reports can be changed with SetServing from those functions or
+// from request handlers.
+//
+// Because it blocks until then, it should be the last function when composed
+// with others using cobrautil.CommandStack, e.g. after those configuring
+// logging and tracing.
+//
+// This is a no-op if the server is not enabled, other than reporting flags of
+// the server that were set and are being ignored.
+//
+// The required flags can be added to a command by using RegisterFlags().
+func (b *Builder) RunE() cobrautil.CobraRunFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if cobrautil.IsBuiltinCommand(cmd) {
+			return nil // No-op for builtins
+		}
+
+		if !cobrautil.MustGetBool(cmd, b.prefix("enabled")) {
+			return b.checkIgnoredFlags(cmd)
+		}
+
+		srv, err := b.ServerFromFlagsWithModes(cmd)
+		if err != nil {
+			return err
+		}
+		l, err := b.ListenerFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		return b.ServeFromFlags(cmd, srv, l)
 	}
 }
 
+// Health returns the health service registered on servers created by
+// ServerFromFlags when "$PREFIX-health-enabled" is true.
+//
+// Every service reports that it is serving until the server is stopped by
+// ListenFromFlags, so that clients stop sending new requests while in-flight
+// requests are drained. Use SetServingStatus, or SetServing with the context
+// of a request or of a function provided by WithOnServing, to report the
+// status of individual services.
+func (b *Builder) Health() *health.Server {
+	return b.health
+}
+
 // ListenFromFlags listens on the provided gRPC server using values configured
 // in the provided command.
-func (b *Builder) ListenFromFlags(cmd *cobra.Command, srv *grpc.Server) error {
+//
+// When the command's context is canceled, the server is gracefully stopped
+// and ListenFromFlags returns once in-flight requests have completed or the
+// grace period configured by "$PREFIX-shutdown-grace-period" has elapsed,
+// after which they are canceled.
+//
+// If the server is disabled, ListenFromFlags returns immediately, warning
+// about any other flags of the server that were set and are being ignored.
+func (b *Builder) ListenFromFlags(cmd *cobra.Command, srv Server) error {
 	if !cobrautil.MustGetBool(cmd, b.prefix("enabled")) {
+		return b.checkIgnoredFlags(cmd)
+	}
+
+	l, err := b.ListenerFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	return b.ServeFromFlags(cmd, srv, l)
+}
+
+// checkIgnoredFlags reports the flags of the disabled server that were
+// explicitly set, which are likely to be a misconfiguration.
+func (b *Builder) checkIgnoredFlags(cmd *cobra.Command) error {
+	// Only the flags registered by this builder are considered, since other
+	// flags may share its prefix.
+	own := pflag.NewFlagSet(b.flagPrefix, pflag.ContinueOnError)
+	b.RegisterFlags(own)
+
+	var ignored []string
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if f.Name != b.prefix("enabled") && own.Lookup(f.Name) != nil {
+			ignored = append(ignored, "--"+f.Name)
+		}
+	})
+	if len(ignored) == 0 {
 		return nil
 	}
 
-	network := cobrautil.MustGetString(cmd, b.prefix("network"))
-	addr := cobrautil.MustGetStringExpanded(cmd, b.prefix("addr"))
+	if b.strictDisabled {
+		return fmt.Errorf("failed to start gRPC server: --%s is false but %s were set", b.prefix("enabled"), strings.Join(ignored, ", "))
+	}
+	b.logger.Info("grpc server is disabled; ignoring flags", "prefix", b.flagPrefix, "flags", ignored, "enable", "--"+b.prefix("enabled"))
+	return nil
+}
+
+// ListenerFromFlags creates a listener on the address configured by the
+// "$PREFIX-addr" flag without serving anything.
+//
+// Addresses with port 0 (e.g. "127.0.0.1:0") listen on an ephemeral port, so
+// tests can start the server configured by the flags and discover the port
+// with Addr().
+func (b *Builder) ListenerFromFlags(cmd *cobra.Command) (net.Listener, error) {
+	cfg, err := b.ConfigFromFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return b.listen(cfg, cfg.Addr)
+}
+
+func (b *Builder) listen(cfg Config, addr string) (net.Listener, error) {
+	unix := netutil.IsUnixNetwork(cfg.Network)
+	if unix {
+		if err := netutil.RemoveStaleSocket(cfg.Network, addr); err != nil {
+			return nil, err
+		}
+	}
+
+	// Sockets created by Listen are removed when the listener is closed.
+	l, err := net.Listen(cfg.Network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on addr for gRPC server: %w", err)
+	}
+
+	if unix {
+		if err := netutil.ChmodChownSocket(addr, cfg.SocketMode, cfg.SocketOwner); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	if cfg.AcceptRetry {
+		var retries prometheus.Counter
+		if b.metricsRegisterer != nil {
+			var err error
+			if retries, err = netutil.NewAcceptRetries(b.metricsRegisterer, "grpc", b.serviceName); err != nil {
+				b.logger.Error(err, "failed to register accept retry metrics; serving without them", "service", b.serviceName)
+			}
+		}
+		l = netutil.RetryListener(l, cfg.AcceptRetryMaxBackoff, b.logger, retries)
+	}
+	if cfg.StallCheckInterval > 0 {
+		var stalls prometheus.Counter
+		if b.metricsRegisterer != nil {
+			var err error
+			if stalls, err = netutil.NewStalls(b.metricsRegisterer, "grpc", b.serviceName); err != nil {
+				b.logger.Error(err, "failed to register stall metrics; serving without them", "service", b.serviceName)
+			}
+		}
+		l = netutil.StallListener(l, cfg.StallCheckInterval, cfg.StallAction == "stop", b.logger, stalls)
+	}
+	return l, nil
+}
 
-	l, err := net.Listen(network, addr)
+// ServeFromFlags serves the provided gRPC server on the provided listener,
+// typically created by ListenerFromFlags, and the address configured by the
+// "$PREFIX-legacy-addr" flag, stopping it like ListenFromFlags.
+//
+// The functions provided by WithOnServing are called once the server is
+// listening.
+func (b *Builder) ServeFromFlags(cmd *cobra.Command, srv Server, l net.Listener) error {
+	cfg, err := b.ConfigFromFlags(cmd)
 	if err != nil {
-		return fmt.Errorf("failed to listen on addr for gRPC server: %w", err)
+		l.Close()
+		return err
+	}
+
+	listeners := []net.Listener{l}
+	if cfg.LegacyAddr != "" {
+		legacy, err := b.listen(cfg, cfg.LegacyAddr)
+		if err != nil {
+			l.Close()
+			return err
+		}
+		listeners = append(listeners, netutil.LegacyListener(legacy, time.Minute, b.logger))
 	}
 
-	certPath := cobrautil.MustGetStringExpanded(cmd, b.prefix("tls-cert-path"))
-	keyPath := cobrautil.MustGetStringExpanded(cmd, b.prefix("tls-key-path"))
 	b.logger.V(b.preRunLevel).Info(
 		"grpc server started listening",
-		"addr", addr,
-		"network", network,
+		"addr", l.Addr().String(),
+		"legacyAddr", cfg.LegacyAddr,
+		"network", cfg.Network,
 		"prefix", b.flagPrefix,
-		"insecure", isInsecure(certPath, keyPath),
+		"insecure", cfg.Insecure(),
 	)
 
-	if err := srv.Serve(l); err != nil {
+	var stopOnce sync.Once
+	stop := func() { stopOnce.Do(func() { b.stop(srv, cfg.ShutdownGracePeriod) }) }
+	if b.flusher != nil {
+		b.flusher.RegisterDrain(b.serviceName+" gRPC server", func(ctx context.Context) error {
+			drained := make(chan struct{})
+			go func() {
+				defer close(drained)
+				stop()
+			}()
+
+			select {
+			case <-drained:
+				return nil
+			case <-ctx.Done():
+				srv.Stop()
+				return ctx.Err()
+			}
+		})
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	served := make(chan struct{})
+	stopped := make(chan struct{})
+
+	servingCtx := ContextWithServer(ctx, srv, l.Addr())
+	if cfg.HealthEnabled {
+		servingCtx = contextWithHealth(servingCtx, b.health)
+	}
+	servingCtx, cancel := context.WithCancel(servingCtx)
+	defer cancel()
+	for _, onServing := range b.onServing {
+		go onServing(servingCtx)
+	}
+
+	go func() {
+		defer close(stopped)
+		select {
+		case <-served:
+			return
+		case <-ctx.Done():
+		}
+		stop()
+	}()
+
+	err = netutil.ServeAll(srv.Serve, listeners...)
+	close(served)
+	<-stopped
+	if err != nil {
 		return fmt.Errorf("failed to serve gRPC: %w", err)
 	}
 
 	return nil
 }
 
+// stop gracefully stops the server, forcibly stopping it if in-flight
+// requests have yet to complete after the grace period.
+func (b *Builder) stop(srv Server, gracePeriod time.Duration) {
+	b.logger.V(b.preRunLevel).Info("grpc server gracefully stopping", "prefix", b.flagPrefix, "gracePeriod", gracePeriod)
+	b.health.Shutdown()
+
+	if gracePeriod > 0 {
+		timer := time.AfterFunc(gracePeriod, func() {
+			b.logger.Info("grpc server grace period elapsed; canceling in-flight requests", "prefix", b.flagPrefix)
+			srv.Stop()
+		})
+		defer timer.Stop()
+	}
+	srv.GracefulStop()
+}
+
+// clientAuthTypes maps the values of the "$PREFIX-client-auth" flag to the
+// corresponding policy.
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require-and-verify": tls.RequireAndVerifyClientCert,
+}
+
 func isInsecure(certPath, keyPath string) bool {
 	return certPath == "" && keyPath == ""
 }
@@ -151,6 +960,20 @@ func WithDefaultAddress(addr string) Option {
 	return func(b *Builder) { b.defaultAddr = addr }
 }
 
+// WithFlusher registers a drain with the provided Flusher for every server
+// served by ListenFromFlags, so that flushing at the end of the process first
+// gracefully stops the server and then flushes the telemetry of its final
+// requests.
+func WithFlusher(f *cobrautil.Flusher) Option {
+	return func(b *Builder) { b.flusher = f }
+}
+
+// WithStrictDisabledFlags configures ListenFromFlags to return an error rather
+// than log a warning when flags are set for a disabled server.
+func WithStrictDisabledFlags() Option {
+	return func(b *Builder) { b.strictDisabled = true }
+}
+
 // WithDefaultEnabled defines whether the server is enabled by default.
 //
 // Defaults to "false".
@@ -171,3 +994,102 @@ func WithFlagPrefix(flagPrefix string) Option {
 func WithPreRunLevel(preRunLevel int) Option {
 	return func(b *Builder) { b.preRunLevel = preRunLevel }
 }
+
+// WithServiceRegistrar adds a function that registers services on every server
+// created by ServerFromFlags or ServerFromFlagsWithModes, allowing the builder to manage the entire
+// lifecycle of the server with RunE.
+//
+// This can be provided more than once.
+func WithServiceRegistrar(register func(grpc.ServiceRegistrar)) Option {
+	return func(b *Builder) { b.registrars = append(b.registrars, register) }
+}
+
+// WithOnServing adds a function that is called in its own goroutine once a
+// server served by ServeFromFlags is listening, such as to report its address
+// or warm up before reporting that it is serving with SetServing.
+//
+// The context carries the values of the command's context, the server, and
+// the address it is listening on, which can be retrieved with
+// ServerFromContext and AddrFromContext, and the health service used by
+// SetServing when it is enabled. It is canceled along with the
+// command's context, or once the server has stopped.
+//
+// This can be provided more than once.
+func WithOnServing(onServing func(ctx context.Context)) Option {
+	return func(b *Builder) { b.onServing = append(b.onServing, onServing) }
+}
+
+// WithUnaryInterceptors adds interceptors to the unary RPCs of every server
+// created by ServerFromFlags. They run in the order provided, after the
+// interceptors of the builder described by ServerFromFlags and before any
+// interceptors passed to ServerFromFlags.
+//
+// This can be provided more than once.
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) Option {
+	return func(b *Builder) { b.unaryInterceptors = append(b.unaryInterceptors, interceptors...) }
+}
+
+// WithStreamInterceptors adds interceptors to the streaming RPCs of every
+// server created by ServerFromFlags. They run in the order provided, after
+// the interceptors of the builder described by ServerFromFlags and before any
+// interceptors passed to ServerFromFlags.
+//
+// This can be provided more than once.
+func WithStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) Option {
+	return func(b *Builder) { b.streamInterceptors = append(b.streamInterceptors, interceptors...) }
+}
+
+// WithAccessLogging logs every connection to servers created by
+// ServerFromFlags and every request they handle, with its method, peer,
+// status code, and duration, at the provided level of the logger configured
+// by WithLogger.
+//
+// Requests are logged before any other interceptors run, other than the one
+// recovering from panics, so those rejected by authentication or limits are
+// also logged.
+//
+// Disabled by default.
+func WithAccessLogging(level int) Option {
+	return func(b *Builder) {
+		b.accessLogging = true
+		b.accessLogLevel = level
+	}
+}
+
+// WithMetrics records the number of transient errors accepting connections
+// that were retried because of "$PREFIX-accept-retry" and of the failed checks
+// of "$PREFIX-stall-check-interval" in the provided registerer. If the
+// registerer is nil, prometheus.DefaultRegisterer is used.
+//
+// Disabled by default.
+func WithMetrics(registerer prometheus.Registerer) Option {
+	return func(b *Builder) {
+		b.metricsRegisterer = registerer
+		if registerer == nil {
+			b.metricsRegisterer = prometheus.DefaultRegisterer
+		}
+	}
+}
+
+// WithDefaultHealthEnabled defines whether the gRPC health service is
+// registered by default.
+//
+// Defaults to "false".
+func WithDefaultHealthEnabled(enabled bool) Option {
+	return func(b *Builder) { b.defaultHealthEnabled = enabled }
+}
+
+// WithKubernetesTLSSecret defines the default Kubernetes TLS secret that is
+// fetched through the in-cluster API and watched for the certificate used to
+// serve. This allows certificates issued by tools like cert-manager to be
+// used without mounting them as files.
+//
+// If empty, namespace defaults to the namespace of the running pod.
+func WithKubernetesTLSSecret(namespace, name string) Option {
+	return func(b *Builder) {
+		b.tlsSecret = name
+		if namespace != "" {
+			b.tlsSecret = namespace + "/" + name
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package cobragrpc
+
+import (
+	"context"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
+)
+
+// compressors are the values accepted by the compression flags of servers
+// and clients, which are all registered when this package is imported.
+var compressors = map[string]struct{}{
+	"none":    {},
+	gzip.Name: {},
+	zstdName:  {},
+}
+
+func init() {
+	encoding.RegisterCompressor(&zstdCompressor{})
+}
+
+const zstdName = "zstd"
+
+// zstdCompressor implements encoding.Compressor with pooled zstd encoders
+// and decoders, like the gzip compressor provided by gRPC.
+type zstdCompressor struct {
+	encoders sync.Pool
+	decoders sync.Pool
+}
+
+func (c *zstdCompressor) Name() string { return zstdName }
+
+func (c *zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	if enc, ok := c.encoders.Get().(*zstd.Encoder); ok {
+		enc.Reset(w)
+		return &zstdWriter{Encoder: enc, pool: &c.encoders}, nil
+	}
+
+	enc, err := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdWriter{Encoder: enc, pool: &c.encoders}, nil
+}
+
+func (c *zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	if dec, ok := c.decoders.Get().(*zstd.Decoder); ok {
+		if err := dec.Reset(r); err != nil {
+			c.decoders.Put(dec)
+			return nil, err
+		}
+		return &zstdReader{dec: dec, pool: &c.decoders}, nil
+	}
+
+	// A concurrency of 1 decodes synchronously without starting goroutines.
+	dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdReader{dec: dec, pool: &c.decoders}, nil
+}
+
+type zstdWriter struct {
+	*zstd.Encoder
+	pool *sync.Pool
+}
+
+func (w *zstdWriter) Close() error {
+	defer w.pool.Put(w.Encoder)
+	return w.Encoder.Close()
+}
+
+// zstdReader returns its decoder to the pool once the message has been read.
+type zstdReader struct {
+	dec  *zstd.Decoder
+	pool *sync.Pool
+}
+
+func (r *zstdReader) Read(p []byte) (int, error) {
+	if r.dec == nil {
+		return 0, io.EOF
+	}
+
+	n, err := r.dec.Read(p)
+	if err == io.EOF {
+		_ = r.dec.Reset(nil)
+		r.pool.Put(r.dec)
+		r.dec = nil
+	}
+	return n, err
+}
+
+// responseCompressor compresses the responses of a server with the named
+// compressor when clients advertise support for it.
+type responseCompressor string
+
+func (c responseCompressor) apply(ctx context.Context) {
+	if supported, err := grpc.ClientSupportedCompressors(ctx); err == nil && slices.Contains(supported, string(c)) {
+		_ = grpc.SetSendCompressor(ctx, string(c))
+	}
+}
+
+func (c responseCompressor) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	c.apply(ctx)
+	return handler(ctx, req)
+}
+
+func (c responseCompressor) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	c.apply(ss.Context())
+	return handler(srv, ss)
+}
@@ -0,0 +1,89 @@
+package cobragrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/stats"
+)
+
+type serverKey struct{}
+
+type serverValue struct {
+	srv  Server
+	addr net.Addr
+}
+
+// ContextWithServer returns a copy of the context carrying the provided
+// server and the address it is bound to.
+//
+// The contexts of requests to servers created by ServerFromFlags and of the
+// functions provided by WithOnServing carry their server.
+func ContextWithServer(ctx context.Context, srv Server, addr net.Addr) context.Context {
+	return context.WithValue(ctx, serverKey{}, serverValue{srv: srv, addr: addr})
+}
+
+// ServerFromContext returns the server carried by the context, if any.
+func ServerFromContext(ctx context.Context) (Server, bool) {
+	v, ok := ctx.Value(serverKey{}).(serverValue)
+	return v.srv, ok
+}
+
+// AddrFromContext returns the address of the server carried by the context,
+// if any, which includes the port chosen when listening on port 0.
+func AddrFromContext(ctx context.Context) (net.Addr, bool) {
+	v, ok := ctx.Value(serverKey{}).(serverValue)
+	return v.addr, ok
+}
+
+// serverContext is a stats.Handler that adds the server, the address of the
+// listener that accepted each connection, and the health service, if enabled,
+// to the contexts of its requests, like the BaseContext of an http.Server.
+type serverContext struct {
+	srv    Server
+	health *health.Server
+}
+
+func (sc *serverContext) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	ctx = ContextWithServer(ctx, sc.srv, info.LocalAddr)
+	if sc.health != nil {
+		ctx = contextWithHealth(ctx, sc.health)
+	}
+	return ctx
+}
+
+func (sc *serverContext) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (sc *serverContext) HandleConn(context.Context, stats.ConnStats) {}
+
+func (sc *serverContext) HandleRPC(context.Context, stats.RPCStats) {}
+
+type healthKey struct{}
+
+func contextWithHealth(ctx context.Context, h *health.Server) context.Context {
+	return context.WithValue(ctx, healthKey{}, h)
+}
+
+// SetServing reports the status of a service, or of the server as a whole if
+// service is empty, through the health service of the server carried by the
+// context, i.e. that of a request or of a function provided by WithOnServing.
+//
+// Once the server begins gracefully stopping, every service reports that it
+// is not serving and further changes are ignored, so that load balancers stop
+// sending new requests while in-flight requests are drained.
+//
+// An error is returned if the context does not carry a server with the health
+// service enabled.
+func SetServing(ctx context.Context, service string, status healthpb.HealthCheckResponse_ServingStatus) error {
+	h, ok := ctx.Value(healthKey{}).(*health.Server)
+	if !ok {
+		return errors.New("context does not carry a gRPC server with the health service enabled")
+	}
+	h.SetServingStatus(service, status)
+	return nil
+}
@@ -0,0 +1,187 @@
+package cobragrpc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/jzelinskie/cobrautil/v2/cobragrpc"
+	"github.com/jzelinskie/cobrautil/v2/cobragrpctest"
+)
+
+const contextMethod = "/test.Context/Handle"
+
+// contextService is a service that calls handle with the context of each
+// request.
+type contextService func(ctx context.Context) error
+
+func (handle contextService) register(s grpc.ServiceRegistrar) {
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "test.Context",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Handle",
+			Handler: func(_ any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				req := &emptypb.Empty{}
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, _ any) (any, error) {
+					return &emptypb.Empty{}, handle(ctx)
+				}
+				if interceptor == nil {
+					return handler(ctx, req)
+				}
+				return interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: contextMethod}, handler)
+			},
+		}},
+	}, handle)
+}
+
+func TestServerFromRequestContext(t *testing.T) {
+	var (
+		srv     cobragrpc.Server
+		hasSrv  bool
+		hasAddr bool
+	)
+	handle := contextService(func(ctx context.Context) error {
+		srv, hasSrv = cobragrpc.ServerFromContext(ctx)
+		_, hasAddr = cobragrpc.AddrFromContext(ctx)
+		return nil
+	})
+	s := cobragrpctest.NewServer(t, cobragrpc.New("myservice", cobragrpc.WithServiceRegistrar(handle.register)))
+
+	if err := s.Conn.Invoke(context.Background(), contextMethod, &emptypb.Empty{}, &emptypb.Empty{}); err != nil {
+		t.Fatal(err)
+	}
+	if !hasSrv || srv != cobragrpc.Server(s.Server) {
+		t.Errorf("expected the context of the request to carry the server, got %v", srv)
+	}
+	if !hasAddr {
+		t.Errorf("expected the context of the request to carry the address")
+	}
+}
+
+func TestOnServing(t *testing.T) {
+	serving := make(chan context.Context, 1)
+	b := cobragrpc.New("myservice", cobragrpc.WithOnServing(func(ctx context.Context) { serving <- ctx }))
+	cmd := &cobra.Command{Use: "test", RunE: b.RunE()}
+	b.RegisterFlags(cmd.Flags())
+	cmd.SetArgs([]string{"--grpc-enabled", "--grpc-addr=127.0.0.1:0", "--grpc-health-enabled"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- cmd.ExecuteContext(ctx) }()
+
+	var servingCtx context.Context
+	select {
+	case servingCtx = <-serving:
+	case err := <-done:
+		t.Fatalf("expected the server to be serving, got %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the server to be serving")
+	}
+
+	if srv, ok := cobragrpc.ServerFromContext(servingCtx); !ok || srv == nil {
+		t.Fatalf("expected the context to carry the server")
+	}
+	addr, ok := cobragrpc.AddrFromContext(servingCtx)
+	if !ok {
+		t.Fatalf("expected the context to carry the address")
+	}
+
+	conn, err := grpc.Dial(addr.String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("expected the server to be serving on %s, got %v", addr, err)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if servingCtx.Err() == nil {
+		t.Fatal("expected the context to be canceled once the server stopped")
+	}
+}
+
+func TestSetServingWhileServing(t *testing.T) {
+	handle := contextService(func(ctx context.Context) error {
+		return cobragrpc.SetServing(ctx, "myservice", healthpb.HealthCheckResponse_NOT_SERVING)
+	})
+	serving := make(chan string, 1)
+	b := cobragrpc.New("myservice",
+		cobragrpc.WithServiceRegistrar(handle.register),
+		cobragrpc.WithOnServing(func(ctx context.Context) {
+			if err := cobragrpc.SetServing(ctx, "myservice", healthpb.HealthCheckResponse_SERVING); err != nil {
+				t.Error(err)
+			}
+			addr, _ := cobragrpc.AddrFromContext(ctx)
+			serving <- addr.String()
+		}),
+	)
+	cmd := &cobra.Command{Use: "test", RunE: b.RunE()}
+	b.RegisterFlags(cmd.Flags())
+	cmd.SetArgs([]string{"--grpc-enabled", "--grpc-addr=127.0.0.1:0", "--grpc-health-enabled"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- cmd.ExecuteContext(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	var addr string
+	select {
+	case addr = <-serving:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the server to be serving")
+	}
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	status := func() healthpb.HealthCheckResponse_ServingStatus {
+		t.Helper()
+		resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{Service: "myservice"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Status
+	}
+
+	// The function provided by WithOnServing reported the service as serving
+	// once the server was listening.
+	if got := status(); got != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expected the service to be reported as serving, got %v", got)
+	}
+
+	// A request handler reports that the service is no longer serving.
+	if err := conn.Invoke(context.Background(), contextMethod, &emptypb.Empty{}, &emptypb.Empty{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("expected the service to be reported as not serving, got %v", got)
+	}
+}
+
+func TestSetServingWithoutHealth(t *testing.T) {
+	if err := cobragrpc.SetServing(context.Background(), "myservice", healthpb.HealthCheckResponse_SERVING); err == nil {
+		t.Fatal("expected an error without a server with the health service enabled")
+	}
+}
@@ -0,0 +1,122 @@
+package cobragrpc_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+
+	"github.com/jzelinskie/cobrautil/v2"
+	"github.com/jzelinskie/cobrautil/v2/cobragrpc"
+	"github.com/jzelinskie/cobrautil/v2/cobraotel"
+	"github.com/jzelinskie/cobrautil/v2/cobrazerolog"
+)
+
+func ExampleBuilder_ConfigFromFlags() {
+	grpcb := cobragrpc.New("myservice")
+
+	cmd := &cobra.Command{Use: "mycmd"}
+	grpcb.RegisterFlags(cmd.Flags())
+	_ = cmd.Flags().Parse([]string{"--grpc-addr", ":9000"})
+
+	cfg, err := grpcb.ConfigFromFlags(cmd)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(cfg.Addr, cfg.Insecure())
+	// Output: :9000 true
+}
+
+func ExampleWithServiceRegistrar() {
+	grpcb := cobragrpc.New("myservice",
+		cobragrpc.WithDefaultEnabled(true),
+		cobragrpc.WithServiceRegistrar(func(srv grpc.ServiceRegistrar) {
+			// e.g. mypb.RegisterMyServiceServer(srv, &myServer{})
+		}),
+	)
+
+	cmd := &cobra.Command{
+		Use:  "serve",
+		RunE: grpcb.RunE(),
+	}
+	grpcb.RegisterFlags(cmd.Flags())
+}
+
+func ExampleBuilder_RunE() {
+	zl := cobrazerolog.New()
+	otel := cobraotel.New("myservice")
+	grpcb := cobragrpc.New("myservice", cobragrpc.WithDefaultEnabled(true))
+
+	cmd := &cobra.Command{
+		Use: "serve",
+		// The server blocks until the command's context is canceled, so it
+		// runs last.
+		RunE: cobrautil.CommandStack(
+			zl.RunE(),
+			otel.RunE(),
+			grpcb.RunE(),
+		),
+	}
+	zl.RegisterFlags(cmd.Flags())
+	otel.RegisterFlags(cmd.Flags())
+	grpcb.RegisterFlags(cmd.Flags())
+}
+
+func ExampleWithUnaryInterceptors() {
+	logging := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		fmt.Println("handling", info.FullMethod)
+		return handler(ctx, req)
+	}
+
+	grpcb := cobragrpc.New("myservice",
+		// Runs before any interceptors passed to ServerFromFlags.
+		cobragrpc.WithUnaryInterceptors(logging),
+	)
+
+	cmd := &cobra.Command{Use: "serve"}
+	grpcb.RegisterFlags(cmd.Flags())
+}
+
+func ExampleClientBuilder_DialFromFlags() {
+	client := cobragrpc.NewClient("myservice", cobragrpc.WithDefaultEndpoint("localhost:50051"))
+
+	cmd := &cobra.Command{
+		Use: "mycmd",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conn, err := client.DialFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			// e.g. mypb.NewMyServiceClient(conn)
+			fmt.Println(conn.Target())
+			return nil
+		},
+	}
+	client.RegisterFlags(cmd.Flags())
+	cmd.SetArgs([]string{"--myservice-insecure"})
+	_ = cmd.Execute()
+	// Output: localhost:50051
+}
+
+func ExampleBuilder_ListenerFromFlags() {
+	grpcb := cobragrpc.New("myservice")
+
+	cmd := &cobra.Command{Use: "mycmd"}
+	grpcb.RegisterFlags(cmd.Flags())
+	_ = cmd.Flags().Parse([]string{"--grpc-addr", "127.0.0.1:0"})
+
+	l, err := grpcb.ListenerFromFlags(cmd)
+	if err != nil {
+		panic(err)
+	}
+	defer l.Close()
+
+	// The ephemeral port that was bound, e.g. for a client in a test.
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	fmt.Println(port != "0")
+	// Output: true
+}
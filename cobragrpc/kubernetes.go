@@ -0,0 +1,228 @@
+package cobragrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// serviceAccountDir is where Kubernetes mounts the credentials of a pod's
+// service account.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubernetesSecretWatcher loads a TLS certificate from a Kubernetes Secret
+// using the in-cluster API and keeps it up to date by watching for changes.
+//
+// This intentionally avoids depending on client-go by speaking to the small
+// subset of the Kubernetes API that is required directly.
+type kubernetesSecretWatcher struct {
+	client    *http.Client
+	apiHost   string
+	tokenPath string
+	namespace string
+	name      string
+	holder    *certificateHolder
+	logger    logr.Logger
+
+	// retryInterval is how long to wait before watching again after a
+	// watch fails.
+	retryInterval time.Duration
+}
+
+// parseKubernetesSecret splits a reference to a Secret of the form
+// "namespace/name" or "name".
+func parseKubernetesSecret(ref string) (namespace, name string) {
+	if namespace, name, ok := strings.Cut(ref, "/"); ok {
+		return namespace, name
+	}
+	return "", ref
+}
+
+func newKubernetesSecretWatcher(namespace, name string, holder *certificateHolder, logger logr.Logger) (*kubernetesSecretWatcher, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("failed to find the Kubernetes API: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be set")
+	}
+
+	caPEM, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Kubernetes CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("failed to parse Kubernetes CA")
+	}
+
+	if namespace == "" {
+		ns, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Kubernetes namespace: %w", err)
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+
+	return &kubernetesSecretWatcher{
+		client: &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+		}},
+		apiHost:       net.JoinHostPort(host, port),
+		tokenPath:     filepath.Join(serviceAccountDir, "token"),
+		namespace:     namespace,
+		name:          name,
+		holder:        holder,
+		logger:        logger,
+		retryInterval: 5 * time.Second,
+	}, nil
+}
+
+type kubernetesSecret struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Data map[string][]byte `json:"data"`
+}
+
+type kubernetesWatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+func (w *kubernetesSecretWatcher) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	// Service account tokens are rotated, so they are read for every request.
+	token, err := os.ReadFile(w.tokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Kubernetes service account token: %w", err)
+	}
+
+	u := url.URL{
+		Scheme:   "https",
+		Host:     w.apiHost,
+		Path:     "/api/v1/namespaces/" + url.PathEscape(w.namespace) + "/secrets" + path,
+		RawQuery: query.Encode(),
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("unexpected response from Kubernetes API (%s): %s", resp.Status, body)
+	}
+	return resp, nil
+}
+
+// Load fetches the current Secret and stores its certificate, returning the
+// resourceVersion that was loaded.
+func (w *kubernetesSecretWatcher) Load(ctx context.Context) (string, error) {
+	resp, err := w.get(ctx, "/"+url.PathEscape(w.name), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to get TLS secret %s/%s: %w", w.namespace, w.name, err)
+	}
+	defer resp.Body.Close()
+
+	var secret kubernetesSecret
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("failed to decode TLS secret %s/%s: %w", w.namespace, w.name, err)
+	}
+	return secret.Metadata.ResourceVersion, w.store(secret)
+}
+
+func (w *kubernetesSecretWatcher) store(secret kubernetesSecret) error {
+	cert, err := tls.X509KeyPair(secret.Data["tls.crt"], secret.Data["tls.key"])
+	if err != nil {
+		return fmt.Errorf("failed to parse TLS secret %s/%s: %w", w.namespace, w.name, err)
+	}
+	w.holder.Store(&cert)
+	return nil
+}
+
+// Watch updates the stored certificate whenever the Secret changes until the
+// provided context is canceled.
+func (w *kubernetesSecretWatcher) Watch(ctx context.Context, resourceVersion string) {
+	for {
+		var err error
+		resourceVersion, err = w.watchOnce(ctx, resourceVersion)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			w.logger.Error(err, "failed to watch TLS secret", "namespace", w.namespace, "name", w.name)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(w.retryInterval):
+			}
+
+			// The watch may have failed because the resourceVersion is too
+			// old, so start over from the latest version.
+			if rv, err := w.Load(ctx); err == nil {
+				resourceVersion = rv
+			}
+		}
+	}
+}
+
+func (w *kubernetesSecretWatcher) watchOnce(ctx context.Context, resourceVersion string) (string, error) {
+	resp, err := w.get(ctx, "", url.Values{
+		"watch":           {"true"},
+		"fieldSelector":   {"metadata.name=" + w.name},
+		"resourceVersion": {resourceVersion},
+		"timeoutSeconds":  {"300"},
+	})
+	if err != nil {
+		return resourceVersion, err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var event kubernetesWatchEvent
+		if err := dec.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				return resourceVersion, nil // The server ended the watch.
+			}
+			return resourceVersion, err
+		}
+
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			var secret kubernetesSecret
+			if err := json.Unmarshal(event.Object, &secret); err != nil {
+				return resourceVersion, fmt.Errorf("failed to decode TLS secret %s/%s: %w", w.namespace, w.name, err)
+			}
+			resourceVersion = secret.Metadata.ResourceVersion
+			if err := w.store(secret); err != nil {
+				w.logger.Error(err, "ignoring invalid TLS secret update")
+				continue
+			}
+			w.logger.V(1).Info("reloaded TLS certificate from secret", "namespace", w.namespace, "name", w.name)
+		case "DELETED":
+			w.logger.Info("TLS secret was deleted; continuing to serve the last certificate", "namespace", w.namespace, "name", w.name)
+		case "ERROR":
+			return resourceVersion, fmt.Errorf("watch of TLS secret %s/%s failed: %s", w.namespace, w.name, event.Object)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package cobragrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// goneEvent is the event sent by the Kubernetes API when a watch starts from
+// a resourceVersion that has been compacted.
+var goneEvent = watchEvent("ERROR", json.RawMessage(`{"kind":"Status","apiVersion":"v1","status":"Failure","message":"too old resource version: 1 (5)","reason":"Expired","code":410}`))
+
+// newTestSecret creates a TLS secret containing the certificate of an SVID.
+func newTestSecret(svid testSVID, resourceVersion string) kubernetesSecret {
+	var secret kubernetesSecret
+	secret.Metadata.ResourceVersion = resourceVersion
+	secret.Data = map[string][]byte{
+		"tls.crt": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: svid.certDER}),
+		"tls.key": pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: svid.keyDER}),
+	}
+	return secret
+}
+
+func watchEvent(eventType string, object any) kubernetesWatchEvent {
+	raw, err := json.Marshal(object)
+	if err != nil {
+		panic(err)
+	}
+	return kubernetesWatchEvent{Type: eventType, Object: raw}
+}
+
+// watchScript is the response of the fake Kubernetes API to a watch.
+type watchScript struct {
+	events []kubernetesWatchEvent
+
+	// hold keeps the watch open after the events are sent rather than ending
+	// it.
+	hold bool
+}
+
+// fakeKubernetesAPI serves the "default/tls" Secret and watches of it.
+type fakeKubernetesAPI struct {
+	t       *testing.T
+	secret  kubernetesSecret
+	watches map[string]watchScript
+
+	mu      sync.Mutex
+	watched []string
+}
+
+func (api *fakeKubernetesAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if auth := r.Header.Get("Authorization"); auth != "Bearer token" {
+		api.t.Errorf("unexpected authorization %q", auth)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/api/v1/namespaces/default/secrets/tls":
+		_ = json.NewEncoder(w).Encode(api.secret)
+
+	case "/api/v1/namespaces/default/secrets":
+		query := r.URL.Query()
+		if query.Get("watch") != "true" || query.Get("fieldSelector") != "metadata.name=tls" {
+			api.t.Errorf("unexpected watch query %s", r.URL.RawQuery)
+		}
+		rv := query.Get("resourceVersion")
+		api.mu.Lock()
+		api.watched = append(api.watched, rv)
+		api.mu.Unlock()
+
+		script, ok := api.watches[rv]
+		if !ok {
+			http.Error(w, "unexpected resourceVersion "+rv, http.StatusInternalServerError)
+			return
+		}
+		enc := json.NewEncoder(w)
+		for _, event := range script.events {
+			_ = enc.Encode(event)
+		}
+		w.(http.Flusher).Flush()
+		if script.hold {
+			<-r.Context().Done()
+		}
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (api *fakeKubernetesAPI) Watched() []string {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return append([]string(nil), api.watched...)
+}
+
+// newTestSecretWatcher creates a watcher of the "default/tls" Secret that is
+// served by api.
+func newTestSecretWatcher(t *testing.T, api *fakeKubernetesAPI) *kubernetesSecretWatcher {
+	t.Helper()
+
+	api.t = t
+	srv := httptest.NewTLSServer(api)
+	t.Cleanup(srv.Close)
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return &kubernetesSecretWatcher{
+		client:        srv.Client(),
+		apiHost:       srv.Listener.Addr().String(),
+		tokenPath:     tokenPath,
+		namespace:     "default",
+		name:          "tls",
+		holder:        &certificateHolder{},
+		logger:        logr.Discard(),
+		retryInterval: time.Millisecond,
+	}
+}
+
+func storedCertificate(h *certificateHolder) []byte {
+	if cert := h.cert.Load(); cert != nil {
+		return cert.Certificate[0]
+	}
+	return nil
+}
+
+func TestKubernetesSecretWatchOnce(t *testing.T) {
+	_, svids := newTestSVIDs(t, "spiffe://example.org/first", "spiffe://example.org/second")
+	first, second := newTestSecret(svids[0], "2"), newTestSecret(svids[1], "3")
+	invalid := newTestSecret(testSVID{certDER: svids[0].certDER, keyDER: svids[1].keyDER}, "4")
+
+	for _, tt := range []struct {
+		name     string
+		events   []kubernetesWatchEvent
+		expected string
+		cert     []byte
+		err      string
+	}{
+		{
+			name:     "added",
+			events:   []kubernetesWatchEvent{watchEvent("ADDED", first)},
+			expected: "2",
+			cert:     svids[0].certDER,
+		},
+		{
+			name:     "modified",
+			events:   []kubernetesWatchEvent{watchEvent("ADDED", first), watchEvent("MODIFIED", second)},
+			expected: "3",
+			cert:     svids[1].certDER,
+		},
+		{
+			name:     "invalid secret is ignored",
+			events:   []kubernetesWatchEvent{watchEvent("MODIFIED", second), watchEvent("MODIFIED", invalid)},
+			expected: "4",
+			cert:     svids[1].certDER,
+		},
+		{
+			name:     "deleted",
+			events:   []kubernetesWatchEvent{watchEvent("MODIFIED", second), watchEvent("DELETED", second)},
+			expected: "3",
+			cert:     svids[1].certDER,
+		},
+		{
+			name:     "gone",
+			events:   []kubernetesWatchEvent{watchEvent("MODIFIED", second), goneEvent},
+			expected: "3",
+			cert:     svids[1].certDER,
+			err:      `"code":410`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeKubernetesAPI{watches: map[string]watchScript{"1": {events: tt.events}}}
+			w := newTestSecretWatcher(t, api)
+
+			rv, err := w.watchOnce(context.Background(), "1")
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatal(err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("expected an error containing %q, got %v", tt.err, err)
+			}
+			if rv != tt.expected {
+				t.Errorf("expected resourceVersion %q, got %q", tt.expected, rv)
+			}
+			if !bytes.Equal(storedCertificate(w.holder), tt.cert) {
+				t.Errorf("unexpected certificate stored")
+			}
+		})
+	}
+}
+
+func TestKubernetesSecretWatchRelistsWhenGone(t *testing.T) {
+	_, svids := newTestSVIDs(t, "spiffe://example.org/initial", "spiffe://example.org/listed", "spiffe://example.org/watched")
+	api := &fakeKubernetesAPI{
+		secret: newTestSecret(svids[1], "10"),
+		watches: map[string]watchScript{
+			"1":  {events: []kubernetesWatchEvent{goneEvent}},
+			"10": {events: []kubernetesWatchEvent{watchEvent("MODIFIED", newTestSecret(svids[2], "11"))}, hold: true},
+		},
+	}
+	w := newTestSecretWatcher(t, api)
+	if err := w.store(newTestSecret(svids[0], "1")); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Watch(ctx, "1")
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !bytes.Equal(storedCertificate(w.holder), svids[2].certDER) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the watched certificate to be stored, watched %q", api.Watched())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+	if watched := api.Watched(); len(watched) != 2 || watched[0] != "1" || watched[1] != "10" {
+		t.Fatalf("expected to watch again from the listed resourceVersion, watched %q", watched)
+	}
+}
@@ -0,0 +1,74 @@
+package cobragrpc
+
+import (
+	"context"
+	"math"
+	"strings"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// requestLimiter rejects requests beyond a rate, using a token bucket, or
+// beyond a number of concurrent requests.
+//
+// Health checks are exempt so that an overloaded server is not also
+// considered unhealthy.
+type requestLimiter struct {
+	rate     *rate.Limiter
+	inflight chan struct{}
+}
+
+// newRequestLimiter creates a limiter, treating limits that are not positive
+// as unlimited. The burst of the token bucket is one second of requests.
+func newRequestLimiter(maxConcurrent int, rps float64) *requestLimiter {
+	l := &requestLimiter{}
+	if maxConcurrent > 0 {
+		l.inflight = make(chan struct{}, maxConcurrent)
+	}
+	if rps > 0 {
+		l.rate = rate.NewLimiter(rate.Limit(rps), int(math.Max(1, math.Ceil(rps))))
+	}
+	return l
+}
+
+// acquire returns a function releasing the request once it is complete.
+func (l *requestLimiter) acquire(method string) (release func(), err error) {
+	if strings.HasPrefix(method, healthServicePrefix) {
+		return func() {}, nil
+	}
+
+	if l.rate != nil && !l.rate.Allow() {
+		return nil, status.Error(codes.ResourceExhausted, "request rate limit exceeded")
+	}
+
+	if l.inflight == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.inflight <- struct{}{}:
+		return func() { <-l.inflight }, nil
+	default:
+		return nil, status.Error(codes.ResourceExhausted, "concurrent request limit exceeded")
+	}
+}
+
+func (l *requestLimiter) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	release, err := l.acquire(info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return handler(ctx, req)
+}
+
+func (l *requestLimiter) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	release, err := l.acquire(info.FullMethod)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return handler(srv, ss)
+}
@@ -0,0 +1,111 @@
+package cobragrpc_test
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/jzelinskie/cobrautil/v2/cobragrpc"
+	"github.com/jzelinskie/cobrautil/v2/cobragrpctest"
+)
+
+const blockMethod = "/test.Blocker/Block"
+
+// blocker is a service whose requests are handled once they are released.
+type blocker struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newBlocker() *blocker {
+	return &blocker{entered: make(chan struct{}, 8), release: make(chan struct{})}
+}
+
+func (b *blocker) register(s grpc.ServiceRegistrar) {
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "test.Blocker",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Block",
+			Handler: func(_ any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				if err := dec(&emptypb.Empty{}); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, _ any) (any, error) {
+					b.entered <- struct{}{}
+					select {
+					case <-b.release:
+					case <-ctx.Done():
+						return nil, ctx.Err()
+					}
+					return &emptypb.Empty{}, nil
+				}
+				if interceptor == nil {
+					return handler(ctx, nil)
+				}
+				return interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: blockMethod}, handler)
+			},
+		}},
+	}, b)
+}
+
+func block(conn *grpc.ClientConn) error {
+	return conn.Invoke(context.Background(), blockMethod, &emptypb.Empty{}, &emptypb.Empty{})
+}
+
+func TestMaxConcurrentRPCs(t *testing.T) {
+	b := newBlocker()
+	s := cobragrpctest.NewServer(t, cobragrpc.New("myservice", cobragrpc.WithServiceRegistrar(b.register)),
+		"--grpc-health-enabled",
+		"--grpc-max-concurrent-rpcs=1",
+	)
+
+	first := make(chan error, 1)
+	go func() { first <- block(s.Conn) }()
+	<-b.entered
+
+	if err := block(s.Conn); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected a concurrent request to be rejected, got %v", err)
+	}
+	if _, err := healthpb.NewHealthClient(s.Conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("expected health checks to be exempt from the limit, got %v", err)
+	}
+
+	b.release <- struct{}{}
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+
+	// The slot is released once the handler returns.
+	second := make(chan error, 1)
+	go func() { second <- block(s.Conn) }()
+	<-b.entered
+	b.release <- struct{}{}
+	if err := <-second; err != nil {
+		t.Fatalf("expected the request to be accepted once the first completed, got %v", err)
+	}
+}
+
+func TestRPSLimit(t *testing.T) {
+	b := newBlocker()
+	close(b.release)
+	s := cobragrpctest.NewServer(t, cobragrpc.New("myservice", cobragrpc.WithServiceRegistrar(b.register)),
+		"--grpc-health-enabled",
+		"--grpc-rps-limit=1",
+	)
+
+	if err := block(s.Conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := block(s.Conn); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected a request beyond the rate to be rejected, got %v", err)
+	}
+	if _, err := healthpb.NewHealthClient(s.Conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("expected health checks to be exempt from the limit, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package cobragrpc
+
+import (
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Server is a gRPC server that can be served by ServeFromFlags, such as a
+// *grpc.Server or a server created by a mode provided by WithServerMode.
+type Server interface {
+	grpc.ServiceRegistrar
+	Serve(l net.Listener) error
+	Stop()
+	GracefulStop()
+}
+
+var _ Server = (*grpc.Server)(nil)
+
+// ServerFactory creates a server with the provided options.
+//
+// The credentials configured by the TLS flags are provided separately from
+// the options, so that they can be wrapped, and are nil if the server is
+// configured to serve plaintext.
+type ServerFactory func(creds credentials.TransportCredentials, opts ...grpc.ServerOption) (Server, error)
+
+type serverMode struct {
+	name      string
+	usage     string
+	newServer ServerFactory
+}
+
+// WithServerMode adds an alternative server, such as one whose configuration
+// is provided by a service mesh, that is created by ServerFromFlagsWithModes
+// and RunE instead of a *grpc.Server when the "$PREFIX-<name>-enabled" flag is
+// true.
+//
+// This can be provided more than once, though at most one mode can be enabled.
+func WithServerMode(name, usage string, newServer ServerFactory) Option {
+	return func(b *Builder) {
+		b.modes = append(b.modes, serverMode{name: name, usage: usage, newServer: newServer})
+	}
+}
+
+// mode returns the server mode enabled by the configuration, if any.
+func (b *Builder) mode(cfg Config) (serverMode, bool) {
+	for _, m := range b.modes {
+		if m.name == cfg.ServerMode {
+			return m, cfg.ServerMode != ""
+		}
+	}
+	return serverMode{}, false
+}
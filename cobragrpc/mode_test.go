@@ -0,0 +1,114 @@
+package cobragrpc_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/jzelinskie/cobrautil/v2/cobragrpc"
+)
+
+// meshServer is the server of a fake mode provided by WithServerMode.
+type meshServer struct {
+	*grpc.Server
+	creds credentials.TransportCredentials
+}
+
+func newMeshServer(creds credentials.TransportCredentials, opts ...grpc.ServerOption) (cobragrpc.Server, error) {
+	return &meshServer{Server: grpc.NewServer(opts...), creds: creds}, nil
+}
+
+func modeCommand(t *testing.T, b *cobragrpc.Builder, args ...string) *cobra.Command {
+	t.Helper()
+
+	cmd := &cobra.Command{Use: "test"}
+	b.RegisterFlags(cmd.Flags())
+	if err := cmd.ParseFlags(args); err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+func TestServerMode(t *testing.T) {
+	b := cobragrpc.New("myservice", cobragrpc.WithServerMode("mesh", "serve in the mesh", newMeshServer))
+	cmd := modeCommand(t, b, "--grpc-mesh-enabled", "--grpc-health-enabled")
+
+	cfg, err := b.ConfigFromFlags(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ServerMode != "mesh" {
+		t.Fatalf("expected the mesh mode, got %q", cfg.ServerMode)
+	}
+
+	srv, err := b.ServerFromFlagsWithModes(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mesh, ok := srv.(*meshServer)
+	if !ok {
+		t.Fatalf("expected the server of the mode, got %T", srv)
+	}
+	if mesh.creds != nil {
+		t.Errorf("expected no credentials when serving plaintext, got %v", mesh.creds)
+	}
+	if _, ok := mesh.GetServiceInfo()[healthpb.Health_ServiceDesc.ServiceName]; !ok {
+		t.Errorf("expected the health service to be registered on the server of the mode")
+	}
+
+	if _, err := b.ServerFromFlags(cmd); err == nil || !strings.Contains(err.Error(), "--grpc-mesh-enabled requires ServerFromFlagsWithModes") {
+		t.Fatalf("expected ServerFromFlags to reject the mode, got %v", err)
+	}
+}
+
+func TestServerModeDisabled(t *testing.T) {
+	b := cobragrpc.New("myservice", cobragrpc.WithServerMode("mesh", "serve in the mesh", newMeshServer))
+	cmd := modeCommand(t, b)
+
+	srv, err := b.ServerFromFlagsWithModes(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := srv.(*grpc.Server); !ok {
+		t.Fatalf("expected a *grpc.Server, got %T", srv)
+	}
+}
+
+func TestServerModeErrors(t *testing.T) {
+	failing := func(credentials.TransportCredentials, ...grpc.ServerOption) (cobragrpc.Server, error) {
+		return nil, errors.New("no control plane")
+	}
+	b := cobragrpc.New("myservice",
+		cobragrpc.WithServerMode("mesh", "serve in the mesh", newMeshServer),
+		cobragrpc.WithServerMode("failing", "fail to serve", failing),
+	)
+
+	for _, tt := range []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "several modes",
+			args:     []string{"--grpc-mesh-enabled", "--grpc-failing-enabled"},
+			expected: "failed to start gRPC server: --grpc-failing-enabled cannot be combined with --grpc-mesh-enabled",
+		},
+		{
+			name:     "mode fails",
+			args:     []string{"--grpc-failing-enabled"},
+			expected: "failed to create gRPC server with --grpc-failing-enabled: no control plane",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := b.ServerFromFlagsWithModes(modeCommand(t, b, tt.args...))
+			if err == nil || err.Error() != tt.expected {
+				t.Fatalf("expected error %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
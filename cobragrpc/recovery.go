@@ -0,0 +1,37 @@
+package cobragrpc
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// panicRecoverer rejects requests whose handlers panic with INTERNAL rather
+// than crashing the server, logging the panic along with its stack trace.
+type panicRecoverer struct {
+	logger logr.Logger
+}
+
+func (r panicRecoverer) recover(method string, err *error) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	r.logger.Error(fmt.Errorf("panic: %v", p), "recovered from panic handling gRPC request", "method", method, "stack", string(debug.Stack()))
+	*err = status.Error(codes.Internal, "internal error")
+}
+
+func (r panicRecoverer) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer r.recover(info.FullMethod, &err)
+	return handler(ctx, req)
+}
+
+func (r panicRecoverer) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer r.recover(info.FullMethod, &err)
+	return handler(srv, ss)
+}
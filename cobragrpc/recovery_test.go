@@ -0,0 +1,29 @@
+package cobragrpc_test
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/jzelinskie/cobrautil/v2/cobragrpc"
+	"github.com/jzelinskie/cobrautil/v2/cobragrpctest"
+)
+
+func TestPanicRecovery(t *testing.T) {
+	handle := contextService(func(context.Context) error { panic("boom") })
+	s := cobragrpctest.NewServer(t, cobragrpc.New("myservice",
+		cobragrpc.WithServiceRegistrar(handle.register),
+		cobragrpc.WithAccessLogging(0),
+	))
+
+	// The server keeps serving after each panic.
+	for i := 0; i < 2; i++ {
+		err := s.Conn.Invoke(context.Background(), contextMethod, &emptypb.Empty{}, &emptypb.Empty{})
+		if code := status.Code(err); code != codes.Internal {
+			t.Fatalf("expected %v, got %v", codes.Internal, err)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package cobragrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// spiffeScheme is the scheme of the URIs of SPIFFE IDs.
+const spiffeScheme = "spiffe://"
+
+// spiffeSource fetches an X.509 SVID and trust bundle from the SPIFFE
+// Workload API and keeps them up to date as they are rotated.
+//
+// This intentionally avoids depending on go-spiffe by speaking to the single
+// streaming method of the Workload API that is required directly.
+//
+// See https://github.com/spiffe/spiffe/blob/main/standards/SPIFFE_Workload_API.md
+type spiffeSource struct {
+	conn   *grpc.ClientConn
+	holder *certificateHolder
+	bundle atomic.Pointer[x509.CertPool]
+	logger logr.Logger
+}
+
+// newSpiffeSource connects to the Workload API at the provided socket, which
+// is either a path or a "unix://" URI like SPIFFE_ENDPOINT_SOCKET.
+func newSpiffeSource(socket string, holder *certificateHolder, logger logr.Logger) (*spiffeSource, error) {
+	target := socket
+	if !strings.HasPrefix(target, "unix:") {
+		target = "unix://" + target
+	}
+
+	conn, err := grpc.Dial(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SPIFFE Workload API: %w", err)
+	}
+	return &spiffeSource{conn: conn, holder: holder, logger: logger}, nil
+}
+
+// Start waits for the first SVID to be stored and then keeps it up to date
+// until the provided context is canceled.
+func (s *spiffeSource) Start(ctx context.Context) error {
+	stream, err := s.fetch(ctx)
+	if err == nil {
+		err = s.recv(stream)
+	}
+	if err != nil {
+		_ = s.conn.Close()
+		return fmt.Errorf("failed to fetch SPIFFE SVID: %w", err)
+	}
+
+	go s.watch(ctx, stream)
+	return nil
+}
+
+func (s *spiffeSource) fetch(ctx context.Context) (grpc.ClientStream, error) {
+	// The Workload API requires this header to prevent SSRF attacks.
+	ctx = metadata.AppendToOutgoingContext(ctx, "workload.spiffe.io", "true")
+
+	stream, err := s.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, "/SpiffeWorkloadAPI/FetchX509SVID", grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		return nil, err
+	}
+	empty := []byte{}
+	if err := stream.SendMsg(&empty); err != nil {
+		return nil, err
+	}
+	return stream, stream.CloseSend()
+}
+
+func (s *spiffeSource) watch(ctx context.Context, stream grpc.ClientStream) {
+	defer s.conn.Close()
+	for {
+		err := s.recv(stream)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			s.logger.V(1).Info("rotated SPIFFE SVID")
+			continue
+		}
+
+		s.logger.Error(err, "failed to fetch SPIFFE SVID; continuing to serve the last certificate")
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+			if stream, err = s.fetch(ctx); err == nil {
+				break
+			}
+		}
+	}
+}
+
+// recv receives the next update and stores the default SVID, which is the
+// first one, and its trust bundle.
+func (s *spiffeSource) recv(stream grpc.ClientStream) error {
+	var msg []byte
+	if err := stream.RecvMsg(&msg); err != nil {
+		return err
+	}
+
+	svid, err := parseX509SVIDResponse(msg)
+	if err != nil {
+		return err
+	}
+	s.holder.Store(svid.cert)
+	s.bundle.Store(svid.bundle)
+	return nil
+}
+
+// Bundle returns the pool of certificates trusted by the SVID's trust domain.
+func (s *spiffeSource) Bundle() *x509.CertPool {
+	return s.bundle.Load()
+}
+
+// ServerTLSConfig configures base to present the SVID and, unless other
+// certificate authorities are configured, to verify client certificates with
+// the trust bundle.
+func (s *spiffeSource) ServerTLSConfig(base *tls.Config) {
+	base.GetCertificate = s.holder.GetCertificate
+	if base.ClientCAs != nil || base.ClientAuth == tls.NoClientCert {
+		return
+	}
+
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cfg := base.Clone()
+		cfg.GetConfigForClient = nil
+		cfg.ClientCAs = s.Bundle()
+		return cfg, nil
+	}
+}
+
+// ClientTLSConfig returns a configuration that presents the SVID and verifies
+// the server with the trust bundle.
+//
+// SVIDs identify workloads by SPIFFE ID rather than hostname, so the server
+// is authorized by the SPIFFE ID in its certificate. If serverID is empty,
+// any server whose certificate chains to the bundle is authorized, which is
+// only appropriate when every workload of the trust domain may serve the
+// client, such as when the endpoint is itself trusted to select the server.
+func (s *spiffeSource) ClientTLSConfig(serverID string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return s.holder.GetCertificate(nil)
+		},
+		InsecureSkipVerify: true, // Replaced by VerifyPeerCertificate.
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("server presented no certificate")
+			}
+			certs := make([]*x509.Certificate, 0, len(rawCerts))
+			for _, raw := range rawCerts {
+				cert, err := x509.ParseCertificate(raw)
+				if err != nil {
+					return err
+				}
+				certs = append(certs, cert)
+			}
+
+			intermediates := x509.NewCertPool()
+			for _, cert := range certs[1:] {
+				intermediates.AddCert(cert)
+			}
+			if _, err := certs[0].Verify(x509.VerifyOptions{
+				Roots:         s.Bundle(),
+				Intermediates: intermediates,
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+			}); err != nil {
+				return err
+			}
+
+			if serverID == "" {
+				return nil
+			}
+			id, err := spiffeID(certs[0])
+			if err != nil {
+				return err
+			}
+			if id != serverID {
+				return fmt.Errorf("server presented SPIFFE ID %s, expected %s", id, serverID)
+			}
+			return nil
+		},
+	}
+}
+
+// spiffeID returns the SPIFFE ID of an SVID, which is its only URI SAN.
+func spiffeID(cert *x509.Certificate) (string, error) {
+	if len(cert.URIs) != 1 || cert.URIs[0].Scheme != "spiffe" {
+		return "", errors.New("certificate is not an SVID: it must have exactly one spiffe:// URI SAN")
+	}
+	return cert.URIs[0].String(), nil
+}
+
+type x509SVID struct {
+	cert   *tls.Certificate
+	bundle *x509.CertPool
+}
+
+// parseX509SVIDResponse decodes the first SVID of an X509SVIDResponse
+// message.
+func parseX509SVIDResponse(msg []byte) (x509SVID, error) {
+	var svids [][]byte
+	if err := rangeFields(msg, func(num protowire.Number, value []byte) {
+		if num == 1 { // repeated X509SVID svids = 1;
+			svids = append(svids, value)
+		}
+	}); err != nil {
+		return x509SVID{}, err
+	}
+	if len(svids) == 0 {
+		return x509SVID{}, errors.New("workload API returned no SVIDs")
+	}
+
+	var certsDER, keyDER, bundleDER []byte
+	if err := rangeFields(svids[0], func(num protowire.Number, value []byte) {
+		switch num {
+		case 2: // bytes x509_svid = 2;
+			certsDER = value
+		case 3: // bytes x509_svid_key = 3;
+			keyDER = value
+		case 4: // bytes bundle = 4;
+			bundleDER = value
+		}
+	}); err != nil {
+		return x509SVID{}, err
+	}
+
+	certs, err := x509.ParseCertificates(certsDER)
+	if err != nil || len(certs) == 0 {
+		return x509SVID{}, fmt.Errorf("failed to parse SVID certificates: %w", err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyDER)
+	if err != nil {
+		return x509SVID{}, fmt.Errorf("failed to parse SVID key: %w", err)
+	}
+	roots, err := x509.ParseCertificates(bundleDER)
+	if err != nil {
+		return x509SVID{}, fmt.Errorf("failed to parse SVID bundle: %w", err)
+	}
+
+	cert := &tls.Certificate{PrivateKey: key, Leaf: certs[0]}
+	for _, c := range certs {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	bundle := x509.NewCertPool()
+	for _, c := range roots {
+		bundle.AddCert(c)
+	}
+	return x509SVID{cert: cert, bundle: bundle}, nil
+}
+
+// rangeFields calls fn with the number and value of every length-delimited
+// field of a protobuf message, skipping fields of other types.
+func rangeFields(msg []byte, fn func(num protowire.Number, value []byte)) error {
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		msg = msg[n:]
+
+		if typ == protowire.BytesType {
+			value, n := protowire.ConsumeBytes(msg)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			fn(num, value)
+			msg = msg[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, msg)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		msg = msg[n:]
+	}
+	return nil
+}
+
+// rawCodec passes the encoded messages of a stream through as bytes.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	return *v.(*[]byte), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	*v.(*[]byte) = append([]byte(nil), data...)
+	return nil
+}
+
+func (rawCodec) Name() string { return "proto" }
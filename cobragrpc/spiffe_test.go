@@ -0,0 +1,185 @@
+package cobragrpc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type testSVID struct {
+	id      string
+	certDER []byte
+	keyDER  []byte
+}
+
+// newTestSVIDs creates a CA and SVIDs for each of the provided SPIFFE IDs
+// that are signed by it.
+func newTestSVIDs(t *testing.T, ids ...string) (caDER []byte, svids []testSVID) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err = x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, id := range ids {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uri, err := url.Parse(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 2)),
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			URIs:         []*url.URL{uri},
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		svids = append(svids, testSVID{id: id, certDER: certDER, keyDER: keyDER})
+	}
+	return caDER, svids
+}
+
+// encodeX509SVIDResponse encodes an X509SVIDResponse as sent by the Workload
+// API, including a federated bundle and an unknown field that are skipped.
+func encodeX509SVIDResponse(caDER []byte, svids ...testSVID) []byte {
+	var msg []byte
+	for _, svid := range svids {
+		var b []byte
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, svid.id)
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, svid.certDER)
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, svid.keyDER)
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, caDER)
+
+		msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+		msg = protowire.AppendBytes(msg, b)
+	}
+
+	var federated []byte
+	federated = protowire.AppendTag(federated, 1, protowire.BytesType)
+	federated = protowire.AppendString(federated, "spiffe://other.example.org")
+	federated = protowire.AppendTag(federated, 2, protowire.BytesType)
+	federated = protowire.AppendBytes(federated, caDER)
+	msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+	msg = protowire.AppendBytes(msg, federated)
+
+	msg = protowire.AppendTag(msg, 99, protowire.VarintType)
+	return protowire.AppendVarint(msg, 1)
+}
+
+func TestParseX509SVIDResponse(t *testing.T) {
+	caDER, svids := newTestSVIDs(t, "spiffe://example.org/server", "spiffe://example.org/other")
+
+	svid, err := parseX509SVIDResponse(encodeX509SVIDResponse(caDER, svids...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := spiffeID(svid.cert.Leaf); err != nil || id != "spiffe://example.org/server" {
+		t.Fatalf("expected the first SVID to be used, got %s (%v)", id, err)
+	}
+	if len(svid.cert.Certificate) != 1 || svid.cert.PrivateKey == nil {
+		t.Fatalf("expected the certificate and its key, got %d certificates", len(svid.cert.Certificate))
+	}
+	if _, err := svid.cert.Leaf.Verify(x509.VerifyOptions{Roots: svid.bundle, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		t.Fatalf("expected the SVID to be verified by the bundle: %v", err)
+	}
+}
+
+func TestParseX509SVIDResponseErrors(t *testing.T) {
+	caDER, svids := newTestSVIDs(t, "spiffe://example.org/server")
+	badKey := svids[0]
+	badKey.keyDER = []byte("not a key")
+
+	for _, tt := range []struct {
+		name     string
+		msg      []byte
+		expected string
+	}{
+		{"no SVIDs", encodeX509SVIDResponse(caDER), "no SVIDs"},
+		{"bad key", encodeX509SVIDResponse(caDER, badKey), "failed to parse SVID key"},
+		{"truncated", encodeX509SVIDResponse(caDER, svids...)[:20], "unexpected EOF"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseX509SVIDResponse(tt.msg)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Fatalf("expected an error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestClientTLSConfigAuthorizesServerID(t *testing.T) {
+	caDER, svids := newTestSVIDs(t, "spiffe://example.org/client", "spiffe://example.org/server")
+	client, err := parseX509SVIDResponse(encodeX509SVIDResponse(caDER, svids[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, untrustedSVIDs := newTestSVIDs(t, "spiffe://example.org/server")
+
+	s := &spiffeSource{holder: &certificateHolder{}}
+	s.holder.Store(client.cert)
+	s.bundle.Store(client.bundle)
+
+	for _, tt := range []struct {
+		name     string
+		serverID string
+		cert     []byte
+		expected string
+	}{
+		{"any", "", svids[1].certDER, ""},
+		{"expected", "spiffe://example.org/server", svids[1].certDER, ""},
+		{"unexpected", "spiffe://example.org/backend", svids[1].certDER, "expected spiffe://example.org/backend"},
+		{"untrusted", "", untrustedSVIDs[0].certDER, "unknown authority"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.ClientTLSConfig(tt.serverID).VerifyPeerCertificate([][]byte{tt.cert}, nil)
+			switch {
+			case tt.expected == "" && err != nil:
+				t.Fatalf("expected the server to be authorized, got %v", err)
+			case tt.expected != "" && (err == nil || !strings.Contains(err.Error(), tt.expected)):
+				t.Fatalf("expected an error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// Package xds implements a mode of cobragrpc servers whose listeners, routes,
+// and security are configured by an xDS control plane, such as those of
+// service meshes like Istio and Traffic Director.
+//
+// It is a separate module so that only services running in a mesh depend on
+// the xDS client and the Envoy APIs, which also require a newer version of
+// gRPC than cobragrpc.
+package xds
+
+import (
+	"github.com/jzelinskie/cobrautil/v2/cobragrpc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	xdscreds "google.golang.org/grpc/credentials/xds"
+	grpcxds "google.golang.org/grpc/xds"
+)
+
+// WithXDS adds the "$PREFIX-xds-enabled" flag, which creates the server with
+// NewServer when true.
+//
+// The xDS client is configured by the bootstrap file referenced by the
+// GRPC_XDS_BOOTSTRAP environment variable or the bootstrap contents of the
+// GRPC_XDS_BOOTSTRAP_CONFIG environment variable, which are typically
+// provided by the mesh.
+func WithXDS() cobragrpc.Option {
+	return cobragrpc.WithServerMode("xds", "serve with xDS, configuring the server from the control plane referenced by the GRPC_XDS_BOOTSTRAP environment variable", NewServer)
+}
+
+// NewServer creates an xDS-enabled server with xDS credentials, so that the
+// control plane can configure mTLS between services.
+//
+// The provided credentials, or plaintext if nil, are used when the control
+// plane does not provide any security configuration.
+func NewServer(creds credentials.TransportCredentials, opts ...grpc.ServerOption) (cobragrpc.Server, error) {
+	if creds == nil {
+		creds = insecure.NewCredentials()
+	}
+	xc, err := xdscreds.NewServerCredentials(xdscreds.ServerOptions{FallbackCreds: creds})
+	if err != nil {
+		return nil, err
+	}
+
+	srv, err := grpcxds.NewGRPCServer(append(opts, grpc.Creds(xc))...)
+	if err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
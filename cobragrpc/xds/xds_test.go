@@ -0,0 +1,28 @@
+package xds_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil/v2/cobragrpc"
+	"github.com/jzelinskie/cobrautil/v2/cobragrpc/xds"
+)
+
+func TestXDSRequiresBootstrap(t *testing.T) {
+	t.Setenv("GRPC_XDS_BOOTSTRAP", "")
+	t.Setenv("GRPC_XDS_BOOTSTRAP_CONFIG", "")
+
+	b := cobragrpc.New("myservice", xds.WithXDS())
+	cmd := &cobra.Command{Use: "test"}
+	b.RegisterFlags(cmd.Flags())
+	if err := cmd.ParseFlags([]string{"--grpc-xds-enabled"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := b.ServerFromFlagsWithModes(cmd)
+	if expected := "failed to create gRPC server with --grpc-xds-enabled: "; err == nil || !strings.HasPrefix(err.Error(), expected) {
+		t.Fatalf("expected an error starting with %q, got %v", expected, err)
+	}
+}
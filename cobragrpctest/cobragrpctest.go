@@ -0,0 +1,120 @@
+// Package cobragrpctest implements utilities for testing gRPC services served
+// by servers configured with cobragrpc.
+//
+// A Server is created from flags exactly as a program using the cobragrpc
+// builder would, including its interceptors, limits, and credentials, but is
+// served over an in-memory connection so that tests can exercise service
+// handlers without listening on the network.
+package cobragrpctest
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/jzelinskie/cobrautil/v2/cobragrpc"
+)
+
+// bufferSize is the size of the in-memory buffer of each connection.
+const bufferSize = 1024 * 1024
+
+// Server is a gRPC server created from the flags of a cobragrpc.Builder that
+// is served over an in-memory connection.
+type Server struct {
+	Command *cobra.Command
+	Builder *cobragrpc.Builder
+	Config  cobragrpc.Config
+	Server  *grpc.Server
+
+	// Conn is a client connected to the server, which is secured with TLS
+	// without verifying the server's certificate if TLS is configured.
+	Conn *grpc.ClientConn
+
+	listener *bufconn.Listener
+}
+
+// NewServer creates a server with the ServerFromFlags method of the provided
+// builder, from the provided arguments, and serves it until the test
+// completes.
+//
+// Services are registered on the server by providing the builder with
+// cobragrpc.WithServiceRegistrar. The server is served regardless of whether
+// it is enabled and the configured addresses are ignored.
+func NewServer(t testing.TB, b *cobragrpc.Builder, args ...string) *Server {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		Command:  &cobra.Command{Use: "cobragrpctest"},
+		Builder:  b,
+		listener: bufconn.Listen(bufferSize),
+	}
+	s.Command.SetContext(ctx)
+	b.RegisterFlags(s.Command.Flags())
+
+	if err := s.Command.ParseFlags(args); err != nil {
+		cancel()
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	var err error
+	s.Config, err = b.ConfigFromFlags(s.Command)
+	if err != nil {
+		cancel()
+		t.Fatalf("failed to configure gRPC server: %v", err)
+	}
+	s.Server, err = b.ServerFromFlags(s.Command)
+	if err != nil {
+		cancel()
+		t.Fatalf("failed to create gRPC server: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.Server.Serve(s.listener) }()
+	t.Cleanup(func() {
+		s.Server.Stop()
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("failed to serve gRPC: %v", err)
+		}
+	})
+
+	s.Conn = s.Dial(t)
+	return s
+}
+
+// Dial creates a client connected to the server that is closed when the test
+// completes.
+//
+// Unless the provided options include credentials, the connection is
+// plaintext or secured with TLS without verifying the server's certificate,
+// depending on the server's configuration.
+func (s *Server) Dial(t testing.TB, opts ...grpc.DialOption) *grpc.ClientConn {
+	t.Helper()
+
+	creds := insecure.NewCredentials()
+	if !s.Config.Insecure() {
+		creds = credentials.NewTLS(&tls.Config{InsecureSkipVerify: true}) // Only used by tests.
+	}
+
+	opts = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return s.listener.DialContext(ctx)
+		}),
+	}, opts...)
+
+	conn, err := grpc.Dial("passthrough:///cobragrpctest", opts...)
+	if err != nil {
+		t.Fatalf("failed to dial gRPC server: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
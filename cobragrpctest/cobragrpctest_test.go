@@ -0,0 +1,32 @@
+package cobragrpctest_test
+
+import (
+	"context"
+	"testing"
+
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/jzelinskie/cobrautil/v2/cobragrpc"
+	"github.com/jzelinskie/cobrautil/v2/cobragrpctest"
+)
+
+func TestServer(t *testing.T) {
+	s := cobragrpctest.NewServer(t, cobragrpc.New("myservice"),
+		"--grpc-channelz-enabled",
+		"--grpc-preshared-key=secret",
+	)
+	client := channelzpb.NewChannelzClient(s.Conn)
+
+	_, err := client.GetTopChannels(context.Background(), &channelzpb.GetTopChannelsRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected the preshared key from flags to be required, got %v", err)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+	if _, err := client.GetTopChannels(ctx, &channelzpb.GetTopChannelsRequest{}); err != nil {
+		t.Fatalf("expected the request to succeed with the preshared key, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package cobrahttp
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// credentials holds digests of the secrets requests are authenticated with,
+// so that comparisons take the same time regardless of their length.
+type credentials struct {
+	username, password [sha256.Size]byte
+	bearerToken        [sha256.Size]byte
+	basic, bearer      bool
+}
+
+// authEnabled returns true if requests must present credentials.
+func (c Config) authEnabled() bool {
+	return c.AuthUsername != "" || c.AuthPasswordFile != "" || c.AuthBearerTokenFile != ""
+}
+
+// credentials reads the secrets requests are authenticated with.
+func (c Config) credentials() (*credentials, error) {
+	if (c.AuthUsername == "") != (c.AuthPasswordFile == "") {
+		return nil, errors.New("basic authentication requires both a username and a password file")
+	}
+
+	var creds credentials
+	if c.AuthUsername != "" {
+		password, err := readSecretFile(c.AuthPasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read password: %w", err)
+		}
+		creds.basic = true
+		creds.username = sha256.Sum256([]byte(c.AuthUsername))
+		creds.password = sha256.Sum256(password)
+	}
+	if c.AuthBearerTokenFile != "" {
+		token, err := readSecretFile(c.AuthBearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bearer token: %w", err)
+		}
+		creds.bearer = true
+		creds.bearerToken = sha256.Sum256(token)
+	}
+	return &creds, nil
+}
+
+// readSecretFile reads a secret from a file, ignoring surrounding whitespace
+// such as the trailing newline added by most editors.
+func readSecretFile(path string) ([]byte, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	secret := strings.TrimSpace(string(contents))
+	if secret == "" {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+	return []byte(secret), nil
+}
+
+// authenticates returns true if the request presents either of the
+// credentials.
+func (c *credentials) authenticates(r *http.Request) bool {
+	if c.basic {
+		if username, password, ok := r.BasicAuth(); ok {
+			usernameSum, passwordSum := sha256.Sum256([]byte(username)), sha256.Sum256([]byte(password))
+			// Both are always compared so that the username cannot be
+			// discovered by timing.
+			usernameOK := subtle.ConstantTimeCompare(usernameSum[:], c.username[:])
+			passwordOK := subtle.ConstantTimeCompare(passwordSum[:], c.password[:])
+			if usernameOK&passwordOK == 1 {
+				return true
+			}
+		}
+	}
+
+	if c.bearer {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			tokenSum := sha256.Sum256([]byte(token))
+			if subtle.ConstantTimeCompare(tokenSum[:], c.bearerToken[:]) == 1 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// withAuth responds 401 to requests that do not present the credentials
+// configured by the flags.
+//
+// If the credentials cannot be read, every request is rejected rather than
+// served without authentication.
+func withAuth(handler http.Handler, cfg Config, realm string) http.Handler {
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+
+	creds, err := cfg.credentials()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if !creds.authenticates(r) {
+			if creds.basic {
+				w.Header().Add("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", realm))
+			}
+			if creds.bearer {
+				w.Header().Add("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", realm))
+			}
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
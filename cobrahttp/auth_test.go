@@ -0,0 +1,62 @@
+package cobrahttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil/v2/cobrahttp"
+)
+
+func TestAuth(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile, tokenFile := filepath.Join(dir, "password"), filepath.Join(dir, "token")
+	if err := os.WriteFile(passwordFile, []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tokenFile, []byte("s3cr3t\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	b := cobrahttp.New("metrics", cobrahttp.WithHandler(echoHandler))
+	cmd := &cobra.Command{Use: "mycmd", RunE: func(*cobra.Command, []string) error { return nil }}
+	b.RegisterFlags(cmd.Flags())
+	cmd.SetArgs([]string{
+		"--http-auth-username", "admin",
+		"--http-auth-password-file", passwordFile,
+		"--http-auth-bearer-token-file", tokenFile,
+	})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.ConfigFromFlags(cmd); err != nil {
+		t.Fatal(err)
+	}
+	handler := b.ServerFromFlags(cmd).Handler
+
+	for _, tt := range []struct {
+		name     string
+		setAuth  func(r *http.Request)
+		expected int
+	}{
+		{"none", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"basic", func(r *http.Request) { r.SetBasicAuth("admin", "hunter2") }, http.StatusOK},
+		{"wrong password", func(r *http.Request) { r.SetBasicAuth("admin", "hunter3") }, http.StatusUnauthorized},
+		{"bearer", func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cr3t") }, http.StatusOK},
+		{"wrong token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer hunter2") }, http.StatusUnauthorized},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			tt.setAuth(req)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.expected {
+				t.Fatalf("expected %d, got %d", tt.expected, rec.Code)
+			}
+		})
+	}
+}
@@ -3,15 +3,27 @@
 package cobrahttp
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io/fs"
+	"net"
 	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/jzelinskie/cobrautil/v2"
+	"github.com/jzelinskie/cobrautil/v2/internal/netutil"
 	"github.com/jzelinskie/stringz"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"golang.org/x/crypto/acme/autocert"
+	xnetutil "golang.org/x/net/netutil"
 )
 
 // Option is function used to configure an HTTP server within a Cobra RunFunc.
@@ -30,6 +42,9 @@ func New(serviceName string, opts ...Option) *Builder {
 	for _, configure := range opts {
 		configure(b)
 	}
+	if len(b.routes) > 0 {
+		b.handler = newRouter(b.routes, b.handler)
+	}
 	return b
 }
 
@@ -39,9 +54,23 @@ type Builder struct {
 	serviceName    string
 	defaultAddr    string
 	defaultEnabled bool
+	defaultHealth  bool
+	defaultPprof   bool
 	logger         logr.Logger
 	preRunLevel    int
 	handler        http.Handler
+	routes         []route
+	middleware     []func(http.Handler) http.Handler
+	static         fs.FS
+
+	metricsEnabled    bool
+	metricsRegisterer prometheus.Registerer
+
+	livenessChecks  []namedCheck
+	readinessChecks []namedCheck
+
+	// shuttingDown fails readiness checks once graceful shutdown begins.
+	shuttingDown atomic.Bool
 }
 
 func (b *Builder) prefix(s string) string {
@@ -52,69 +81,671 @@ func (b *Builder) prefix(s string) string {
 //
 // The following flags are added:
 // - "$PREFIX-addr"
+// - "$PREFIX-legacy-addr"
+// - "$PREFIX-network"
+// - "$PREFIX-socket-mode"
+// - "$PREFIX-socket-owner"
 // - "$PREFIX-tls-cert-path"
 // - "$PREFIX-tls-key-path"
+// - "$PREFIX-acme-domains"
+// - "$PREFIX-acme-cache-dir"
+// - "$PREFIX-acme-directory-url"
+// - "$PREFIX-tls-min-version"
+// - "$PREFIX-tls-ciphers"
+// - "$PREFIX-tls-curves"
+// - "$PREFIX-tls-client-ca-path"
+// - "$PREFIX-client-auth"
+// - "$PREFIX-auth-username"
+// - "$PREFIX-auth-password-file"
+// - "$PREFIX-auth-bearer-token-file"
 // - "$PREFIX-enabled"
+// - "$PREFIX-read-header-timeout"
+// - "$PREFIX-read-timeout"
+// - "$PREFIX-write-timeout"
+// - "$PREFIX-idle-timeout"
+// - "$PREFIX-handler-timeout"
+// - "$PREFIX-max-header-bytes"
+// - "$PREFIX-max-body-bytes"
+// - "$PREFIX-shutdown-grace-period"
+// - "$PREFIX-health-enabled"
+// - "$PREFIX-pprof-enabled"
+// - "$PREFIX-static-dir"
+// - "$PREFIX-static-prefix"
+// - "$PREFIX-spa-fallback"
+// - "$PREFIX-websocket-enabled"
+// - "$PREFIX-grpc-enabled"
+// - "$PREFIX-accept-retry"
+// - "$PREFIX-accept-retry-max-backoff"
+// - "$PREFIX-stall-check-interval"
+// - "$PREFIX-stall-action"
+// - "$PREFIX-keepalives-enabled"
+// - "$PREFIX-max-connections"
 func (b *Builder) RegisterFlags(flags *pflag.FlagSet) {
 	flags.String(b.prefix("addr"), b.defaultAddr, "address to listen on to serve "+b.serviceName)
+	flags.String(b.prefix("legacy-addr"), "", "additional address to listen on to serve "+b.serviceName+" while clients migrate to --"+b.prefix("addr")+"; connections are logged (disabled if empty)")
+	flags.String(b.prefix("network"), "tcp", "network type to serve "+b.serviceName+` ("tcp", "tcp4", "tcp6", "unix", or "systemd" to use a socket-activated listener, selected by an "fd://name" address if several are passed)`)
+	flags.String(b.prefix("socket-mode"), "", "permissions in octal (e.g. 0660) of the unix socket used to serve "+b.serviceName+" (defaults to the umask)")
+	flags.String(b.prefix("socket-owner"), "", `owner ("user[:group]") of the unix socket used to serve `+b.serviceName+" (defaults to the current user)")
 	flags.String(b.prefix("tls-cert-path"), "", "local path to the TLS certificate used to serve "+b.serviceName)
 	flags.String(b.prefix("tls-key-path"), "", "local path to the TLS key used to serve "+b.serviceName)
+	flags.StringSlice(b.prefix("acme-domains"), nil, "domains for which certificates used to serve "+b.serviceName+" are obtained via ACME, which requires serving on port 443")
+	flags.String(b.prefix("acme-cache-dir"), "", "local directory in which certificates obtained via ACME for "+b.serviceName+" are stored (kept in memory if empty)")
+	flags.String(b.prefix("acme-directory-url"), autocert.DefaultACMEDirectory, "URL of the ACME directory from which certificates used to serve "+b.serviceName+" are obtained")
+	flags.String(b.prefix("tls-min-version"), "1.2", "minimum version of TLS accepted by "+b.serviceName+` ("1.0", "1.1", "1.2", "1.3")`)
+	flags.StringSlice(b.prefix("tls-ciphers"), nil, "cipher suites accepted by "+b.serviceName+" for TLS 1.2 and earlier, by their IANA names (defaults to those of crypto/tls)")
+	flags.StringSlice(b.prefix("tls-curves"), nil, "elliptic curves used by "+b.serviceName+` for key exchange in order of preference ("X25519", "P256", "P384", "P521"; defaults to those of crypto/tls)`)
+	flags.String(b.prefix("tls-client-ca-path"), "", "local path to the certificate authorities used to verify client certificates presented to "+b.serviceName)
+	flags.String(b.prefix("client-auth"), "none", "policy for client certificates presented to "+b.serviceName+` ("none", "request", "require-and-verify")`)
+	flags.String(b.prefix("auth-username"), "", "username that requests to "+b.serviceName+" must present using basic authentication")
+	flags.String(b.prefix("auth-password-file"), "", "local path to the password that requests to "+b.serviceName+" must present using basic authentication")
+	flags.String(b.prefix("auth-bearer-token-file"), "", "local path to a token that requests to "+b.serviceName+" may instead present as a bearer token")
 	flags.Bool(b.prefix("enabled"), b.defaultEnabled, "enable "+b.serviceName+" http server")
+	flags.Duration(b.prefix("read-header-timeout"), 10*time.Second, "how long reading the headers of a request to "+b.serviceName+" is allowed to take (zero for no timeout)")
+	flags.Duration(b.prefix("read-timeout"), 0, "how long reading a request to "+b.serviceName+" is allowed to take (zero for no timeout)")
+	flags.Duration(b.prefix("write-timeout"), 0, "how long writing a response from "+b.serviceName+" is allowed to take (zero for no timeout)")
+	flags.Duration(b.prefix("idle-timeout"), 0, "how long an idle keep-alive connection to "+b.serviceName+" is kept open (zero to use the read timeout)")
+	flags.Duration(b.prefix("handler-timeout"), 0, "how long handling a request to "+b.serviceName+" is allowed to take before responding 503 (zero for no timeout)")
+	cobrautil.RegisterByteSizeFlag(flags, b.prefix("max-header-bytes"), http.DefaultMaxHeaderBytes, "maximum size of the headers of a request to "+b.serviceName)
+	cobrautil.RegisterByteSizeFlag(flags, b.prefix("max-body-bytes"), 0, "maximum size of the body of a request to "+b.serviceName+", beyond which reading it fails (zero for no limit)")
+	flags.Duration(b.prefix("shutdown-grace-period"), 10*time.Second, "how long active requests to "+b.serviceName+" are given to complete when shutting down before their connections are closed (0 waits indefinitely)")
+	flags.Bool(b.prefix("health-enabled"), b.defaultHealth, `serve the liveness and readiness checks of `+b.serviceName+` at "/healthz" and "/readyz"`)
+	flags.Bool(b.prefix("pprof-enabled"), b.defaultPprof, `serve runtime profiles of `+b.serviceName+` at "/debug/pprof/", protected by the configured authentication`)
+	flags.String(b.prefix("static-dir"), "", "local directory of static assets served by "+b.serviceName+" (overrides any embedded assets)")
+	flags.String(b.prefix("static-prefix"), "/", "path under which the static assets of "+b.serviceName+" are served")
+	flags.Bool(b.prefix("spa-fallback"), false, `serve "index.html" to browsers requesting static assets of `+b.serviceName+" that do not exist, for single-page applications")
+	flags.Bool(b.prefix("websocket-enabled"), false, "exempt upgraded connections (e.g. WebSockets) to "+b.serviceName+" from the write and handler timeouts")
+	flags.Bool(b.prefix("grpc-enabled"), false, "also serve gRPC requests on the port of "+b.serviceName+" when the server is created with ServerFromFlagsWithGRPC")
+	flags.Bool(b.prefix("accept-retry"), true, "retry accepting connections to "+b.serviceName+" after transient errors (e.g. running out of file descriptors) instead of stopping the server")
+	flags.Duration(b.prefix("accept-retry-max-backoff"), time.Second, "maximum delay between retries of accepting connections to "+b.serviceName)
+	flags.Duration(b.prefix("stall-check-interval"), 0, "interval between checks that "+b.serviceName+" is still accepting connections, made by dialing its own TCP listeners (disabled if zero); servers with --"+b.prefix("max-connections")+" connections open fail the checks")
+	flags.String(b.prefix("stall-action"), "log", "action taken when "+b.serviceName+` stops accepting connections ("log", or "stop" to stop serving after three consecutive failed checks so that the process can be restarted)`)
+	flags.Bool(b.prefix("keepalives-enabled"), true, "reuse connections to "+b.serviceName+" for multiple HTTP/1.1 requests")
+	flags.Int(b.prefix("max-connections"), 0, "maximum number of simultaneous connections accepted by "+b.serviceName+" on each address, beyond which connections wait to be accepted (zero for no limit)")
+
+	// Listen addresses commonly differ between instances of a service.
+	if err := cobrautil.MarkFlagsInstanceLocal(flags, b.prefix("addr"), b.prefix("legacy-addr")); err != nil {
+		panic("failed to mark flag instance-local: " + err.Error())
+	}
+}
+
+// RegisterNamedFlags adds the flags from RegisterFlags() to the "HTTP"
+// section of the provided NamedFlagSets.
+func (b *Builder) RegisterNamedFlags(nfs *cobrautil.NamedFlagSets) {
+	b.RegisterFlags(nfs.FlagSet("HTTP"))
+}
+
+// Config is the configuration of an HTTP server resolved from the flags
+// registered by RegisterFlags().
+type Config struct {
+	Enabled           bool
+	Addr              string
+	LegacyAddr        string
+	Network           string
+	SocketMode        fs.FileMode
+	SocketOwner       string
+	TLSCertPath       string
+	TLSKeyPath        string
+	ACMEDomains       []string
+	ACMECacheDir      string
+	ACMEDirectoryURL  string
+	TLSMinVersion     string
+	TLSCiphers        []string
+	TLSCurves         []string
+	ClientCAPath      string
+	ClientAuth        string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	HandlerTimeout    time.Duration
+	WebSocketEnabled  bool
+	GRPCEnabled       bool
+
+	ShutdownGracePeriod time.Duration
+	HealthEnabled       bool
+	PprofEnabled        bool
+
+	StaticDir    string
+	StaticPrefix string
+	SPAFallback  bool
+
+	AuthUsername        string
+	AuthPasswordFile    string
+	AuthBearerTokenFile string
+
+	MaxHeaderBytes int64
+	MaxBodyBytes   int64
+
+	AcceptRetry           bool
+	AcceptRetryMaxBackoff time.Duration
+
+	StallCheckInterval time.Duration
+	StallAction        string
+
+	KeepAlivesEnabled bool
+	MaxConnections    int
+}
+
+// Insecure returns true if the server is configured to serve plaintext.
+func (c Config) Insecure() bool {
+	return c.TLSCertPath == "" && c.TLSKeyPath == "" && len(c.ACMEDomains) == 0
+}
+
+// ConfigFromFlags resolves the configuration of an HTTP server from the flags
+// registered by RegisterFlags() without constructing or starting anything.
+func (b *Builder) ConfigFromFlags(cmd *cobra.Command) (Config, error) {
+	cfg := b.config(cmd)
+
+	mode, err := netutil.ParseSocketMode(cobrautil.MustGetString(cmd, b.prefix("socket-mode")))
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to start http server: --%s-socket-mode: %w", b.flagPrefix, err)
+	}
+	cfg.SocketMode = mode
+
+	if (cfg.TLSCertPath == "") != (cfg.TLSKeyPath == "") {
+		return Config{}, fmt.Errorf(
+			"failed to start http server: must provide both --%s-tls-cert-path and --%s-tls-key-path",
+			b.flagPrefix,
+			b.flagPrefix,
+		)
+	}
+
+	if len(cfg.ACMEDomains) > 0 && (cfg.TLSCertPath != "" || cfg.TLSKeyPath != "") {
+		return Config{}, fmt.Errorf(
+			"failed to start http server: --%s-acme-domains cannot be combined with --%s-tls-cert-path and --%s-tls-key-path",
+			b.flagPrefix,
+			b.flagPrefix,
+			b.flagPrefix,
+		)
+	}
+
+	if cfg.StallAction != "log" && cfg.StallAction != "stop" {
+		return Config{}, fmt.Errorf(`failed to start http server: --%s must be one of "log", "stop": %s`, b.prefix("stall-action"), cfg.StallAction)
+	}
+
+	if _, ok := clientAuthTypes[cfg.ClientAuth]; !ok {
+		return Config{}, fmt.Errorf(`failed to start http server: --%s-client-auth must be one of "none", "request", "require-and-verify": %s`, b.flagPrefix, cfg.ClientAuth)
+	}
+
+	if cfg.ClientAuth == "require-and-verify" && cfg.ClientCAPath == "" {
+		return Config{}, fmt.Errorf("failed to start http server: --%s-client-auth=require-and-verify requires --%s-tls-client-ca-path", b.flagPrefix, b.flagPrefix)
+	}
+
+	if cfg.Insecure() && (cfg.ClientAuth != "none" || cfg.ClientCAPath != "") {
+		return Config{}, fmt.Errorf("failed to start http server: client certificates require TLS to be configured")
+	}
+
+	if _, err := cfg.tlsConfig(); err != nil {
+		return Config{}, fmt.Errorf("failed to start http server: %w", err)
+	}
+
+	if cfg.authEnabled() {
+		if _, err := cfg.credentials(); err != nil {
+			return Config{}, fmt.Errorf("failed to start http server: %w", err)
+		}
+	}
+
+	if cfg.MaxConnections < 0 {
+		return Config{}, fmt.Errorf("failed to start http server: --%s-max-connections must not be negative", b.flagPrefix)
+	}
+
+	if !strings.HasPrefix(cfg.StaticPrefix, "/") {
+		return Config{}, fmt.Errorf(`failed to start http server: --%s-static-prefix must begin with "/"`, b.flagPrefix)
+	}
+
+	if cfg.StaticDir != "" {
+		if info, err := os.Stat(cfg.StaticDir); err != nil || !info.IsDir() {
+			return Config{}, fmt.Errorf("failed to start http server: --%s-static-dir must be an existing directory: %s", b.flagPrefix, cfg.StaticDir)
+		}
+	}
+
+	if cfg.Enabled && cfg.Insecure() && cobrautil.TLSRequired(cmd) {
+		return Config{}, fmt.Errorf(
+			"failed to start http server: TLS is required but neither --%s-tls-cert-path and --%s-tls-key-path nor --%s-acme-domains were provided",
+			b.flagPrefix,
+			b.flagPrefix,
+			b.flagPrefix,
+		)
+	}
+
+	return cfg, nil
+}
+
+func (b *Builder) config(cmd *cobra.Command) Config {
+	return Config{
+		Enabled:           cobrautil.MustGetBool(cmd, b.prefix("enabled")),
+		Addr:              cobrautil.MustGetStringExpanded(cmd, b.prefix("addr")),
+		LegacyAddr:        cobrautil.MustGetStringExpanded(cmd, b.prefix("legacy-addr")),
+		Network:           cobrautil.MustGetString(cmd, b.prefix("network")),
+		SocketOwner:       cobrautil.MustGetString(cmd, b.prefix("socket-owner")),
+		TLSCertPath:       cobrautil.MustGetStringExpanded(cmd, b.prefix("tls-cert-path")),
+		TLSKeyPath:        cobrautil.MustGetStringExpanded(cmd, b.prefix("tls-key-path")),
+		ACMEDomains:       cobrautil.MustGetStringSlice(cmd, b.prefix("acme-domains")),
+		ACMECacheDir:      cobrautil.MustGetStringExpanded(cmd, b.prefix("acme-cache-dir")),
+		ACMEDirectoryURL:  cobrautil.MustGetString(cmd, b.prefix("acme-directory-url")),
+		TLSMinVersion:     cobrautil.MustGetString(cmd, b.prefix("tls-min-version")),
+		TLSCiphers:        cobrautil.MustGetStringSlice(cmd, b.prefix("tls-ciphers")),
+		TLSCurves:         cobrautil.MustGetStringSlice(cmd, b.prefix("tls-curves")),
+		ClientCAPath:      cobrautil.MustGetStringExpanded(cmd, b.prefix("tls-client-ca-path")),
+		ClientAuth:        cobrautil.MustGetString(cmd, b.prefix("client-auth")),
+		ReadHeaderTimeout: cobrautil.MustGetDuration(cmd, b.prefix("read-header-timeout")),
+		ReadTimeout:       cobrautil.MustGetDuration(cmd, b.prefix("read-timeout")),
+		WriteTimeout:      cobrautil.MustGetDuration(cmd, b.prefix("write-timeout")),
+		IdleTimeout:       cobrautil.MustGetDuration(cmd, b.prefix("idle-timeout")),
+		HandlerTimeout:    cobrautil.MustGetDuration(cmd, b.prefix("handler-timeout")),
+		WebSocketEnabled:  cobrautil.MustGetBool(cmd, b.prefix("websocket-enabled")),
+		GRPCEnabled:       cobrautil.MustGetBool(cmd, b.prefix("grpc-enabled")),
+
+		ShutdownGracePeriod: cobrautil.MustGetDuration(cmd, b.prefix("shutdown-grace-period")),
+		HealthEnabled:       cobrautil.MustGetBool(cmd, b.prefix("health-enabled")),
+		PprofEnabled:        cobrautil.MustGetBool(cmd, b.prefix("pprof-enabled")),
+
+		StaticDir:    cobrautil.MustGetStringExpanded(cmd, b.prefix("static-dir")),
+		StaticPrefix: cobrautil.MustGetString(cmd, b.prefix("static-prefix")),
+		SPAFallback:  cobrautil.MustGetBool(cmd, b.prefix("spa-fallback")),
+
+		AuthUsername:        cobrautil.MustGetString(cmd, b.prefix("auth-username")),
+		AuthPasswordFile:    cobrautil.MustGetStringExpanded(cmd, b.prefix("auth-password-file")),
+		AuthBearerTokenFile: cobrautil.MustGetStringExpanded(cmd, b.prefix("auth-bearer-token-file")),
+
+		MaxHeaderBytes: cobrautil.MustGetByteSize(cmd, b.prefix("max-header-bytes")),
+		MaxBodyBytes:   cobrautil.MustGetByteSize(cmd, b.prefix("max-body-bytes")),
+
+		AcceptRetry:           cobrautil.MustGetBool(cmd, b.prefix("accept-retry")),
+		AcceptRetryMaxBackoff: cobrautil.MustGetDuration(cmd, b.prefix("accept-retry-max-backoff")),
+
+		StallCheckInterval: cobrautil.MustGetDuration(cmd, b.prefix("stall-check-interval")),
+		StallAction:        cobrautil.MustGetString(cmd, b.prefix("stall-action")),
+
+		KeepAlivesEnabled: cobrautil.MustGetBool(cmd, b.prefix("keepalives-enabled")),
+		MaxConnections:    cobrautil.MustGetInt(cmd, b.prefix("max-connections")),
+	}
 }
 
 // ServerFromFlags creates an *http.Server as configured by the flags from
 // RegisterFlags().
+//
+// The contexts of requests carry the values of the command's context and the
+// server, which can be retrieved with ServerFromContext and AddrFromContext.
+// They are canceled once the grace period configured by
+// "$PREFIX-shutdown-grace-period" elapses after the command's context is.
 func (b *Builder) ServerFromFlags(cmd *cobra.Command) *http.Server {
-	return &http.Server{
-		Addr:    cobrautil.MustGetStringExpanded(cmd, b.prefix("addr")),
-		Handler: b.handler,
+	cfg := b.config(cmd)
+
+	handler := b.handler
+	if fsys := b.staticFS(cfg); fsys != nil {
+		handler = withStatic(handler, fsys, cfg.StaticPrefix, cfg.SPAFallback)
+	}
+
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           b.withMiddleware(handler),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    int(cfg.MaxHeaderBytes),
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	srv.BaseContext = baseContext(ctx, srv, cfg.ShutdownGracePeriod)
+
+	if !cfg.KeepAlivesEnabled {
+		srv.SetKeepAlivesEnabled(false)
+	}
+
+	// Invalid policies are reported by ConfigFromFlags and ListenFromFlags,
+	// and fail every handshake rather than fall back to the defaults.
+	if !cfg.Insecure() {
+		tlsConfig, err := cfg.tlsConfig()
+		if err != nil {
+			tlsConfig = &tls.Config{GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) { return nil, err }}
+		}
+		srv.TLSConfig = tlsConfig
+	}
+
+	if cfg.MaxBodyBytes > 0 {
+		handler := srv.Handler
+		if handler == nil {
+			handler = http.DefaultServeMux
+		}
+		srv.Handler = http.MaxBytesHandler(handler, cfg.MaxBodyBytes)
+	}
+
+	if cfg.HandlerTimeout > 0 {
+		srv.Handler = withHandlerTimeout(srv.Handler, cfg.HandlerTimeout, cfg.WebSocketEnabled)
+	}
+
+	// Profiles take longer to record than the handler timeout is likely to
+	// allow, so they are only subject to authentication.
+	if cfg.PprofEnabled {
+		srv.Handler = withProfiling(srv.Handler, cfg.WriteTimeout)
+	}
+
+	if cfg.authEnabled() {
+		srv.Handler = withAuth(srv.Handler, cfg, b.serviceName)
+	}
+
+	// Metrics are recorded outside of the handler timeout so that requests
+	// that time out are included.
+	if b.metricsEnabled {
+		if metrics, err := newHTTPMetrics(b.metricsRegisterer, b.serviceName); err != nil {
+			b.logger.Error(err, "failed to register HTTP metrics; serving without them", "service", b.serviceName)
+		} else {
+			srv.Handler = metrics.Wrap(srv.Handler, b.routeMux())
+		}
+	}
+
+	// Health checks are neither authenticated, since they are typically
+	// probed by orchestrators, nor included in metrics.
+	if cfg.HealthEnabled {
+		srv.Handler = b.withHealth(srv.Handler)
+	}
+
+	if cfg.WebSocketEnabled && cfg.WriteTimeout > 0 {
+		// The server-wide write timeout would also apply to the request that
+		// is upgraded, so it is instead applied to each other request.
+		srv.WriteTimeout = 0
+		srv.Handler = withWriteTimeout(srv.Handler, cfg.WriteTimeout)
+	}
+
+	return srv
+}
+
+// withMiddleware wraps the handler with the middleware provided to
+// WithMiddleware, the first of which is outermost.
+func (b *Builder) withMiddleware(handler http.Handler) http.Handler {
+	if len(b.middleware) == 0 {
+		return handler
+	}
+
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	for i := len(b.middleware) - 1; i >= 0; i-- {
+		handler = b.middleware[i](handler)
+	}
+	return handler
+}
+
+// routeMux returns the ServeMux used to determine the route of requests in
+// metrics, if the handler is one.
+func (b *Builder) routeMux() *http.ServeMux {
+	if b.handler == nil {
+		return http.DefaultServeMux
+	}
+	mux, _ := b.handler.(*http.ServeMux)
+	return mux
+}
+
+// route is a handler mounted by WithRoute.
+type route struct {
+	pattern string
+	handler http.Handler
+}
+
+// newRouter creates a ServeMux serving the routes and, for requests that match
+// none of them, the fallback handler.
+func newRouter(routes []route, fallback http.Handler) *http.ServeMux {
+	mux := http.NewServeMux()
+	hasRoot := false
+	for _, r := range routes {
+		mux.Handle(r.pattern, r.handler)
+		hasRoot = hasRoot || r.pattern == "/"
+	}
+	if fallback != nil && !hasRoot {
+		mux.Handle("/", fallback)
+	}
+	return mux
+}
+
+// RunE returns a Cobra run func that creates a server with ServerFromFlags and
+// serves it with ListenFromFlags until the command's context is canceled and
+// it has been gracefully shut down.
+//
+// The server and the address it is bound to are stored in the command's
+// context before serving and can be retrieved with ServerFromContext and
+// AddrFromContext.
+//
+// Because it blocks until then, it should be the last function when composed
+// with others using cobrautil.CommandStack, e.g. after those configuring
+// logging and tracing. Servers that also serve gRPC must instead be created
+// with ServerFromFlagsWithGRPC.
+//
+// This is a no-op if the server is not enabled.
+//
+// The required flags can be added to a command by using RegisterFlags().
+func (b *Builder) RunE() cobrautil.CobraRunFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if cobrautil.IsBuiltinCommand(cmd) {
+			return nil // No-op for builtins
+		}
+
+		if !cobrautil.MustGetBool(cmd, b.prefix("enabled")) {
+			return nil
+		}
+
+		srv := b.ServerFromFlags(cmd)
+		l, err := b.ListenerFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		cmd.SetContext(ContextWithServer(ctx, srv, l.Addr()))
+
+		return b.ServeFromFlags(cmd, srv, l)
 	}
 }
 
 // ListenFromFlags listens on the provided HTTP server using values configured
 // in the provided command.
+//
+// When the command's context is canceled, the server is gracefully shut down
+// and ListenFromFlags returns once active requests have completed or the
+// grace period configured by "$PREFIX-shutdown-grace-period" has elapsed,
+// after which their connections are closed.
 func (b *Builder) ListenFromFlags(cmd *cobra.Command, srv *http.Server) error {
 	if !cobrautil.MustGetBool(cmd, b.prefix("enabled")) {
 		return nil
 	}
 
-	certPath := cobrautil.MustGetStringExpanded(cmd, b.prefix("tls-cert-path"))
-	keyPath := cobrautil.MustGetStringExpanded(cmd, b.prefix("tls-key-path"))
+	l, err := b.ListenerFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	return b.ServeFromFlags(cmd, srv, l)
+}
 
-	switch {
-	case certPath == "" && keyPath == "":
+// ListenerFromFlags creates a listener on the address configured by the
+// "$PREFIX-addr" flag without serving anything.
+//
+// Addresses with port 0 (e.g. "127.0.0.1:0") listen on an ephemeral port, so
+// tests can start the server configured by the flags and discover the port
+// with Addr().
+func (b *Builder) ListenerFromFlags(cmd *cobra.Command) (net.Listener, error) {
+	cfg, err := b.ConfigFromFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := cfg.Addr
+	if addr == "" {
+		// Match the defaults of ListenAndServe and ListenAndServeTLS.
+		addr = ":http"
+		if !cfg.Insecure() {
+			addr = ":https"
+		}
+	}
+	return b.listen(cfg, addr)
+}
+
+func (b *Builder) listen(cfg Config, addr string) (net.Listener, error) {
+	l, err := b.bind(cfg, addr)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxConnections > 0 {
+		l = xnetutil.LimitListener(l, cfg.MaxConnections)
+	}
+	if cfg.AcceptRetry {
+		var retries prometheus.Counter
+		if b.metricsEnabled {
+			var err error
+			if retries, err = netutil.NewAcceptRetries(b.metricsRegisterer, "http", b.serviceName); err != nil {
+				b.logger.Error(err, "failed to register accept retry metrics; serving without them", "service", b.serviceName)
+			}
+		}
+		l = netutil.RetryListener(l, cfg.AcceptRetryMaxBackoff, b.logger, retries)
+	}
+	if cfg.StallCheckInterval > 0 {
+		var stalls prometheus.Counter
+		if b.metricsEnabled {
+			var err error
+			if stalls, err = netutil.NewStalls(b.metricsRegisterer, "http", b.serviceName); err != nil {
+				b.logger.Error(err, "failed to register stall metrics; serving without them", "service", b.serviceName)
+			}
+		}
+		l = netutil.StallListener(l, cfg.StallCheckInterval, cfg.StallAction == "stop", b.logger, stalls)
+	}
+	return l, nil
+}
+
+// bind creates a listener on the address or, if it is "fd://" or the network
+// is "systemd", inherits one passed by systemd socket activation.
+func (b *Builder) bind(cfg Config, addr string) (net.Listener, error) {
+	if netutil.IsSystemdListener(cfg.Network, addr) {
+		l, err := netutil.SystemdListener(addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on addr for http server: %w", err)
+		}
+		return l, nil
+	}
+
+	unix := netutil.IsUnixNetwork(cfg.Network)
+	if unix {
+		if err := netutil.RemoveStaleSocket(cfg.Network, addr); err != nil {
+			return nil, err
+		}
+	}
+
+	// Sockets created by Listen are removed when the listener is closed.
+	l, err := net.Listen(cfg.Network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on addr for http server: %w", err)
+	}
+
+	if unix {
+		if err := netutil.ChmodChownSocket(addr, cfg.SocketMode, cfg.SocketOwner); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// ServeFromFlags serves the provided HTTP server on the provided listener,
+// typically created by ListenerFromFlags, and the address configured by the
+// "$PREFIX-legacy-addr" flag, shutting it down like ListenFromFlags.
+func (b *Builder) ServeFromFlags(cmd *cobra.Command, srv *http.Server, l net.Listener) error {
+	cfg, err := b.ConfigFromFlags(cmd)
+	if err != nil {
+		l.Close()
+		return err
+	}
+
+	listeners := []net.Listener{l}
+	if cfg.LegacyAddr != "" {
+		legacy, err := b.listen(cfg, cfg.LegacyAddr)
+		if err != nil {
+			l.Close()
+			return err
+		}
+		listeners = append(listeners, netutil.LegacyListener(legacy, time.Minute, b.logger))
+	}
+
+	if cfg.Insecure() {
 		b.logger.V(b.preRunLevel).Info(
 			"http server started serving",
-			"addr", srv.Addr,
+			"addr", l.Addr().String(),
+			"legacyAddr", cfg.LegacyAddr,
+			"network", cfg.Network,
 			"prefix", b.flagPrefix,
 			"scheme", "http",
 			"insecure", "true",
 		)
-		if err := srv.ListenAndServe(); err != nil && errors.Is(err, http.ErrServerClosed) {
-			return fmt.Errorf("failed while serving http: %w", err)
-		}
-		return nil
+		return b.serve(cmd.Context(), srv, cfg.ShutdownGracePeriod, srv.Serve, listeners, "http")
+	}
 
-	case certPath != "" && keyPath != "":
-		b.logger.V(b.preRunLevel).Info(
-			"http server started serving",
-			"addr", srv.Addr,
-			"prefix", b.flagPrefix,
-			"scheme", "https",
-			"insecure", "false",
-		)
-		if err := srv.ListenAndServeTLS(certPath, keyPath); err != nil && errors.Is(err, http.ErrServerClosed) {
-			return fmt.Errorf("failed while serving https: %w", err)
+	b.logger.V(b.preRunLevel).Info(
+		"http server started serving",
+		"addr", l.Addr().String(),
+		"legacyAddr", cfg.LegacyAddr,
+		"network", cfg.Network,
+		"prefix", b.flagPrefix,
+		"scheme", "https",
+		"insecure", "false",
+	)
+	serveTLS := func(l net.Listener) error { return srv.ServeTLS(l, cfg.TLSCertPath, cfg.TLSKeyPath) }
+	return b.serve(cmd.Context(), srv, cfg.ShutdownGracePeriod, serveTLS, listeners, "https")
+}
+
+// serve serves on every listener until the provided context is canceled and
+// the server has been shut down.
+func (b *Builder) serve(ctx context.Context, srv *http.Server, gracePeriod time.Duration, serve func(net.Listener) error, listeners []net.Listener, scheme string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	served := make(chan struct{})
+	shutdown := make(chan error, 1)
+	go func() {
+		select {
+		case <-served:
+			shutdown <- nil
+			return
+		case <-ctx.Done():
 		}
-		return nil
+		shutdown <- b.shutdown(srv, gracePeriod)
+	}()
 
-	default:
-		return fmt.Errorf(
-			"failed to start http server: must provide both --%s-tls-cert-path and --%s-tls-key-path",
-			b.flagPrefix,
-			b.flagPrefix,
-		)
+	// Serve returns as soon as shutting down begins, so the shutdown must
+	// also complete before returning.
+	err := netutil.ServeAll(serve, listeners...)
+	close(served)
+	shutdownErr := <-shutdown
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed while serving %s: %w", scheme, err)
 	}
+	return shutdownErr
+}
+
+// shutdown gracefully shuts down the server, closing any connections that
+// remain active after the grace period.
+func (b *Builder) shutdown(srv *http.Server, gracePeriod time.Duration) error {
+	b.logger.V(b.preRunLevel).Info("http server gracefully stopping", "prefix", b.flagPrefix, "gracePeriod", gracePeriod)
+	b.shuttingDown.Store(true)
+
+	ctx := context.Background()
+	if gracePeriod > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, gracePeriod)
+		defer cancel()
+	}
+
+	if err := srv.Shutdown(ctx); err != nil {
+		b.logger.Info("http server grace period elapsed; closing active connections", "prefix", b.flagPrefix)
+		if err := srv.Close(); err != nil {
+			return fmt.Errorf("failed to close http server: %w", err)
+		}
+	}
+	return nil
 }
 
 // WithLogger configures logging of the configured HTTP server environment.
@@ -137,6 +768,14 @@ func WithDefaultEnabled(enabled bool) Option {
 	return func(b *Builder) { b.defaultEnabled = enabled }
 }
 
+// WithDefaultHealthEnabled defines whether "/healthz" and "/readyz" are
+// served by default.
+//
+// Defaults to "false".
+func WithDefaultHealthEnabled(enabled bool) Option {
+	return func(b *Builder) { b.defaultHealth = enabled }
+}
+
 // WithFlagPrefix defines prefix used with the generated flags.
 //
 // Defaults to "http".
@@ -157,3 +796,85 @@ func WithPreRunLevel(preRunLevel int) Option {
 func WithHandler(handler http.Handler) Option {
 	return func(b *Builder) { b.handler = handler }
 }
+
+// WithRoute mounts a handler on the server at the provided pattern, which
+// uses the syntax of http.ServeMux. It can be provided more than once to mount
+// e.g. health checks, metrics, and profiling alongside the application.
+//
+// The handler defined by WithHandler, if any, serves the requests that match
+// no route unless a route is mounted at "/".
+//
+// No routes are mounted by default.
+func WithRoute(pattern string, handler http.Handler) Option {
+	return func(b *Builder) { b.routes = append(b.routes, route{pattern, handler}) }
+}
+
+// WithLivenessCheck adds a check served at "/healthz" and "/readyz" when the
+// "$PREFIX-health-enabled" flag is set, which should only fail when the
+// process must be restarted to recover.
+//
+// No liveness checks are used by default.
+func WithLivenessCheck(name string, check HealthCheck) Option {
+	return func(b *Builder) { b.livenessChecks = append(b.livenessChecks, namedCheck{name, check}) }
+}
+
+// WithReadinessCheck adds a check served at "/readyz" when the
+// "$PREFIX-health-enabled" flag is set, which should fail while the service
+// cannot handle requests, e.g. while a dependency is unavailable.
+//
+// Readiness also fails once the server begins shutting down, regardless of
+// the checks provided.
+//
+// No readiness checks are used by default.
+func WithReadinessCheck(name string, check HealthCheck) Option {
+	return func(b *Builder) { b.readinessChecks = append(b.readinessChecks, namedCheck{name, check}) }
+}
+
+// WithProfiling defines the "$PREFIX-pprof-enabled" flag as true by default,
+// serving the runtime profiles of net/http/pprof at "/debug/pprof/" unless
+// the flag is explicitly disabled.
+func WithProfiling() Option {
+	return func(b *Builder) { b.defaultPprof = true }
+}
+
+// WithStaticFS defines static assets served under the "$PREFIX-static-prefix"
+// flag, such as a dashboard embedded with go:embed. Files take precedence over
+// the handler defined by WithHandler.
+//
+// The "$PREFIX-static-dir" flag overrides these assets, e.g. to serve them
+// from disk during development.
+//
+// No static assets are served by default.
+func WithStaticFS(fsys fs.FS) Option {
+	return func(b *Builder) { b.static = fsys }
+}
+
+// WithMiddleware adds middleware wrapping the handler defined by WithHandler,
+// such as for logging, authentication, or recovering from panics. Middleware
+// is applied in the order provided, with the first outermost, and runs inside
+// the limits and timeouts configured by the flags.
+//
+// No middleware is used by default.
+func WithMiddleware(mw ...func(http.Handler) http.Handler) Option {
+	return func(b *Builder) { b.middleware = append(b.middleware, mw...) }
+}
+
+// WithMetrics records the count, duration, and response size of requests by
+// method, status code, and route, along with the number of requests in
+// flight, of the transient errors accepting connections that were retried, and
+// of the failed checks of "$PREFIX-stall-check-interval", in the provided
+// registerer. If the registerer is nil, prometheus.DefaultRegisterer is used.
+//
+// Routes are the patterns matched when routes are mounted by WithRoute or the
+// handler defined by WithHandler is an *http.ServeMux and are otherwise empty.
+//
+// Disabled by default.
+func WithMetrics(registerer prometheus.Registerer) Option {
+	return func(b *Builder) {
+		b.metricsEnabled = true
+		b.metricsRegisterer = registerer
+		if registerer == nil {
+			b.metricsRegisterer = prometheus.DefaultRegisterer
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package cobrahttp_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil/v2/cobrahttp"
+)
+
+func TestListenerFromFlags(t *testing.T) {
+	b := cobrahttp.New("api", cobrahttp.WithDefaultEnabled(true), cobrahttp.WithHandler(echoHandler))
+	cmd := &cobra.Command{Use: "mycmd", RunE: func(*cobra.Command, []string) error { return nil }}
+	b.RegisterFlags(cmd.Flags())
+	cmd.SetArgs([]string{"--http-addr", "127.0.0.1:0"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd.SetContext(ctx)
+
+	l, err := b.ListenerFromFlags(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error)
+	go func() { served <- b.ServeFromFlags(cmd, b.ServerFromFlags(cmd), l) }()
+
+	resp, err := http.Get("http://" + l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Fatalf("expected ok, got %q", body)
+	}
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type contextKey struct{}
+
+func TestBaseContext(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, hasServer := cobrahttp.ServerFromContext(r.Context())
+		addr, _ := cobrahttp.AddrFromContext(r.Context())
+		fmt.Fprintf(w, "%v %v %v", r.Context().Value(contextKey{}), hasServer, addr != nil)
+	})
+	b := cobrahttp.New("api", cobrahttp.WithDefaultEnabled(true), cobrahttp.WithHandler(handler))
+	cmd := &cobra.Command{Use: "mycmd", RunE: func(*cobra.Command, []string) error { return nil }}
+	b.RegisterFlags(cmd.Flags())
+	cmd.SetArgs([]string{"--http-addr", "127.0.0.1:0"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), contextKey{}, "value"))
+	defer cancel()
+	cmd.SetContext(ctx)
+
+	srv := b.ServerFromFlags(cmd)
+	l, err := b.ListenerFromFlags(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = b.ServeFromFlags(cmd, srv, l) }()
+
+	resp, err := http.Get("http://" + l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "value true true" {
+		t.Fatalf("expected the request context to carry the command's values and the server, got %q", body)
+	}
+}
+
+// listenFromFlags serves the handler with the listener created by
+// ListenerFromFlags from the provided flags and returns its address.
+func listenFromFlags(t *testing.T, args ...string) string {
+	t.Helper()
+
+	b := cobrahttp.New("api", cobrahttp.WithDefaultEnabled(true), cobrahttp.WithHandler(echoHandler))
+	cmd := &cobra.Command{Use: "mycmd"}
+	b.RegisterFlags(cmd.Flags())
+	if err := cmd.ParseFlags(append([]string{"--http-addr", "127.0.0.1:0"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := b.ListenerFromFlags(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := b.ServerFromFlags(cmd)
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	return l.Addr().String()
+}
+
+// request sends a request on conn and reads its response, waiting at most
+// timeout.
+func request(t *testing.T, conn net.Conn, r *bufio.Reader, timeout time.Duration) (*http.Response, error) {
+	t.Helper()
+
+	if _, err := fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: test\r\n\r\n"); err != nil {
+		return nil, err
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp, nil
+}
+
+func TestMaxConnections(t *testing.T) {
+	addr := listenFromFlags(t, "--http-max-connections=1")
+
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	if _, err := request(t, first, bufio.NewReader(first), 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second connection is established by the kernel but is not accepted
+	// while the first is kept alive.
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	r := bufio.NewReader(second)
+	if _, err := request(t, second, r, 200*time.Millisecond); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected the second connection to wait to be accepted, got %v", err)
+	}
+
+	first.Close()
+	if err := second.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatalf("expected the second connection to be accepted once the first closed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestKeepAlives(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		args  []string
+		close bool
+	}{
+		{"enabled", nil, false},
+		{"disabled", []string{"--http-keepalives-enabled=false"}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", listenFromFlags(t, tt.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			r := bufio.NewReader(conn)
+			resp, err := request(t, conn, r, 5*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// ReadResponse removes the "Connection: close" header, reporting
+			// it as Close.
+			if resp.Close != tt.close {
+				t.Fatalf("expected Connection: close to be sent: %t", tt.close)
+			}
+			if _, err := request(t, conn, r, 5*time.Second); (err != nil) != tt.close {
+				t.Fatalf("expected the connection to be reused: %t, got %v", !tt.close, err)
+			}
+		})
+	}
+}
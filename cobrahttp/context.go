@@ -0,0 +1,57 @@
+package cobrahttp
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+type serverKey struct{}
+
+type serverValue struct {
+	srv  *http.Server
+	addr net.Addr
+}
+
+// ContextWithServer returns a copy of the context carrying the provided
+// server and the address it is bound to.
+//
+// RunE stores the server it starts in the context of the command, so that
+// functions running after it, such as a PostRunE, can retrieve it.
+func ContextWithServer(ctx context.Context, srv *http.Server, addr net.Addr) context.Context {
+	return context.WithValue(ctx, serverKey{}, serverValue{srv: srv, addr: addr})
+}
+
+// ServerFromContext returns the server carried by the context, if any.
+func ServerFromContext(ctx context.Context) (*http.Server, bool) {
+	v, ok := ctx.Value(serverKey{}).(serverValue)
+	return v.srv, ok
+}
+
+// AddrFromContext returns the address of the server carried by the context,
+// if any, which includes the port chosen when listening on port 0.
+func AddrFromContext(ctx context.Context) (net.Addr, bool) {
+	v, ok := ctx.Value(serverKey{}).(serverValue)
+	return v.addr, ok
+}
+
+// baseContext returns a BaseContext for the server that carries the values of
+// ctx, typically the command's context, and the server itself.
+//
+// Requests are not canceled as soon as ctx is, which would fail those that
+// graceful shutdown waits on, but once the grace period after it elapses.
+// Handlers that must stop earlier, such as long-lived streams, can register
+// with the server's RegisterOnShutdown.
+func baseContext(ctx context.Context, srv *http.Server, gracePeriod time.Duration) func(net.Listener) context.Context {
+	base := context.WithoutCancel(ctx)
+	if gracePeriod > 0 {
+		var cancel context.CancelFunc
+		base, cancel = context.WithCancel(base)
+		context.AfterFunc(ctx, func() { time.AfterFunc(gracePeriod, cancel) })
+	}
+
+	return func(l net.Listener) context.Context {
+		return ContextWithServer(base, srv, l.Addr())
+	}
+}
@@ -0,0 +1,38 @@
+package cobrahttp_test
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil/v2"
+	"github.com/jzelinskie/cobrautil/v2/cobrahttp"
+	"github.com/jzelinskie/cobrautil/v2/cobraotel"
+	"github.com/jzelinskie/cobrautil/v2/cobrazerolog"
+)
+
+func ExampleBuilder_RunE() {
+	zl := cobrazerolog.New()
+	otel := cobraotel.New("myservice")
+	httpb := cobrahttp.New("myservice",
+		cobrahttp.WithDefaultEnabled(true),
+		cobrahttp.WithRoute("/hello", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "hello")
+		})),
+	)
+
+	cmd := &cobra.Command{
+		Use: "serve",
+		// The server blocks until the command's context is canceled, so it
+		// runs last.
+		RunE: cobrautil.CommandStack(
+			zl.RunE(),
+			otel.RunE(),
+			httpb.RunE(),
+		),
+	}
+	zl.RegisterFlags(cmd.Flags())
+	otel.RegisterFlags(cmd.Flags())
+	httpb.RegisterFlags(cmd.Flags())
+}
@@ -0,0 +1,50 @@
+package cobrahttp
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// ServerFromFlagsWithGRPC creates an *http.Server like ServerFromFlags that,
+// when the "$PREFIX-grpc-enabled" flag is set, also serves gRPC requests with
+// the provided handler, typically a *grpc.Server.
+//
+// This allows gRPC and HTTP to share a single port, e.g. behind load balancers
+// that only expose one. Plaintext servers accept HTTP/2 without TLS (h2c) so
+// that gRPC clients can connect. The gRPC server should not be started on its
+// own listener and its TLS configuration is unused: the TLS configuration and
+// the read and write timeouts of the HTTP server apply to all requests.
+func (b *Builder) ServerFromFlagsWithGRPC(cmd *cobra.Command, grpcHandler http.Handler) *http.Server {
+	cfg := b.config(cmd)
+	srv := b.ServerFromFlags(cmd)
+	if !cfg.GRPCEnabled {
+		return srv
+	}
+
+	// gRPC requests bypass the handler timeouts and body size limit, which
+	// cannot support streaming, and the authentication configured by flags,
+	// which gRPC servers configure with their own interceptors.
+	srv.Handler = withGRPC(grpcHandler, srv.Handler)
+	if cfg.Insecure() {
+		srv.Handler = h2c.NewHandler(srv.Handler, &http2.Server{})
+	}
+	return srv
+}
+
+// withGRPC routes gRPC requests to grpcHandler and all others to next.
+func withGRPC(grpcHandler, next http.Handler) http.Handler {
+	if next == nil {
+		next = http.DefaultServeMux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcHandler.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
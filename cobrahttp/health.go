@@ -0,0 +1,83 @@
+package cobrahttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// HealthCheck reports whether a component of the service is healthy by
+// returning nil.
+//
+// The context is that of the probing request.
+type HealthCheck func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check HealthCheck
+}
+
+// withHealth serves "/healthz" and "/readyz" and passes every other request
+// to handler.
+//
+// Liveness checks are served by both endpoints, while readiness checks and
+// the state of graceful shutdown only affect "/readyz".
+func (b *Builder) withHealth(handler http.Handler) http.Handler {
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			serveChecks(w, r, b.livenessChecks)
+		case "/readyz":
+			shutdown := namedCheck{"shutdown", b.checkNotShuttingDown}
+			serveChecks(w, r, []namedCheck{shutdown}, b.livenessChecks, b.readinessChecks)
+		default:
+			handler.ServeHTTP(w, r)
+		}
+	})
+}
+
+func (b *Builder) checkNotShuttingDown(context.Context) error {
+	if b.shuttingDown.Load() {
+		return fmt.Errorf("%s is shutting down", b.serviceName)
+	}
+	return nil
+}
+
+// serveChecks runs every check of each group and responds 200 if all of them
+// pass or 503 otherwise.
+//
+// The result of each check is listed when any of them fail or the "verbose"
+// query parameter is provided.
+func serveChecks(w http.ResponseWriter, r *http.Request, groups ...[]namedCheck) {
+	var results strings.Builder
+	failed := false
+	for _, checks := range groups {
+		for _, c := range checks {
+			if err := c.check(r.Context()); err != nil {
+				failed = true
+				fmt.Fprintf(&results, "[-]%s failed: %s\n", c.name, err)
+				continue
+			}
+			fmt.Fprintf(&results, "[+]%s ok\n", c.name)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if failed {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, results.String())
+		fmt.Fprintln(w, "unhealthy")
+		return
+	}
+
+	if r.URL.Query().Has("verbose") {
+		fmt.Fprint(w, results.String())
+	}
+	fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,56 @@
+package cobrahttp_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil/v2/cobrahttp"
+)
+
+func TestHealth(t *testing.T) {
+	var dbDown atomic.Bool
+	b := cobrahttp.New("api",
+		cobrahttp.WithHandler(echoHandler),
+		cobrahttp.WithReadinessCheck("db", func(context.Context) error {
+			if dbDown.Load() {
+				return errors.New("connection refused")
+			}
+			return nil
+		}),
+	)
+	cmd := &cobra.Command{Use: "mycmd", RunE: func(*cobra.Command, []string) error { return nil }}
+	b.RegisterFlags(cmd.Flags())
+	cmd.SetArgs([]string{"--http-health-enabled"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	handler := b.ServerFromFlags(cmd).Handler
+
+	probe := func(path string) (int, string) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	if code, body := probe("/readyz"); code != http.StatusOK || body != "ok\n" {
+		t.Fatalf("expected ready, got %d: %q", code, body)
+	}
+
+	dbDown.Store(true)
+	if code, body := probe("/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "[-]db failed: connection refused") {
+		t.Fatalf("expected not ready, got %d: %q", code, body)
+	}
+	if code, _ := probe("/healthz"); code != http.StatusOK {
+		t.Fatalf("expected live, got %d", code)
+	}
+	if code, body := probe("/"); code != http.StatusOK || body != "ok" {
+		t.Fatalf("expected the handler to serve other paths, got %d: %q", code, body)
+	}
+}
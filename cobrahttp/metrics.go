@@ -0,0 +1,111 @@
+package cobrahttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// httpMetrics are the rate, error, and duration metrics of the requests
+// handled by a server.
+type httpMetrics struct {
+	requests     *prometheus.CounterVec
+	duration     *prometheus.HistogramVec
+	inFlight     prometheus.Gauge
+	responseSize *prometheus.HistogramVec
+}
+
+// newHTTPMetrics registers the metrics of the server named serviceName.
+//
+// Metrics already registered by another server with the same name, such as
+// one created by an earlier call to ServerFromFlags, are shared.
+func newHTTPMetrics(registerer prometheus.Registerer, serviceName string) (*httpMetrics, error) {
+	labels := prometheus.Labels{"server": serviceName}
+	routeLabels := []string{"method", "code", "route"}
+
+	var err error
+	m := &httpMetrics{}
+	if m.requests, err = registerOrExisting(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "http_server_requests_total",
+		Help:        "Total number of HTTP requests handled.",
+		ConstLabels: labels,
+	}, routeLabels)); err != nil {
+		return nil, err
+	}
+	if m.duration, err = registerOrExisting(registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        "http_server_request_duration_seconds",
+		Help:        "Time taken to handle HTTP requests.",
+		ConstLabels: labels,
+		Buckets:     prometheus.DefBuckets,
+	}, routeLabels)); err != nil {
+		return nil, err
+	}
+	if m.inFlight, err = registerOrExisting(registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "http_server_requests_in_flight",
+		Help:        "Number of HTTP requests currently being handled.",
+		ConstLabels: labels,
+	})); err != nil {
+		return nil, err
+	}
+	if m.responseSize, err = registerOrExisting(registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        "http_server_response_size_bytes",
+		Help:        "Size of the bodies of HTTP responses.",
+		ConstLabels: labels,
+		Buckets:     prometheus.ExponentialBuckets(100, 10, 7),
+	}, routeLabels)); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func registerOrExisting[T prometheus.Collector](registerer prometheus.Registerer, collector T) (T, error) {
+	err := registerer.Register(collector)
+	if err == nil {
+		return collector, nil
+	}
+
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		if existing, ok := registered.ExistingCollector.(T); ok {
+			return existing, nil
+		}
+	}
+	return collector, err
+}
+
+type routeKey struct{}
+
+// Wrap records the metrics of the requests handled by handler.
+//
+// Requests are labeled with the pattern they match in mux, which keeps the
+// number of series bounded, or with an empty route if mux is nil.
+func (m *httpMetrics) Wrap(handler http.Handler, mux *http.ServeMux) http.Handler {
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+
+	route := promhttp.WithLabelFromCtx("route", func(ctx context.Context) string {
+		route, _ := ctx.Value(routeKey{}).(string)
+		return route
+	})
+	instrumented := promhttp.InstrumentHandlerInFlight(m.inFlight,
+		promhttp.InstrumentHandlerDuration(m.duration,
+			promhttp.InstrumentHandlerCounter(m.requests,
+				promhttp.InstrumentHandlerResponseSize(m.responseSize, handler, route),
+				route,
+			),
+			route,
+		),
+	)
+
+	if mux == nil {
+		return instrumented
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		instrumented.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), routeKey{}, pattern)))
+	})
+}
@@ -0,0 +1,44 @@
+package cobrahttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil/v2/cobrahttp"
+)
+
+func TestMetrics(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/echo/", echoHandler)
+
+	registry := prometheus.NewRegistry()
+	b := cobrahttp.New("api", cobrahttp.WithHandler(mux), cobrahttp.WithMetrics(registry))
+	cmd := &cobra.Command{Use: "mycmd", RunE: func(*cobra.Command, []string) error { return nil }}
+	b.RegisterFlags(cmd.Flags())
+	cmd.SetArgs([]string{"--http-handler-timeout", "50ms"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Servers created by the same builder share their metrics.
+	for _, path := range []string{"/echo/a", "/echo/b?sleep=100ms"} {
+		srv := b.ServerFromFlags(cmd)
+		srv.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	expected := `
+# HELP http_server_requests_total Total number of HTTP requests handled.
+# TYPE http_server_requests_total counter
+http_server_requests_total{code="200",method="get",route="/echo/",server="api"} 1
+http_server_requests_total{code="503",method="get",route="/echo/",server="api"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "http_server_requests_total"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,169 @@
+package cobrahttp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pprofPrefix is the path under which profiles are served, which is where
+// "go tool pprof" expects to find them.
+const pprofPrefix = "/debug/pprof/"
+
+// withProfiling serves the endpoints of net/http/pprof under "/debug/pprof/"
+// and passes every other request to handler.
+//
+// Profiles that would take longer to record than writeTimeout are rejected
+// rather than cut off, like net/http/pprof does. The timeout is provided
+// because the server's WriteTimeout is zero when it is applied to each request
+// instead, e.g. when WebSockets are enabled.
+//
+// net/http/pprof is intentionally not imported because doing so registers
+// its handlers on http.DefaultServeMux, which would expose them on any server
+// using it regardless of the flags.
+func withProfiling(handler http.Handler, writeTimeout time.Duration) http.Handler {
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := strings.CutPrefix(r.URL.Path, pprofPrefix)
+		if !ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		switch name {
+		case "":
+			servePprofIndex(w)
+		case "cmdline":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprint(w, strings.Join(os.Args, "\x00"))
+		case "profile":
+			servePprofDuration(w, r, writeTimeout, 30, "CPU profile", "profile", pprof.StartCPUProfile, pprof.StopCPUProfile)
+		case "symbol":
+			servePprofSymbol(w, r)
+		case "trace":
+			servePprofDuration(w, r, writeTimeout, 1, "execution trace", "trace", trace.Start, trace.Stop)
+		default:
+			servePprofProfile(w, r, name)
+		}
+	})
+}
+
+func servePprofIndex(w http.ResponseWriter) {
+	profiles := pprof.Profiles()
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name() < profiles[j].Name() })
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, "<html><head><title>/debug/pprof/</title></head><body>\n<table>\n")
+	for _, p := range profiles {
+		name := html.EscapeString(p.Name())
+		fmt.Fprintf(w, "<tr><td>%d</td><td><a href=\"%s?debug=1\">%s</a></td></tr>\n", p.Count(), name, name)
+	}
+	for _, name := range []string{"cmdline", "profile", "symbol", "trace"} {
+		fmt.Fprintf(w, "<tr><td></td><td><a href=\"%s\">%s</a></td></tr>\n", name, name)
+	}
+	fmt.Fprint(w, "</table>\n</body></html>\n")
+}
+
+// servePprofDuration records a profile for the number of seconds in the query,
+// defaulting to defaultSeconds like net/http/pprof: 30 for CPU profiles and 1
+// for execution traces.
+func servePprofDuration(w http.ResponseWriter, r *http.Request, writeTimeout time.Duration, defaultSeconds float64, description, filename string, start func(w io.Writer) error, stop func()) {
+	seconds, err := strconv.ParseFloat(r.FormValue("seconds"), 64)
+	if err != nil || seconds <= 0 {
+		seconds = defaultSeconds
+	}
+	duration := time.Duration(seconds * float64(time.Second))
+
+	if writeTimeout > 0 && duration >= writeTimeout {
+		http.Error(w, "profile duration exceeds the server's write timeout", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if err := start(w); err != nil {
+		// Only one CPU profile or trace may be recorded at a time.
+		w.Header().Del("Content-Disposition")
+		http.Error(w, fmt.Sprintf("could not enable %s: %s", description, err), http.StatusInternalServerError)
+		return
+	}
+
+	select {
+	case <-time.After(duration):
+	case <-r.Context().Done():
+	}
+	stop()
+}
+
+// servePprofSymbol looks up the names of the functions containing the program
+// counters in the request, which are separated by "+" in the body of a POST
+// or in the query of a GET, and reports that symbols are available otherwise.
+func servePprofSymbol(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	// The response is buffered because the status cannot be changed once the
+	// body is written, which is how net/http/pprof reports read errors.
+	var buf bytes.Buffer
+	fmt.Fprint(&buf, "num_symbols: 1\n")
+
+	var in *bufio.Reader
+	if r.Method == http.MethodPost {
+		in = bufio.NewReader(r.Body)
+	} else {
+		in = bufio.NewReader(strings.NewReader(r.URL.RawQuery))
+	}
+	for {
+		word, err := in.ReadSlice('+')
+		if err == nil {
+			word = word[:len(word)-1] // Trim the "+".
+		}
+		if pc, _ := strconv.ParseUint(string(word), 0, 64); pc != 0 {
+			if f := runtime.FuncForPC(uintptr(pc)); f != nil {
+				fmt.Fprintf(&buf, "%#x %s\n", pc, f.Name())
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(&buf, "reading request: %v\n", err)
+			}
+			break
+		}
+	}
+	_, _ = w.Write(buf.Bytes())
+}
+
+func servePprofProfile(w http.ResponseWriter, r *http.Request, name string) {
+	p := pprof.Lookup(name)
+	if p == nil {
+		http.Error(w, "unknown profile", http.StatusNotFound)
+		return
+	}
+
+	if name == "heap" && r.FormValue("gc") != "" {
+		runtime.GC()
+	}
+
+	debug, _ := strconv.Atoi(r.FormValue("debug"))
+	if debug != 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	}
+	_ = p.WriteTo(w, debug)
+}
@@ -0,0 +1,100 @@
+package cobrahttp_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestPprofSymbol(t *testing.T) {
+	addr := serveFromFlags(t, "--http-pprof-enabled")
+
+	pc := reflect.ValueOf(TestPprofSymbol).Pointer()
+	name := runtime.FuncForPC(pc).Name()
+
+	if code, body := get(t, "http://"+addr+"/debug/pprof/symbol"); code != http.StatusOK || body != "num_symbols: 1\n" {
+		t.Fatalf("expected symbols to be available, got %d: %q", code, body)
+	}
+
+	code, body := get(t, fmt.Sprintf("http://%s/debug/pprof/symbol?%#x+0", addr, pc))
+	if expected := fmt.Sprintf("num_symbols: 1\n%#x %s\n", pc, name); code != http.StatusOK || body != expected {
+		t.Fatalf("expected %q, got %d: %q", expected, code, body)
+	}
+
+	resp, err := http.Post("http://"+addr+"/debug/pprof/symbol", "text/plain", strings.NewReader(fmt.Sprintf("%#x", pc)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	posted, _ := io.ReadAll(resp.Body)
+	if !strings.HasSuffix(string(posted), name+"\n") {
+		t.Fatalf("expected %s, got %q", name, posted)
+	}
+}
+
+func TestPprofDurations(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		args     []string
+		path     string
+		expected int
+	}{
+		{
+			name:     "trace defaults to 1s",
+			args:     []string{"--http-write-timeout=5s"},
+			path:     "/debug/pprof/trace",
+			expected: http.StatusOK,
+		},
+		{
+			name:     "profile defaults to 30s",
+			args:     []string{"--http-write-timeout=5s"},
+			path:     "/debug/pprof/profile",
+			expected: http.StatusBadRequest,
+		},
+		{
+			name:     "exceeds write timeout",
+			args:     []string{"--http-write-timeout=1s"},
+			path:     "/debug/pprof/trace?seconds=2",
+			expected: http.StatusBadRequest,
+		},
+		{
+			name:     "exceeds write timeout of each request",
+			args:     []string{"--http-write-timeout=1s", "--http-websocket-enabled"},
+			path:     "/debug/pprof/trace?seconds=2",
+			expected: http.StatusBadRequest,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := serveFromFlags(t, append([]string{"--http-pprof-enabled"}, tt.args...)...)
+
+			start := time.Now()
+			code, body := get(t, "http://"+addr+tt.path)
+			if code != tt.expected {
+				t.Fatalf("expected %d, got %d: %q", tt.expected, code, body)
+			}
+			if code == http.StatusOK && time.Since(start) > 3*time.Second {
+				t.Fatalf("expected the trace to be recorded for 1s, took %s", time.Since(start))
+			}
+		})
+	}
+}
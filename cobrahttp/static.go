@@ -0,0 +1,76 @@
+package cobrahttp
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// staticFS returns the static assets that are served, preferring the
+// "$PREFIX-static-dir" flag over those provided by WithStaticFS.
+func (b *Builder) staticFS(cfg Config) fs.FS {
+	if cfg.StaticDir != "" {
+		return os.DirFS(cfg.StaticDir)
+	}
+	return b.static
+}
+
+// withStatic serves the files in fsys under prefix and passes every other
+// request to handler.
+//
+// If spaFallback is true, requests from browsers for files that do not exist
+// are served "index.html" so that single-page applications can handle their
+// own routes. Requests that do not accept HTML, such as those to APIs, are
+// still passed to handler.
+func withStatic(handler http.Handler, fsys fs.FS, prefix string, spaFallback bool) http.Handler {
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+
+	prefix = strings.TrimSuffix(prefix, "/")
+	fileServer := http.StripPrefix(prefix, http.FileServer(http.FS(fsys)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := strings.CutPrefix(r.URL.Path, prefix+"/")
+		if !ok || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		switch {
+		case fileExists(fsys, path.Clean("/" + name)[1:]):
+			fileServer.ServeHTTP(w, r)
+		case spaFallback && acceptsHTML(r) && fileExists(fsys, "index.html"):
+			http.ServeFileFS(w, r, fsys, "index.html")
+		default:
+			handler.ServeHTTP(w, r)
+		}
+	})
+}
+
+// fileExists returns true if name is a file or a directory containing an
+// "index.html" in fsys, so that directories are never listed.
+func fileExists(fsys fs.FS, name string) bool {
+	if name == "" {
+		name = "."
+	}
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return false
+	}
+	if info.IsDir() {
+		return fileExists(fsys, path.Join(name, "index.html"))
+	}
+	return true
+}
+
+func acceptsHTML(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept") {
+		if strings.Contains(value, "text/html") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package cobrahttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil/v2/cobrahttp"
+)
+
+func TestStatic(t *testing.T) {
+	assets := fstest.MapFS{
+		"index.html":  {Data: []byte("index")},
+		"app.js":      {Data: []byte("app")},
+		"empty/a.txt": {Data: []byte("a")},
+	}
+	b := cobrahttp.New("dashboard", cobrahttp.WithHandler(echoHandler), cobrahttp.WithStaticFS(assets))
+	cmd := &cobra.Command{Use: "mycmd", RunE: func(*cobra.Command, []string) error { return nil }}
+	b.RegisterFlags(cmd.Flags())
+	cmd.SetArgs([]string{"--http-static-prefix", "/ui/", "--http-spa-fallback"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.ConfigFromFlags(cmd); err != nil {
+		t.Fatal(err)
+	}
+	handler := b.ServerFromFlags(cmd).Handler
+
+	for _, tt := range []struct {
+		path     string
+		accept   string
+		expected string
+	}{
+		{"/ui/app.js", "", "app"},
+		{"/ui/", "text/html", "index"},
+		{"/ui/settings/profile", "text/html,application/xhtml+xml", "index"},
+		{"/ui/settings/profile", "application/json", "ok"},
+		{"/ui/empty/", "", "ok"},
+		{"/api/users", "text/html", "ok"},
+	} {
+		t.Run(tt.path+" "+tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if body := rec.Body.String(); body != tt.expected {
+				t.Fatalf("expected %q, got %d: %q", tt.expected, rec.Code, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package cobrahttp
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// isUpgrade returns true if the request is asking to upgrade the connection
+// to another protocol, such as WebSockets.
+func isUpgrade(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withHandlerTimeout responds 503 to requests that are not handled within
+// the timeout.
+//
+// If exemptUpgrades is true, requests to upgrade the connection are passed
+// directly to the handler because the ResponseWriter used to enforce the
+// timeout cannot be hijacked.
+func withHandlerTimeout(handler http.Handler, timeout time.Duration, exemptUpgrades bool) http.Handler {
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+
+	timeoutHandler := http.TimeoutHandler(handler, timeout, "")
+	if !exemptUpgrades {
+		return timeoutHandler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isUpgrade(r) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		timeoutHandler.ServeHTTP(w, r)
+	})
+}
+
+// withWriteTimeout sets a deadline for writing the response to each request
+// that is not asking to upgrade the connection.
+func withWriteTimeout(handler http.Handler, timeout time.Duration) http.Handler {
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isUpgrade(r) {
+			_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout))
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,85 @@
+package cobrahttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// clientAuthTypes maps the values of the "$PREFIX-client-auth" flag to the
+// corresponding policy.
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require-and-verify": tls.RequireAndVerifyClientCert,
+}
+
+// tlsVersions maps the values of the "$PREFIX-tls-min-version" flag to the
+// corresponding versions.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsCurves maps the values of the "$PREFIX-tls-curves" flag to the
+// corresponding curves.
+var tlsCurves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// tlsConfig creates the TLS configuration of the server from the TLS policy
+// and client certificate flags, leaving the defaults of crypto/tls in place
+// for those that are unset.
+func (c Config) tlsConfig() (*tls.Config, error) {
+	minVersion, ok := tlsVersions[c.TLSMinVersion]
+	if !ok {
+		return nil, fmt.Errorf(`unknown TLS version %q: must be one of "1.0", "1.1", "1.2", "1.3"`, c.TLSMinVersion)
+	}
+	cfg := &tls.Config{MinVersion: minVersion, ClientAuth: clientAuthTypes[c.ClientAuth]}
+
+	if c.ClientCAPath != "" {
+		caPEM, err := os.ReadFile(c.ClientCAPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		cfg.ClientCAs = x509.NewCertPool()
+		if !cfg.ClientCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("failed to parse client CA: %s", c.ClientCAPath)
+		}
+	}
+
+	// Only secure cipher suites can be configured; the suites of TLS 1.3 are
+	// not configurable.
+	suites := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite.ID
+	}
+	for _, name := range c.TLSCiphers {
+		id, ok := suites[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure TLS cipher suite: %s", name)
+		}
+		cfg.CipherSuites = append(cfg.CipherSuites, id)
+	}
+
+	for _, name := range c.TLSCurves {
+		id, ok := tlsCurves[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf(`unknown TLS curve %q: must be one of "X25519", "P256", "P384", "P521"`, name)
+		}
+		cfg.CurvePreferences = append(cfg.CurvePreferences, id)
+	}
+
+	if len(c.ACMEDomains) > 0 {
+		configureACME(cfg, newACMEManager(c.ACMEDomains, c.ACMECacheDir, c.ACMEDirectoryURL))
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,142 @@
+package cobrahttp_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil/v2/cobrahttp"
+)
+
+// echoHandler echoes everything sent on upgraded connections and otherwise
+// responds after sleeping for the duration in the "sleep" query parameter.
+var echoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Upgrade") == "" {
+		if sleep, err := time.ParseDuration(r.URL.Query().Get("sleep")); err == nil {
+			time.Sleep(sleep)
+		}
+		fmt.Fprint(w, "ok")
+		return
+	}
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	fmt.Fprint(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+	if err := brw.Flush(); err != nil {
+		return
+	}
+	_, _ = io.Copy(conn, brw)
+})
+
+// serveFromFlags starts the server configured by the provided flags on a
+// random local port and returns its address.
+func serveFromFlags(t *testing.T, args ...string) string {
+	t.Helper()
+
+	b := cobrahttp.New("test", cobrahttp.WithHandler(echoHandler))
+	cmd := &cobra.Command{Use: "test"}
+	b.RegisterFlags(cmd.Flags())
+	if err := cmd.Flags().Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := b.ServerFromFlags(cmd)
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	return l.Addr().String()
+}
+
+// upgrade dials the server and upgrades the connection, returning the
+// response status code.
+func upgrade(t *testing.T, addr string) (net.Conn, *bufio.Reader, int) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n", addr)
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, br, resp.StatusCode
+}
+
+func TestWebSocketEchoSurvivesTimeouts(t *testing.T) {
+	addr := serveFromFlags(t,
+		"--http-websocket-enabled",
+		"--http-read-timeout=100ms",
+		"--http-write-timeout=100ms",
+		"--http-handler-timeout=100ms",
+	)
+
+	conn, br, status := upgrade(t, addr)
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("expected status %d, got %d", http.StatusSwitchingProtocols, status)
+	}
+
+	for i := 0; i < 3; i++ {
+		// Outlive every configured timeout between messages.
+		time.Sleep(150 * time.Millisecond)
+
+		msg := fmt.Sprintf("ping %d\n", i)
+		if _, err := fmt.Fprint(conn, msg); err != nil {
+			t.Fatal(err)
+		}
+
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != msg {
+			t.Fatalf("expected echo %q, got %q", msg, line)
+		}
+	}
+}
+
+func TestWebSocketDisabledCannotUpgradeWithHandlerTimeout(t *testing.T) {
+	addr := serveFromFlags(t, "--http-handler-timeout=100ms")
+
+	if _, _, status := upgrade(t, addr); status == http.StatusSwitchingProtocols {
+		t.Fatal("expected upgrade to fail through the handler timeout")
+	}
+}
+
+func TestWebSocketEnabledStillTimesOutRequests(t *testing.T) {
+	addr := serveFromFlags(t,
+		"--http-websocket-enabled",
+		"--http-handler-timeout=100ms",
+	)
+
+	resp, err := http.Get("http://" + addr + "/?sleep=300ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+}
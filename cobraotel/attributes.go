@@ -0,0 +1,96 @@
+package cobraotel
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// newAttributeDenylistProcessor creates a SpanProcessor that strips or hashes
+// the values of any span attributes with keys matching one of the provided
+// patterns before forwarding the span to the next processor.
+func newAttributeDenylistProcessor(next trace.SpanProcessor, patterns []string, action string) (trace.SpanProcessor, error) {
+	if action != "strip" && action != "hash" {
+		return nil, fmt.Errorf("unknown attribute denylist action: %s", action)
+	}
+
+	denylist := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid attribute denylist pattern %q: %w", pattern, err)
+		}
+		denylist = append(denylist, re)
+	}
+
+	return &attributeDenylistProcessor{next: next, denylist: denylist, hash: action == "hash"}, nil
+}
+
+type attributeDenylistProcessor struct {
+	next     trace.SpanProcessor
+	denylist []*regexp.Regexp
+	hash     bool
+}
+
+var _ trace.SpanProcessor = (*attributeDenylistProcessor)(nil)
+
+func (p *attributeDenylistProcessor) OnStart(parent context.Context, s trace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p *attributeDenylistProcessor) OnEnd(s trace.ReadOnlySpan) {
+	p.next.OnEnd(p.scrub(s))
+}
+
+func (p *attributeDenylistProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p *attributeDenylistProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+func (p *attributeDenylistProcessor) denied(key attribute.Key) bool {
+	for _, re := range p.denylist {
+		if re.MatchString(string(key)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *attributeDenylistProcessor) scrub(s trace.ReadOnlySpan) trace.ReadOnlySpan {
+	attrs := s.Attributes()
+	scrubbed := make([]attribute.KeyValue, 0, len(attrs))
+	var modified bool
+	for _, kv := range attrs {
+		if !p.denied(kv.Key) {
+			scrubbed = append(scrubbed, kv)
+			continue
+		}
+
+		modified = true
+		if p.hash {
+			sum := sha256.Sum256([]byte(kv.Value.Emit()))
+			scrubbed = append(scrubbed, kv.Key.String(hex.EncodeToString(sum[:])))
+		}
+	}
+
+	if !modified {
+		return s
+	}
+	return scrubbedSpan{ReadOnlySpan: s, attrs: scrubbed}
+}
+
+// scrubbedSpan overrides the attributes of a ReadOnlySpan.
+type scrubbedSpan struct {
+	trace.ReadOnlySpan
+	attrs []attribute.KeyValue
+}
+
+func (s scrubbedSpan) Attributes() []attribute.KeyValue { return s.attrs }
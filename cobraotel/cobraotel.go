@@ -4,25 +4,41 @@ package cobraotel
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
+	"net/url"
+	"os"
 	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/go-logr/logr"
 	"github.com/jzelinskie/cobrautil/v2"
+	"github.com/jzelinskie/cobrautil/v2/internal/otelctx"
 	"github.com/jzelinskie/stringz"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
 	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
 	"go.opentelemetry.io/contrib/propagators/ot"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 // Option is function used to configure OpenTelemetry within a Cobra RunFunc.
@@ -40,6 +56,16 @@ func New(serviceName string, opts ...Option) *Builder {
 		serviceName: stringz.DefaultEmpty(serviceName, bi.Main.Path),
 		preRunLevel: 0,
 		logger:      logr.Discard(),
+		spanLimits:  trace.NewSpanLimits(),
+		strict:      true,
+		legacyFlags: true,
+		registry:    prometheus.NewRegistry(),
+
+		defaultProvider:    "none",
+		defaultSampleRatio: 0.01,
+	}
+	if ok {
+		b.serviceVersion = cobrautil.VersionWithFallbacks(bi)
 	}
 	for _, configure := range opts {
 		configure(b)
@@ -53,8 +79,43 @@ type Builder struct {
 	serviceName string
 	logger      logr.Logger
 	preRunLevel int
+	detectors   []resource.Detector
+	named       map[string]resource.Detector
+	spanLimits  trace.SpanLimits
+	processors  []trace.SpanProcessor
+	wrappers    []SpanProcessorWrapper
+	idGenerator trace.IDGenerator
+	strict      bool
+	legacyFlags bool
+	registry    *prometheus.Registry
+	views       []metric.View
+	status      tracingStatus
+	shutdowns   shutdowns
+	sampler     dynamicSampler
+	flusher     *cobrautil.Flusher
+
+	serviceVersion        string
+	deploymentEnvironment string
+
+	defaultProvider    string
+	defaultEndpoint    string
+	defaultSampleRatio float64
+
+	defaultForceSampleKey string
+
+	defaultSpanNameDenylist  []string
+	defaultAttributeDenylist []string
+	defaultMetricsDrop       []string
 }
 
+var (
+	providers        = []string{"none", "otlp", "otlphttp", "otlpgrpc", "stdout"}
+	propagators      = []string{"b3", "w3c", "ottrace", "xray", "jaeger"}
+	metricsProviders = []string{"none", "prometheus"}
+	idGenerators     = []string{"default", "xray"}
+	builtinDetectors = []string{"host", "os", "process", "container"}
+)
+
 func (b *Builder) prefix(s string) string {
 	return cobrautil.PrefixJoiner(b.flagPrefix)(s)
 }
@@ -67,39 +128,110 @@ func (b *Builder) prefix(s string) string {
 // - "$PREFIX-insecure"
 // - "$PREFIX-endpoint"
 // - "$PREFIX-service-name"
+// - "$PREFIX-service-version"
+// - "$PREFIX-deployment-environment"
+// - "$PREFIX-resource-detectors"
+// - "$PREFIX-span-name-denylist"
+// - "$PREFIX-attribute-denylist"
+// - "$PREFIX-attribute-denylist-action"
+// - "$PREFIX-span-attribute-count-limit"
+// - "$PREFIX-span-attribute-value-length-limit"
+// - "$PREFIX-span-event-count-limit"
+// - "$PREFIX-span-link-count-limit"
+// - "$PREFIX-metrics-provider"
+// - "$PREFIX-runtime-metrics"
+// - "$PREFIX-metrics-drop"
+// - "$PREFIX-metrics-rename"
+// - "$PREFIX-metrics-histogram-boundaries"
+// - "$PREFIX-baggage"
+// - "$PREFIX-force-sample-key"
+// - "$PREFIX-id-generator"
 func (b *Builder) RegisterFlags(flags *pflag.FlagSet) {
-	flags.String(b.prefix("provider"), "none", `OpenTelemetry provider for tracing ("none", "otlphttp", "otlpgrpc")`)
-	flags.String(b.prefix("endpoint"), "", "OpenTelemetry collector endpoint - the endpoint can also be set by using enviroment variables")
+	flags.String(b.prefix("provider"), b.defaultProvider, `OpenTelemetry providers for tracing ("none", "otlp", "otlphttp", "otlpgrpc", "stdout"); "otlp" detects the protocol from the environment or endpoint. Add multiple providers separated by comma to export to all of them.`)
+	flags.String(b.prefix("endpoint"), b.defaultEndpoint, `OpenTelemetry collector endpoint ("unix:///path/to/socket" for a unix socket with "otlpgrpc") - the endpoint can also be set by using enviroment variables`)
 	flags.String(b.prefix("service-name"), b.serviceName, "service name for trace data")
-	flags.String(b.prefix("trace-propagator"), "w3c", `OpenTelemetry trace propagation format ("b3", "w3c", "ottrace"). Add multiple propagators separated by comma.`)
+	flags.String(b.prefix("service-version"), b.serviceVersion, "service version for trace data (omitted if empty)")
+	flags.String(b.prefix("deployment-environment"), b.deploymentEnvironment, `name of the deployment environment (e.g. "staging", "production") for trace data (omitted if empty)`)
+	flags.String(b.prefix("trace-propagator"), "w3c", `OpenTelemetry trace propagation format ("b3", "w3c", "ottrace", "xray", "jaeger"). Add multiple propagators separated by comma.`)
 	flags.Bool(b.prefix("insecure"), false, `connect to the OpenTelemetry collector in plaintext`)
-	flags.Float64(b.prefix("sample-ratio"), 0.01, "ratio of traces that are sampled")
+	flags.Float64(b.prefix("sample-ratio"), b.defaultSampleRatio, "ratio of traces that are sampled")
+	flags.String(b.prefix("resource-detectors"), "", "OpenTelemetry resource detectors used to describe the process ("+quoteAll(b.detectorNames())+"). Add multiple detectors separated by comma.")
+	flags.StringSlice(b.prefix("span-name-denylist"), b.defaultSpanNameDenylist, `glob patterns matching the names of spans that are dropped before export (e.g. "*/Check")`)
+	flags.StringArray(b.prefix("attribute-denylist"), b.defaultAttributeDenylist, "regular expression matching span attribute keys that are scrubbed before export. Repeat the flag for multiple expressions.")
+	flags.String(b.prefix("attribute-denylist-action"), "strip", `how span attributes matching the denylist are scrubbed ("strip", "hash")`)
+	flags.Int(b.prefix("span-attribute-count-limit"), b.spanLimits.AttributeCountLimit, "maximum number of attributes per span (negative for unlimited)")
+	flags.Int(b.prefix("span-attribute-value-length-limit"), b.spanLimits.AttributeValueLengthLimit, "maximum length of span attribute values (negative for unlimited)")
+	flags.Int(b.prefix("span-event-count-limit"), b.spanLimits.EventCountLimit, "maximum number of events per span (negative for unlimited)")
+	flags.Int(b.prefix("span-link-count-limit"), b.spanLimits.LinkCountLimit, "maximum number of links per span (negative for unlimited)")
+	flags.String(b.prefix("metrics-provider"), "none", `OpenTelemetry provider for metrics ("none", "prometheus")`)
+	flags.Bool(b.prefix("runtime-metrics"), false, "collect Go runtime, process CPU, and host CPU and memory metrics (host metrics on Linux only) when a metrics provider is configured")
+	flags.StringSlice(b.prefix("metrics-drop"), b.defaultMetricsDrop, `glob patterns matching the names of instruments whose metrics are dropped (e.g. "rpc.server.*")`)
+	flags.StringToString(b.prefix("metrics-rename"), nil, `instruments renamed before export (e.g. "http.server.duration=http.duration")`)
+	flags.StringArray(b.prefix("metrics-histogram-boundaries"), nil, `explicit bucket boundaries of the histograms matching a glob pattern (e.g. "http.server.*=0.005,0.05,0.5,5"). Repeat the flag for multiple patterns; the first match is used.`)
+	flags.StringToString(b.prefix("baggage"), nil, "W3C baggage members (key=value) propagated by every trace started from the command's context")
+	flags.String(b.prefix("force-sample-key"), b.defaultForceSampleKey, "baggage key (or request header with ForceSampleMiddleware) that forces traces to be sampled regardless of the sample ratio (disabled if empty)")
+	flags.String(b.prefix("id-generator"), "default", `generator of trace and span IDs ("default", "xray"); "default" uses the generator from WithIDGenerator or random IDs`)
 
-	// Legacy flags! Will eventually be dropped!
-	flags.String("otel-jaeger-endpoint", "", "OpenTelemetry collector endpoint - the endpoint can also be set by using enviroment variables")
-	if err := flags.MarkHidden("otel-jaeger-endpoint"); err != nil {
-		panic("failed to mark flag hidden: " + err.Error())
-	}
-	flags.String("otel-jaeger-service-name", b.serviceName, "service name for trace data")
-	if err := flags.MarkHidden("otel-jaeger-service-name"); err != nil {
-		panic("failed to mark flag hidden: " + err.Error())
+	if b.legacyFlags {
+		for alias, target := range map[string]string{
+			"otel-jaeger-endpoint":     b.prefix("endpoint"),
+			"otel-jaeger-service-name": b.prefix("service-name"),
+		} {
+			if err := cobrautil.RegisterDeprecatedAlias(flags, alias, target); err != nil {
+				panic(err.Error())
+			}
+		}
 	}
 }
 
+// RegisterNamedFlags adds the flags from RegisterFlags() to the "OpenTelemetry"
+// section of the provided NamedFlagSets.
+func (b *Builder) RegisterNamedFlags(nfs *cobrautil.NamedFlagSets) {
+	b.RegisterFlags(nfs.FlagSet("OpenTelemetry"))
+}
+
 // RegisterFlagCompletion adds completion functions supported flags.
 //
 // The following flags are completed:
 // - "$PREFIX-provider"
 // - "$PREFIX-trace-propagator"
+// - "$PREFIX-resource-detectors"
+// - "$PREFIX-attribute-denylist-action"
+// - "$PREFIX-metrics-provider"
+// - "$PREFIX-id-generator"
 func (b *Builder) RegisterFlagCompletion(cmd *cobra.Command) error {
 	if err := cmd.RegisterFlagCompletionFunc(b.prefix("provider"), func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return []string{"none", "otlphttp", "otlpgrpc"}, cobra.ShellCompDirectiveDefault
+		return providers, cobra.ShellCompDirectiveDefault
 	}); err != nil {
 		return err
 	}
 
 	if err := cmd.RegisterFlagCompletionFunc(b.prefix("trace-propagator"), func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return []string{"b3", "w3c", "ottrace"}, cobra.ShellCompDirectiveDefault
+		return propagators, cobra.ShellCompDirectiveDefault
+	}); err != nil {
+		return err
+	}
+
+	if err := cmd.RegisterFlagCompletionFunc(b.prefix("resource-detectors"), func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return b.detectorNames(), cobra.ShellCompDirectiveDefault
+	}); err != nil {
+		return err
+	}
+
+	if err := cmd.RegisterFlagCompletionFunc(b.prefix("attribute-denylist-action"), func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"strip", "hash"}, cobra.ShellCompDirectiveDefault
+	}); err != nil {
+		return err
+	}
+
+	if err := cmd.RegisterFlagCompletionFunc(b.prefix("metrics-provider"), func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return metricsProviders, cobra.ShellCompDirectiveDefault
+	}); err != nil {
+		return err
+	}
+
+	if err := cmd.RegisterFlagCompletionFunc(b.prefix("id-generator"), func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return idGenerators, cobra.ShellCompDirectiveDefault
 	}); err != nil {
 		return err
 	}
@@ -107,6 +239,120 @@ func (b *Builder) RegisterFlagCompletion(cmd *cobra.Command) error {
 	return nil
 }
 
+// Config is the configuration of OpenTelemetry resolved from the flags
+// registered by RegisterFlags().
+type Config struct {
+	Providers               []string
+	ProviderSource          Source
+	Endpoint                string
+	EndpointSource          Source
+	ServiceName             string
+	ServiceVersion          string
+	DeploymentEnvironment   string
+	Insecure                bool
+	InsecureSource          Source
+	Propagators             []string
+	Sampler                 string
+	SampleRatio             float64
+	SamplerSource           Source
+	ResourceDetectors       []string
+	SpanNameDenylist        []string
+	AttributeDenylist       []string
+	AttributeDenylistAction string
+	SpanLimits              trace.SpanLimits
+	MetricsProvider         string
+	RuntimeMetrics          bool
+	Baggage                 map[string]string
+	ForceSampleKey          string
+	IDGenerator             string
+
+	// Metric views, where the first of MetricsHistogramBoundaries matching an
+	// instrument is used.
+	MetricsDrop                []string
+	MetricsRename              map[string]string
+	MetricsHistogramBoundaries []HistogramBoundaries
+}
+
+// ConfigFromFlags resolves the configuration of OpenTelemetry from the flags
+// registered by RegisterFlags() without configuring anything.
+func (b *Builder) ConfigFromFlags(cmd *cobra.Command) (Config, error) {
+	cfg := Config{
+		Providers:               splitNonEmpty(strings.ToLower(cobrautil.MustGetString(cmd, b.prefix("provider")))),
+		Endpoint:                cobrautil.MustGetString(cmd, b.prefix("endpoint")),
+		ServiceName:             cobrautil.MustGetString(cmd, b.prefix("service-name")),
+		ServiceVersion:          cobrautil.MustGetString(cmd, b.prefix("service-version")),
+		DeploymentEnvironment:   cobrautil.MustGetString(cmd, b.prefix("deployment-environment")),
+		Insecure:                cobrautil.MustGetBool(cmd, b.prefix("insecure")),
+		Propagators:             splitNonEmpty(cobrautil.MustGetString(cmd, b.prefix("trace-propagator"))),
+		Sampler:                 "parentbased_traceidratio",
+		SampleRatio:             cobrautil.MustGetFloat64(cmd, b.prefix("sample-ratio")),
+		ResourceDetectors:       splitNonEmpty(cobrautil.MustGetString(cmd, b.prefix("resource-detectors"))),
+		SpanNameDenylist:        cobrautil.MustGetStringSlice(cmd, b.prefix("span-name-denylist")),
+		AttributeDenylist:       cobrautil.MustGetStringArray(cmd, b.prefix("attribute-denylist")),
+		AttributeDenylistAction: cobrautil.MustGetString(cmd, b.prefix("attribute-denylist-action")),
+		MetricsProvider:         strings.ToLower(cobrautil.MustGetString(cmd, b.prefix("metrics-provider"))),
+		RuntimeMetrics:          cobrautil.MustGetBool(cmd, b.prefix("runtime-metrics")),
+		Baggage:                 cobrautil.MustGetStringToString(cmd, b.prefix("baggage")),
+		ForceSampleKey:          cobrautil.MustGetString(cmd, b.prefix("force-sample-key")),
+		IDGenerator:             strings.ToLower(cobrautil.MustGetString(cmd, b.prefix("id-generator"))),
+		SpanLimits:              b.spanLimits,
+	}
+	cfg.SpanLimits.AttributeCountLimit = cobrautil.MustGetInt(cmd, b.prefix("span-attribute-count-limit"))
+	cfg.SpanLimits.AttributeValueLengthLimit = cobrautil.MustGetInt(cmd, b.prefix("span-attribute-value-length-limit"))
+	cfg.SpanLimits.EventCountLimit = cobrautil.MustGetInt(cmd, b.prefix("span-event-count-limit"))
+	cfg.SpanLimits.LinkCountLimit = cobrautil.MustGetInt(cmd, b.prefix("span-link-count-limit"))
+
+	if err := b.validate(&cfg); err != nil {
+		return Config{}, err
+	}
+
+	if err := b.metricViewsFromFlags(cmd, &cfg); err != nil {
+		return Config{}, err
+	}
+
+	if err := b.resolveFromEnv(cmd, &cfg); err != nil {
+		return Config{}, err
+	}
+
+	if reason, ok := cfg.exportsPlaintext(); ok && cobrautil.TLSRequired(cmd) {
+		return Config{}, fmt.Errorf("failed to configure tracing: TLS is required but %s", reason)
+	}
+
+	return cfg, nil
+}
+
+// exportsPlaintext returns why any of the OTLP providers export spans
+// without TLS, if they do.
+//
+// Besides the insecure flag and environment variables, the exporters never
+// encrypt connections to unix sockets and connect in plaintext to endpoints
+// with the "http" scheme, which can only be provided by the environment.
+func (c Config) exportsPlaintext() (string, bool) {
+	if !c.exportsOTLP() {
+		return "", false
+	}
+	if _, ok := unixSocketPath(c.Endpoint); ok {
+		return fmt.Sprintf("connections to the unix socket endpoint %s are never encrypted", c.Endpoint), true
+	}
+	if u, err := url.Parse(c.Endpoint); err == nil && strings.EqualFold(u.Scheme, "http") {
+		return fmt.Sprintf("the endpoint %s configured by %s uses plaintext HTTP", c.Endpoint, c.EndpointSource), true
+	}
+	if c.Insecure {
+		return fmt.Sprintf("exporting insecurely was configured by %s", c.InsecureSource), true
+	}
+	return "", false
+}
+
+// exportsOTLP returns true if any of the providers export via OTLP.
+func (c Config) exportsOTLP() bool {
+	for _, p := range c.Providers {
+		if strings.HasPrefix(p, "otlp") {
+			return true
+		}
+	}
+	return false
+}
+
 // RunE returns a Cobra run func that configures the
 // corresponding otel provider from a command.
 //
@@ -118,99 +364,377 @@ func (b *Builder) RunE() cobrautil.CobraRunFunc {
 			return nil // No-op for builtins
 		}
 
-		provider := strings.ToLower(cobrautil.MustGetString(cmd, b.prefix("provider")))
-		serviceName := cobrautil.MustGetString(cmd, b.prefix("service-name"))
-		endpoint := cobrautil.MustGetString(cmd, b.prefix("endpoint"))
-		insecure := cobrautil.MustGetBool(cmd, b.prefix("insecure"))
-		propagators := strings.Split(cobrautil.MustGetString(cmd, b.prefix("trace-propagator")), ",")
-		sampleRatio := cobrautil.MustGetFloat64(cmd, b.prefix("sample-ratio"))
+		cfg, err := b.ConfigFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
 		var noLogger logr.Logger
 		if b.logger != noLogger {
 			otel.SetLogger(b.logger)
 		}
 
-		var exporter trace.SpanExporter
-		var err error
-
-		// If endpoint is not set, the clients are configured via the OpenTelemetry environment variables or
-		// default values.
-		// See: https://github.com/open-telemetry/opentelemetry-go/tree/main/exporters/otlp/otlptrace#environment-variables
-		// or https://github.com/open-telemetry/opentelemetry-go/tree/main/exporters/jaeger#environment-variables
-		switch provider {
-		case "none":
-			// Nothing.
-		case "otlphttp":
-			var opts []otlptracehttp.Option
-			if endpoint != "" {
-				opts = append(opts, otlptracehttp.WithEndpoint(endpoint))
-			}
-			if insecure {
-				opts = append(opts, otlptracehttp.WithInsecure())
-			}
-			exporter, err = otlptrace.New(context.Background(), otlptracehttp.NewClient(opts...))
-			if err != nil {
-				return err
+		// Processors provided via WithSpanProcessors are installed even when
+		// no provider is configured to export spans.
+		if len(cfg.Providers) > 0 || len(b.processors) > 0 {
+			exporters := make([]trace.SpanExporter, 0, len(cfg.Providers))
+			for _, provider := range cfg.Providers {
+				exporter, err := b.exporter(cfg, provider)
+				if err != nil {
+					return err
+				}
+				exporters = append(exporters, exporter)
 			}
 
-			if err := initOtelTracer(exporter, serviceName, propagators, sampleRatio); err != nil {
+			if err := b.initOtelTracer(exporters, cfg); err != nil {
 				return err
 			}
-		case "otlpgrpc":
-			var opts []otlptracegrpc.Option
-			if endpoint != "" {
-				opts = append(opts, otlptracegrpc.WithEndpoint(endpoint))
-			}
-			if insecure {
-				opts = append(opts, otlptracegrpc.WithInsecure())
+
+			// Make the provider available to the other builders.
+			ctx := cmd.Context()
+			if ctx == nil {
+				ctx = context.Background()
 			}
+			cmd.SetContext(otelctx.WithTracerProvider(ctx, otel.GetTracerProvider()))
+		}
 
-			exporter, err = otlptrace.New(context.Background(), otlptracegrpc.NewClient(opts...))
-			if err != nil {
+		if cfg.MetricsProvider != "none" {
+			if err := b.initOtelMeter(cfg); err != nil {
 				return err
 			}
+		}
 
-			if err := initOtelTracer(exporter, serviceName, propagators, sampleRatio); err != nil {
+		if len(cfg.Baggage) > 0 {
+			if err := setBaggage(cmd, cfg.Baggage); err != nil {
 				return err
 			}
-		default:
-			return fmt.Errorf("unknown tracing provider: %s", provider)
 		}
 
+		if b.flusher != nil {
+			b.flusher.Register("opentelemetry", b.Shutdown)
+		}
+
+		b.status.setConfig(cfg)
+
 		b.logger.V(b.preRunLevel).Info(
 			"configured opentelemetry tracing",
-			"provider", provider,
-			"endpoint", endpoint,
-			"service", serviceName,
-			"insecure", insecure,
-			"sampleRatio", sampleRatio,
+			"providers", cfg.Providers,
+			"providerSource", cfg.ProviderSource,
+			"endpoint", cfg.Endpoint,
+			"endpointSource", cfg.EndpointSource,
+			"service", cfg.ServiceName,
+			"serviceVersion", cfg.ServiceVersion,
+			"deploymentEnvironment", cfg.DeploymentEnvironment,
+			"insecure", cfg.Insecure,
+			"insecureSource", cfg.InsecureSource,
+			"sampler", cfg.Sampler,
+			"sampleRatio", cfg.SampleRatio,
+			"samplerSource", cfg.SamplerSource,
+			"forceSampleKey", cfg.ForceSampleKey,
+			"idGenerator", cfg.IDGenerator,
+			"resourceDetectors", cfg.ResourceDetectors,
+			"spanNameDenylist", cfg.SpanNameDenylist,
+			"attributeDenylist", cfg.AttributeDenylist,
+			"metricsProvider", cfg.MetricsProvider,
+			"runtimeMetrics", cfg.RuntimeMetrics,
+			"metricsDrop", cfg.MetricsDrop,
+			"metricsRename", cfg.MetricsRename,
+			"metricsHistogramBoundaries", cfg.MetricsHistogramBoundaries,
+			"baggage", cfg.Baggage,
 		)
 		return nil
 	}
 }
 
-func initOtelTracer(exporter trace.SpanExporter, serviceName string, propagators []string, sampleRatio float64) error {
-	res, err := resource.New(
-		context.Background(),
-		resource.WithAttributes(semconv.ServiceNameKey.String(serviceName)),
-		resource.WithFromEnv(),
-		resource.WithTelemetrySDK(),
-	)
+// exporter creates the SpanExporter for the provided provider.
+//
+// If endpoint is not set, the clients are configured via the OpenTelemetry environment variables or
+// default values.
+// See: https://github.com/open-telemetry/opentelemetry-go/tree/main/exporters/otlp/otlptrace#environment-variables
+func (b *Builder) exporter(cfg Config, provider string) (trace.SpanExporter, error) {
+	// Endpoints from the environment are URLs parsed by the exporters.
+	endpoint := cfg.Endpoint
+	if cfg.EndpointSource == SourceEnv {
+		endpoint = ""
+	}
+
+	switch provider {
+	case "stdout":
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+
+	case "otlphttp":
+		if _, ok := unixSocketPath(endpoint); ok {
+			return nil, fmt.Errorf("failed to configure tracing: unix socket endpoints are only supported by the otlpgrpc provider: %s", endpoint)
+		}
+
+		var opts []otlptracehttp.Option
+		if endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		} else if cfg.InsecureSource == SourceFlag {
+			// Explicitly override any insecure environment variable.
+			opts = append(opts, otlptracehttp.WithTLSClientConfig(&tls.Config{MinVersion: tls.VersionTLS12}))
+		}
+		return otlptrace.New(context.Background(), otlptracehttp.NewClient(opts...))
+
+	case "otlpgrpc":
+		var opts []otlptracegrpc.Option
+		if path, ok := unixSocketPath(endpoint); ok {
+			// Connections to node-local collectors over unix sockets are
+			// never encrypted.
+			opts = append(opts,
+				otlptracegrpc.WithEndpoint("localhost"),
+				otlptracegrpc.WithInsecure(),
+				otlptracegrpc.WithDialOption(grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", path)
+				})),
+			)
+			return otlptrace.New(context.Background(), otlptracegrpc.NewClient(opts...))
+		}
+
+		if endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		} else if cfg.InsecureSource == SourceFlag {
+			// Explicitly override any insecure environment variable.
+			opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})))
+		}
+		return otlptrace.New(context.Background(), otlptracegrpc.NewClient(opts...))
+
+	default:
+		return nil, fmt.Errorf("unknown tracing provider: %s", provider)
+	}
+}
+
+func (b *Builder) initOtelTracer(exporters []trace.SpanExporter, cfg Config) error {
+	res, err := b.resource(cfg)
 	if err != nil {
 		return err
 	}
 
-	otel.SetTracerProvider(trace.NewTracerProvider(
-		trace.WithSampler(trace.ParentBased(trace.TraceIDRatioBased(sampleRatio))),
-		trace.WithBatcher(exporter),
+	b.sampler.store(sampler(cfg.Sampler, cfg.SampleRatio))
+	var s trace.Sampler = &b.sampler
+	if cfg.ForceSampleKey != "" {
+		s = forceSampler{key: cfg.ForceSampleKey, next: s}
+	}
+
+	opts := []trace.TracerProviderOption{
+		trace.WithSampler(s),
 		trace.WithResource(res),
-	))
-	setTracePropagators(propagators)
+		trace.WithRawSpanLimits(cfg.SpanLimits),
+	}
+	switch {
+	case cfg.IDGenerator == "xray":
+		opts = append(opts, trace.WithIDGenerator(xray.NewIDGenerator()))
+	case b.idGenerator != nil:
+		opts = append(opts, trace.WithIDGenerator(b.idGenerator))
+	}
+	for _, p := range b.processors {
+		opts = append(opts, trace.WithSpanProcessor(p))
+	}
+
+	// Each exporter is batched independently so that a slow or failing
+	// exporter does not delay the others.
+	for _, exporter := range exporters {
+		processor := trace.NewBatchSpanProcessor(statusExporter{SpanExporter: exporter, status: &b.status})
+		for i := len(b.wrappers) - 1; i >= 0; i-- {
+			processor = b.wrappers[i](processor)
+		}
+		if len(cfg.AttributeDenylist) > 0 {
+			processor, err = newAttributeDenylistProcessor(processor, cfg.AttributeDenylist, cfg.AttributeDenylistAction)
+			if err != nil {
+				return err
+			}
+		}
+		if len(cfg.SpanNameDenylist) > 0 {
+			processor, err = newSpanNameDenylistProcessor(processor, cfg.SpanNameDenylist)
+			if err != nil {
+				return err
+			}
+		}
+		opts = append(opts, trace.WithSpanProcessor(processor))
+	}
+
+	tp := trace.NewTracerProvider(opts...)
+	b.shutdowns.add(tp.Shutdown)
+	otel.SetTracerProvider(tp)
+	setTracePropagators(cfg.Propagators)
+	b.status.setResource(res)
+
+	return nil
+}
+
+// resource builds the Resource describing the process from the service name,
+// version, and deployment environment, the environment, the named detectors,
+// and any detectors provided via WithResourceDetectors.
+func (b *Builder) resource(cfg Config) (*resource.Resource, error) {
+	attrs := []attribute.KeyValue{semconv.ServiceNameKey.String(cfg.ServiceName)}
+	if cfg.ServiceVersion != "" {
+		attrs = append(attrs, semconv.ServiceVersionKey.String(cfg.ServiceVersion))
+	}
+	if cfg.DeploymentEnvironment != "" {
+		attrs = append(attrs, semconv.DeploymentEnvironmentKey.String(cfg.DeploymentEnvironment))
+	}
+
+	opts := []resource.Option{
+		resource.WithAttributes(attrs...),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	}
+
+	for _, d := range cfg.ResourceDetectors {
+		switch d {
+		case "host":
+			opts = append(opts, resource.WithHost())
+		case "os":
+			opts = append(opts, resource.WithOS())
+		case "process":
+			opts = append(opts, resource.WithProcess())
+		case "container":
+			opts = append(opts, resource.WithContainer())
+		default:
+			opts = append(opts, resource.WithDetectors(b.named[d]))
+		}
+	}
+
+	if len(b.detectors) > 0 {
+		opts = append(opts, resource.WithDetectors(b.detectors...))
+	}
+
+	return resource.New(context.Background(), opts...)
+}
+
+func splitNonEmpty(s string) []string {
+	var xs []string
+	for _, x := range strings.Split(s, ",") {
+		if x = strings.TrimSpace(x); x != "" {
+			xs = append(xs, x)
+		}
+	}
+	return xs
+}
+
+// validate checks that the provider, resource detectors, and propagators are
+// supported.
+//
+// In lenient mode, an unknown provider disables tracing and unknown
+// propagators fall back to W3C, logging a warning instead of failing.
+func (b *Builder) validate(cfg *Config) error {
+	// "none" is only meaningful on its own, so it is dropped from the list.
+	enabled := make([]string, 0, len(cfg.Providers))
+	for _, p := range cfg.Providers {
+		switch {
+		case p == "none":
+		case stringz.SliceContains(providers, p):
+			enabled = append(enabled, p)
+		case b.strict:
+			return unsupportedValueError(b.prefix("provider"), p, providers)
+		default:
+			b.logger.Info("unknown tracing provider; ignoring", "provider", p, "allowed", providers)
+		}
+	}
+	cfg.Providers = enabled
+
+	if !stringz.SliceContains(metricsProviders, cfg.MetricsProvider) {
+		if b.strict {
+			return unsupportedValueError(b.prefix("metrics-provider"), cfg.MetricsProvider, metricsProviders)
+		}
+		b.logger.Info("unknown metrics provider; metrics are disabled", "provider", cfg.MetricsProvider, "allowed", metricsProviders)
+		cfg.MetricsProvider = "none"
+	}
+
+	if !stringz.SliceContains(idGenerators, cfg.IDGenerator) {
+		if b.strict {
+			return unsupportedValueError(b.prefix("id-generator"), cfg.IDGenerator, idGenerators)
+		}
+		b.logger.Info("unknown ID generator; falling back to default", "generator", cfg.IDGenerator, "allowed", idGenerators)
+		cfg.IDGenerator = "default"
+	}
+
+	names := b.detectorNames()
+	detectors := make([]string, 0, len(cfg.ResourceDetectors))
+	for _, d := range cfg.ResourceDetectors {
+		switch {
+		case stringz.SliceContains(names, d):
+			detectors = append(detectors, d)
+		case b.strict:
+			return unsupportedValueError(b.prefix("resource-detectors"), d, names)
+		default:
+			b.logger.Info("unknown resource detector; ignoring", "detector", d, "allowed", names)
+		}
+	}
+	cfg.ResourceDetectors = detectors
+
+	if len(cfg.Propagators) == 0 {
+		cfg.Propagators = []string{"w3c"}
+	}
+	for _, p := range cfg.Propagators {
+		if !stringz.SliceContains(propagators, p) {
+			if b.strict {
+				return unsupportedValueError(b.prefix("trace-propagator"), p, propagators)
+			}
+			b.logger.Info("unknown trace propagator; falling back to w3c", "propagator", p, "allowed", propagators)
+		}
+	}
 
 	return nil
 }
 
+func unsupportedValueError(flag, value string, allowed []string) error {
+	return fmt.Errorf("invalid --%s %q: must be one of %s", flag, value, quoteAll(allowed))
+}
+
+func quoteAll(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, strconv.Quote(v))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// detectorNames returns the names accepted by the "$PREFIX-resource-detectors"
+// flag: the detectors of the SDK followed by those provided via
+// WithNamedResourceDetector.
+func (b *Builder) detectorNames() []string {
+	names := make([]string, 0, len(builtinDetectors)+len(b.named))
+	names = append(names, builtinDetectors...)
+	for name := range b.named {
+		names = append(names, name)
+	}
+	sort.Strings(names[len(builtinDetectors):])
+	return names
+}
+
+// setBaggage adds the provided W3C baggage members to the command's context so
+// that they are propagated by everything derived from it.
+func setBaggage(cmd *cobra.Command, members map[string]string) error {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	bag := baggage.FromContext(ctx)
+	for key, value := range members {
+		m, err := baggage.NewMember(key, url.QueryEscape(value))
+		if err != nil {
+			return fmt.Errorf("invalid baggage member %s: %w", key, err)
+		}
+		if bag, err = bag.SetMember(m); err != nil {
+			return fmt.Errorf("invalid baggage member %s: %w", key, err)
+		}
+	}
+
+	cmd.SetContext(baggage.ContextWithBaggage(ctx, bag))
+	return nil
+}
+
 // setTextMapPropagator sets the OpenTelemetry trace propagation format.
-// Currently it supports b3, ot-trace and w3c.
+// Currently it supports b3, ot-trace, xray, jaeger and w3c.
 func setTracePropagators(propagators []string) {
 	var tmPropagators []propagation.TextMapPropagator
 
@@ -220,6 +744,10 @@ func setTracePropagators(propagators []string) {
 			tmPropagators = append(tmPropagators, b3.New())
 		case "ottrace":
 			tmPropagators = append(tmPropagators, ot.OT{})
+		case "xray":
+			tmPropagators = append(tmPropagators, xray.Propagator{})
+		case "jaeger":
+			tmPropagators = append(tmPropagators, jaeger.Jaeger{})
 		case "w3c":
 			fallthrough
 		default:
@@ -238,6 +766,80 @@ func WithLogger(logger logr.Logger) Option {
 	return func(b *Builder) { b.logger = logger }
 }
 
+// WithServiceVersion sets the default value of the "$PREFIX-service-version"
+// flag.
+//
+// Defaults to the version from cobrautil.VersionWithFallbacks.
+func WithServiceVersion(version string) Option {
+	return func(b *Builder) { b.serviceVersion = version }
+}
+
+// WithDeploymentEnvironment sets the default value of the
+// "$PREFIX-deployment-environment" flag.
+//
+// Defaults to an empty string, which omits the attribute.
+func WithDeploymentEnvironment(environment string) Option {
+	return func(b *Builder) { b.deploymentEnvironment = environment }
+}
+
+// WithDefaultProvider sets the default value of the "$PREFIX-provider" flag.
+//
+// Defaults to "none".
+func WithDefaultProvider(provider string) Option {
+	return func(b *Builder) { b.defaultProvider = provider }
+}
+
+// WithDefaultEndpoint sets the default value of the "$PREFIX-endpoint" flag.
+//
+// Defaults to an empty string, which uses the OpenTelemetry environment
+// variables or the exporter's default endpoint.
+func WithDefaultEndpoint(endpoint string) Option {
+	return func(b *Builder) { b.defaultEndpoint = endpoint }
+}
+
+// WithDefaultSampleRatio sets the default value of the "$PREFIX-sample-ratio"
+// flag.
+//
+// Defaults to 0.01.
+func WithDefaultSampleRatio(ratio float64) Option {
+	return func(b *Builder) { b.defaultSampleRatio = ratio }
+}
+
+// WithSpanNameDenylist sets the default value of the
+// "$PREFIX-span-name-denylist" flag, such as the names of health check spans.
+//
+// Defaults to no patterns.
+func WithSpanNameDenylist(patterns ...string) Option {
+	return func(b *Builder) { b.defaultSpanNameDenylist = patterns }
+}
+
+// WithAttributeDenylist sets the default value of the
+// "$PREFIX-attribute-denylist" flag.
+//
+// Defaults to no patterns.
+func WithAttributeDenylist(patterns ...string) Option {
+	return func(b *Builder) { b.defaultAttributeDenylist = patterns }
+}
+
+// WithoutLegacyFlags disables the registration of the deprecated
+// "otel-jaeger-endpoint" and "otel-jaeger-service-name" aliases of the
+// "$PREFIX-endpoint" and "$PREFIX-service-name" flags.
+//
+// New programs should use this to avoid carrying flags that were only kept
+// for compatibility.
+func WithoutLegacyFlags() Option {
+	return func(b *Builder) { b.legacyFlags = false }
+}
+
+// WithLenientValidation configures unknown providers and propagators to be
+// ignored with a warning rather than returning an error.
+//
+// An unknown provider disables tracing and unknown propagators fall back to
+// W3C.
+func WithLenientValidation() Option {
+	return func(b *Builder) { b.strict = false }
+}
+
 // WithFlagPrefix defines prefix used with the generated flags.
 //
 // Defaults to "log".
@@ -251,3 +853,72 @@ func WithFlagPrefix(flagPrefix string) Option {
 func WithPreRunLevel(preRunLevel int) Option {
 	return func(b *Builder) { b.preRunLevel = preRunLevel }
 }
+
+// WithResourceDetectors adds detectors used to populate the Resource attached
+// to all traces, such as the cloud provider detectors found in
+// go.opentelemetry.io/contrib/detectors.
+//
+// These are always run, in addition to any selected with the
+// "$PREFIX-resource-detectors" flag.
+func WithResourceDetectors(detectors ...resource.Detector) Option {
+	return func(b *Builder) { b.detectors = append(b.detectors, detectors...) }
+}
+
+// WithNamedResourceDetector allows the detector to be selected with the
+// "$PREFIX-resource-detectors" flag under the provided name.
+//
+// Cloud provider detectors are not built in to avoid depending on them, so
+// "aws" or "gcp" are only accepted once registered, for example:
+//
+//	cobraotel.WithNamedResourceDetector("aws", ec2.NewResourceDetector())
+func WithNamedResourceDetector(name string, detector resource.Detector) Option {
+	return func(b *Builder) {
+		if b.named == nil {
+			b.named = make(map[string]resource.Detector)
+		}
+		b.named[name] = detector
+	}
+}
+
+// WithIDGenerator defines the generator of trace and span IDs used when the
+// "$PREFIX-id-generator" flag is "default".
+//
+// Defaults to the random generator of the OpenTelemetry SDK.
+func WithIDGenerator(generator trace.IDGenerator) Option {
+	return func(b *Builder) { b.idGenerator = generator }
+}
+
+// WithSpanLimits defines the default limits applied to spans, which can be
+// overridden by flags.
+//
+// Defaults to trace.NewSpanLimits(), which respects the OTEL_SPAN_* and
+// OTEL_ATTRIBUTE_* environment variables.
+func WithSpanLimits(limits trace.SpanLimits) Option {
+	return func(b *Builder) { b.spanLimits = limits }
+}
+
+// WithSpanProcessors adds SpanProcessors to the pipeline constructed by the
+// builder.
+//
+// The processors are registered alongside the processors that export spans,
+// so they observe every span but cannot prevent it from being exported. Use
+// WithSpanProcessorWrappers to filter, redact, or tail-sample spans. If any
+// processors are provided, a TracerProvider is installed even if the provider
+// is "none".
+func WithSpanProcessors(processors ...trace.SpanProcessor) Option {
+	return func(b *Builder) { b.processors = append(b.processors, processors...) }
+}
+
+// SpanProcessorWrapper wraps the SpanProcessor that exports spans, returning
+// a SpanProcessor that decides which spans are forwarded to next and how.
+type SpanProcessorWrapper func(next trace.SpanProcessor) trace.SpanProcessor
+
+// WithSpanProcessorWrappers wraps the processor of each exporter, such as to
+// filter, redact, or tail-sample spans before they are exported.
+//
+// The first wrapper receives spans first. Spans dropped or scrubbed by the
+// "$PREFIX-span-name-denylist" and "$PREFIX-attribute-denylist" flags are
+// handled before reaching any wrapper.
+func WithSpanProcessorWrappers(wrappers ...SpanProcessorWrapper) Option {
+	return func(b *Builder) { b.wrappers = append(b.wrappers, wrappers...) }
+}
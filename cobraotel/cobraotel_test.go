@@ -0,0 +1,168 @@
+package cobraotel
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+// configFromArgs resolves the configuration of b from the provided
+// arguments.
+func configFromArgs(t *testing.T, b *Builder, args ...string) (Config, error) {
+	t.Helper()
+
+	cmd := &cobra.Command{Use: "test"}
+	b.RegisterFlags(cmd.Flags())
+	if err := cmd.ParseFlags(args); err != nil {
+		t.Fatal(err)
+	}
+	return b.ConfigFromFlags(cmd)
+}
+
+// dropProcessor drops spans with the provided name.
+type dropProcessor struct {
+	trace.SpanProcessor
+	name string
+}
+
+func (p dropProcessor) OnEnd(s trace.ReadOnlySpan) {
+	if s.Name() == p.name {
+		return
+	}
+	p.SpanProcessor.OnEnd(s)
+}
+
+func TestWithSpanProcessorWrappers(t *testing.T) {
+	prevProvider := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prevProvider) })
+
+	b := New("test", WithSpanProcessorWrappers(func(next trace.SpanProcessor) trace.SpanProcessor {
+		return dropProcessor{SpanProcessor: next, name: "dropped"}
+	}))
+	cfg, err := configFromArgs(t, b, "--otel-sample-ratio=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exporter := tracetest.NewInMemoryExporter()
+	if err := b.initOtelTracer([]trace.SpanExporter{exporter}, cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = b.Shutdown(context.Background()) })
+
+	tracer := otel.Tracer("test")
+	for _, name := range []string{"dropped", "kept"} {
+		_, span := tracer.Start(context.Background(), name)
+		span.End()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := otel.GetTracerProvider().(*trace.TracerProvider).ForceFlush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "kept" {
+		t.Fatalf("expected only the kept span to be exported, got %v", spans.Snapshots())
+	}
+}
+
+// cloudDetector detects the provided cloud provider.
+func cloudDetector(provider string) resource.Detector {
+	return resource.StringDetector("", semconv.CloudProviderKey, func() (string, error) { return provider, nil })
+}
+
+func TestResourceDetectorsFlag(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		opts      []Option
+		value     string
+		expected  []string
+		err       string
+		cloudAttr string
+	}{
+		{
+			name:     "builtin",
+			value:    "host,process",
+			expected: []string{"host", "process"},
+		},
+		{
+			name:  "unregistered cloud",
+			value: "aws,gcp,host,process",
+			err:   `invalid --otel-resource-detectors "aws": must be one of "host", "os", "process", "container"`,
+		},
+		{
+			name:      "registered cloud",
+			opts:      []Option{WithNamedResourceDetector("aws", cloudDetector("aws"))},
+			value:     "aws,host",
+			expected:  []string{"aws", "host"},
+			cloudAttr: "aws",
+		},
+		{
+			name:     "lenient",
+			opts:     []Option{WithLenientValidation()},
+			value:    "gcp,os",
+			expected: []string{"os"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New("test", tt.opts...)
+			cfg, err := configFromArgs(t, b, "--otel-resource-detectors="+tt.value)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg.ResourceDetectors, tt.expected) {
+				t.Fatalf("expected detectors %v, got %v", tt.expected, cfg.ResourceDetectors)
+			}
+
+			res, err := b.resource(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if provider, _ := res.Set().Value(semconv.CloudProviderKey); provider.AsString() != tt.cloudAttr {
+				t.Fatalf("expected cloud provider %q, got %q", tt.cloudAttr, provider.AsString())
+			}
+		})
+	}
+}
+
+func TestResourceDetectorsFlagHelp(t *testing.T) {
+	b := New("test", WithNamedResourceDetector("gcp", cloudDetector("gcp")), WithNamedResourceDetector("aws", cloudDetector("aws")))
+	cmd := &cobra.Command{Use: "test"}
+	b.RegisterFlags(cmd.Flags())
+
+	usage := cmd.Flags().Lookup("otel-resource-detectors").Usage
+	if !strings.Contains(usage, `("host", "os", "process", "container", "aws", "gcp")`) {
+		t.Fatalf("expected the registered detectors to be listed, got %q", usage)
+	}
+}
+
+func TestAttributeDenylistFlag(t *testing.T) {
+	patterns := []string{`^(a|b){1,3}$`, `^secret\.`}
+	cfg, err := configFromArgs(t, New("test"), "--otel-attribute-denylist="+patterns[0], "--otel-attribute-denylist="+patterns[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.AttributeDenylist, patterns) {
+		t.Fatalf("expected patterns %q, got %q", patterns, cfg.AttributeDenylist)
+	}
+	if _, err := newAttributeDenylistProcessor(nil, cfg.AttributeDenylist, cfg.AttributeDenylistAction); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,94 @@
+package cobraotel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// dynamicSampler defers to a Sampler that can be replaced while the
+// TracerProvider using it is running.
+type dynamicSampler struct {
+	current atomic.Pointer[trace.Sampler]
+}
+
+var _ trace.Sampler = (*dynamicSampler)(nil)
+
+func (s *dynamicSampler) store(next trace.Sampler) {
+	s.current.Store(&next)
+}
+
+func (s *dynamicSampler) load() trace.Sampler {
+	if current := s.current.Load(); current != nil {
+		return *current
+	}
+	return trace.NeverSample()
+}
+
+func (s *dynamicSampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	return s.load().ShouldSample(p)
+}
+
+func (s *dynamicSampler) Description() string {
+	return s.load().Description()
+}
+
+// SetSampleRatio replaces the ratio of traces sampled by the TracerProvider
+// installed by RunE without restarting the process.
+//
+// The sampler selected by OTEL_TRACES_SAMPLER is kept, so samplers that do not
+// use a ratio are unaffected.
+func (b *Builder) SetSampleRatio(ratio float64) error {
+	if math.IsNaN(ratio) || ratio < 0 || ratio > 1 {
+		return fmt.Errorf("invalid sample ratio %v: must be between 0 and 1", ratio)
+	}
+
+	name, ok := b.status.setSampleRatio(ratio)
+	if !ok {
+		return errors.New("failed to set sample ratio: tracing has not been configured")
+	}
+	b.sampler.store(sampler(name, ratio))
+
+	b.logger.Info("updated trace sample ratio", "sampler", name, "sampleRatio", ratio)
+	return nil
+}
+
+// SampleRatioHandler returns an http.Handler that reports the current sample
+// ratio as JSON for GET requests and calls SetSampleRatio with the "ratio"
+// form value of PUT and POST requests.
+//
+// The handler is intended to be mounted on a debug or admin server.
+func (b *Builder) SampleRatioHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			ratio, err := strconv.ParseFloat(r.FormValue("ratio"), 64)
+			if err != nil {
+				http.Error(w, "invalid ratio: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := b.SetSampleRatio(ratio); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		resp := b.status.response()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Sampler     string  `json:"sampler"`
+			SampleRatio float64 `json:"sampleRatio"`
+		}{resp.Sampler, resp.SampleRatio})
+	})
+}
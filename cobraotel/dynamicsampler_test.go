@@ -0,0 +1,79 @@
+package cobraotel
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSampleRatioHandler(t *testing.T) {
+	b := New("test")
+	cfg, err := configFromArgs(t, b, "--otel-sample-ratio=0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.status.setConfig(cfg)
+	handler := b.SampleRatioHandler()
+
+	for _, tt := range []struct {
+		name         string
+		method       string
+		ratio        string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "get",
+			method:       http.MethodGet,
+			expectedCode: http.StatusOK,
+			expectedBody: `"sampleRatio":0.1`,
+		},
+		{
+			name:         "set",
+			method:       http.MethodPut,
+			ratio:        "0.5",
+			expectedCode: http.StatusOK,
+			expectedBody: `"sampleRatio":0.5`,
+		},
+		{
+			name:         "not a number",
+			method:       http.MethodPost,
+			ratio:        "NaN",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "invalid sample ratio NaN: must be between 0 and 1",
+		},
+		{
+			name:         "out of range",
+			method:       http.MethodPost,
+			ratio:        "1.5",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "invalid sample ratio 1.5: must be between 0 and 1",
+		},
+		{
+			name:         "invalid",
+			method:       http.MethodPost,
+			ratio:        "half",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "invalid ratio: ",
+		},
+		{
+			name:         "unchanged by invalid ratios",
+			method:       http.MethodGet,
+			expectedCode: http.StatusOK,
+			expectedBody: `"sampleRatio":0.5`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", strings.NewReader(url.Values{"ratio": {tt.ratio}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedCode || !strings.Contains(rec.Body.String(), tt.expectedBody) {
+				t.Fatalf("expected %d with %q, got %d with %q", tt.expectedCode, tt.expectedBody, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
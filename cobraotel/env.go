@@ -0,0 +1,188 @@
+package cobraotel
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jzelinskie/stringz"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Source describes where a resolved configuration value came from.
+type Source string
+
+const (
+	// SourceDefault is used for values that were not explicitly configured.
+	SourceDefault Source = "default"
+
+	// SourceFlag is used for values explicitly set with a flag.
+	SourceFlag Source = "flag"
+
+	// SourceEnv is used for values set with an OpenTelemetry environment
+	// variable, as defined by the OpenTelemetry specification.
+	SourceEnv Source = "env"
+)
+
+// lookupEnv returns the value of the first of the provided environment
+// variables that is set.
+func lookupEnv(keys ...string) (key, value string, ok bool) {
+	for _, key := range keys {
+		if value, ok := os.LookupEnv(key); ok {
+			return key, strings.TrimSpace(value), true
+		}
+	}
+	return "", "", false
+}
+
+// resolveFromEnv applies the OpenTelemetry exporter and sampler environment
+// variables to any values in the config that were not explicitly set by
+// flags.
+//
+// Flags always take precedence over environment variables, which take
+// precedence over the default values of flags.
+func (b *Builder) resolveFromEnv(cmd *cobra.Command, cfg *Config) error {
+	cfg.ProviderSource, cfg.EndpointSource, cfg.InsecureSource = SourceDefault, SourceDefault, SourceDefault
+	cfg.SamplerSource = SourceDefault
+
+	if cmd.Flags().Changed(b.prefix("insecure")) {
+		cfg.InsecureSource = SourceFlag
+	} else if key, value, ok := lookupEnv("OTEL_EXPORTER_OTLP_TRACES_INSECURE", "OTEL_EXPORTER_OTLP_INSECURE"); ok {
+		insecure, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+		cfg.Insecure = insecure
+		cfg.InsecureSource = SourceEnv
+	}
+
+	if cmd.Flags().Changed(b.prefix("endpoint")) {
+		cfg.EndpointSource = SourceFlag
+	} else if _, value, ok := lookupEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_ENDPOINT"); ok {
+		// The exporters parse the endpoint from the environment themselves.
+		cfg.Endpoint = value
+		cfg.EndpointSource = SourceEnv
+	}
+
+	providerChanged := cmd.Flags().Changed(b.prefix("provider"))
+	if providerChanged {
+		cfg.ProviderSource = SourceFlag
+	}
+
+	protocolKey, protocol, hasProtocol := lookupEnv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL")
+	for i, p := range cfg.Providers {
+		if p != "otlp" && (providerChanged || p != "otlpgrpc" && p != "otlphttp") {
+			continue
+		}
+
+		if !hasProtocol {
+			if p == "otlp" {
+				cfg.Providers[i] = detectProtocol(cfg.Endpoint)
+			}
+			continue
+		}
+
+		switch protocol {
+		case "grpc":
+			cfg.Providers[i] = "otlpgrpc"
+		case "http/protobuf":
+			cfg.Providers[i] = "otlphttp"
+		default:
+			return fmt.Errorf("unsupported value for %s: %s", protocolKey, protocol)
+		}
+		if !providerChanged {
+			cfg.ProviderSource = SourceEnv
+		}
+	}
+
+	if cmd.Flags().Changed(b.prefix("sample-ratio")) {
+		cfg.SamplerSource = SourceFlag
+	} else if key, value, ok := lookupEnv("OTEL_TRACES_SAMPLER"); ok {
+		if !stringz.SliceContains(samplers, value) {
+			return fmt.Errorf("unsupported value for %s: %s", key, value)
+		}
+		cfg.Sampler = value
+		cfg.SamplerSource = SourceEnv
+
+		if strings.HasSuffix(value, "traceidratio") {
+			// The specification defaults the ratio to 1.0 when no argument
+			// is provided.
+			cfg.SampleRatio = 1.0
+			if key, value, ok := lookupEnv("OTEL_TRACES_SAMPLER_ARG"); ok {
+				ratio, err := strconv.ParseFloat(value, 64)
+				if err != nil || math.IsNaN(ratio) || ratio < 0 || ratio > 1 {
+					return fmt.Errorf("invalid value for %s: must be a ratio between 0 and 1: %s", key, value)
+				}
+				cfg.SampleRatio = ratio
+			}
+		}
+	}
+
+	return nil
+}
+
+// detectProtocol picks the OTLP provider for an endpoint using the
+// well-known OTLP ports, defaulting to HTTP as recommended by the
+// OpenTelemetry specification. Unix sockets are only supported by gRPC.
+func detectProtocol(endpoint string) string {
+	if _, ok := unixSocketPath(endpoint); ok {
+		return "otlpgrpc"
+	}
+
+	hostport := endpoint
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		hostport = u.Host
+	}
+
+	if _, port, err := net.SplitHostPort(hostport); err == nil {
+		switch port {
+		case "4317":
+			return "otlpgrpc"
+		case "4318":
+			return "otlphttp"
+		}
+	}
+
+	return "otlphttp"
+}
+
+// samplers are the values of OTEL_TRACES_SAMPLER that are supported.
+var samplers = []string{
+	"always_on",
+	"always_off",
+	"traceidratio",
+	"parentbased_always_on",
+	"parentbased_always_off",
+	"parentbased_traceidratio",
+}
+
+// sampler creates the Sampler with the provided name as defined by the
+// OTEL_TRACES_SAMPLER environment variable.
+func sampler(name string, ratio float64) trace.Sampler {
+	switch name {
+	case "always_on":
+		return trace.AlwaysSample()
+	case "always_off":
+		return trace.NeverSample()
+	case "traceidratio":
+		return trace.TraceIDRatioBased(ratio)
+	case "parentbased_always_on":
+		return trace.ParentBased(trace.AlwaysSample())
+	case "parentbased_always_off":
+		return trace.ParentBased(trace.NeverSample())
+	default:
+		return trace.ParentBased(trace.TraceIDRatioBased(ratio))
+	}
+}
+
+// unixSocketPath returns the path of the socket for endpoints of the form
+// "unix:///path/to/socket".
+func unixSocketPath(endpoint string) (string, bool) {
+	path, ok := strings.CutPrefix(endpoint, "unix://")
+	return path, ok && path != ""
+}
@@ -0,0 +1,364 @@
+package cobraotel_test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil/v2"
+	"github.com/jzelinskie/cobrautil/v2/cobraotel"
+)
+
+// otelEnv are the environment variables read by ConfigFromFlags.
+var otelEnv = []string{
+	"OTEL_EXPORTER_OTLP_ENDPOINT",
+	"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT",
+	"OTEL_EXPORTER_OTLP_INSECURE",
+	"OTEL_EXPORTER_OTLP_TRACES_INSECURE",
+	"OTEL_EXPORTER_OTLP_PROTOCOL",
+	"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL",
+	"OTEL_TRACES_SAMPLER",
+	"OTEL_TRACES_SAMPLER_ARG",
+}
+
+// configFromEnv resolves the configuration of a new Builder from the provided
+// environment, replacing any OpenTelemetry variables already set, and
+// arguments.
+func configFromEnv(t *testing.T, opts []cobraotel.Option, env map[string]string, args ...string) (cobraotel.Config, error) {
+	t.Helper()
+
+	for _, key := range otelEnv {
+		t.Setenv(key, "") // Restores the variable after the test.
+		os.Unsetenv(key)
+	}
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+
+	b := cobraotel.New("test", opts...)
+	cmd := &cobra.Command{Use: "test"}
+	b.RegisterFlags(cmd.Flags())
+	cobrautil.RegisterRequireTLSFlags(cmd.Flags())
+	if err := cmd.ParseFlags(args); err != nil {
+		t.Fatal(err)
+	}
+	return b.ConfigFromFlags(cmd)
+}
+
+func TestExporterEnv(t *testing.T) {
+	otlpgrpc := []cobraotel.Option{cobraotel.WithDefaultProvider("otlpgrpc")}
+
+	for _, tt := range []struct {
+		name           string
+		opts           []cobraotel.Option
+		env            map[string]string
+		args           []string
+		endpoint       string
+		endpointSource cobraotel.Source
+		insecure       bool
+		insecureSource cobraotel.Source
+		providers      []string
+		providerSource cobraotel.Source
+	}{
+		{
+			name:           "defaults",
+			opts:           otlpgrpc,
+			endpointSource: cobraotel.SourceDefault,
+			insecureSource: cobraotel.SourceDefault,
+			providers:      []string{"otlpgrpc"},
+			providerSource: cobraotel.SourceDefault,
+		},
+		{
+			name: "env",
+			opts: otlpgrpc,
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318",
+				"OTEL_EXPORTER_OTLP_INSECURE": "true",
+				"OTEL_EXPORTER_OTLP_PROTOCOL": "http/protobuf",
+			},
+			endpoint:       "http://collector:4318",
+			endpointSource: cobraotel.SourceEnv,
+			insecure:       true,
+			insecureSource: cobraotel.SourceEnv,
+			providers:      []string{"otlphttp"},
+			providerSource: cobraotel.SourceEnv,
+		},
+		{
+			name: "traces env overrides generic env",
+			opts: otlpgrpc,
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT":        "collector:4318",
+				"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "traces:4317",
+				"OTEL_EXPORTER_OTLP_INSECURE":        "true",
+				"OTEL_EXPORTER_OTLP_TRACES_INSECURE": "false",
+				"OTEL_EXPORTER_OTLP_PROTOCOL":        "http/protobuf",
+				"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL": "grpc",
+			},
+			endpoint:       "traces:4317",
+			endpointSource: cobraotel.SourceEnv,
+			insecureSource: cobraotel.SourceEnv,
+			providers:      []string{"otlpgrpc"},
+			providerSource: cobraotel.SourceEnv,
+		},
+		{
+			name: "flags override env",
+			opts: otlpgrpc,
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "collector:4318",
+				"OTEL_EXPORTER_OTLP_INSECURE": "true",
+				"OTEL_EXPORTER_OTLP_PROTOCOL": "http/protobuf",
+			},
+			args:           []string{"--otel-endpoint=flag:4317", "--otel-insecure=false", "--otel-provider=otlpgrpc"},
+			endpoint:       "flag:4317",
+			endpointSource: cobraotel.SourceFlag,
+			insecureSource: cobraotel.SourceFlag,
+			providers:      []string{"otlpgrpc"},
+			providerSource: cobraotel.SourceFlag,
+		},
+		{
+			name: "deprecated alias overrides env",
+			opts: otlpgrpc,
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "collector:4318",
+			},
+			args:           []string{"--otel-jaeger-endpoint=jaeger:4317"},
+			endpoint:       "jaeger:4317",
+			endpointSource: cobraotel.SourceFlag,
+			insecureSource: cobraotel.SourceDefault,
+			providers:      []string{"otlpgrpc"},
+			providerSource: cobraotel.SourceDefault,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := configFromEnv(t, tt.opts, tt.env, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Endpoint != tt.endpoint || cfg.EndpointSource != tt.endpointSource {
+				t.Errorf("expected endpoint %q from %s, got %q from %s", tt.endpoint, tt.endpointSource, cfg.Endpoint, cfg.EndpointSource)
+			}
+			if cfg.Insecure != tt.insecure || cfg.InsecureSource != tt.insecureSource {
+				t.Errorf("expected insecure %t from %s, got %t from %s", tt.insecure, tt.insecureSource, cfg.Insecure, cfg.InsecureSource)
+			}
+			if !reflect.DeepEqual(cfg.Providers, tt.providers) || cfg.ProviderSource != tt.providerSource {
+				t.Errorf("expected providers %v from %s, got %v from %s", tt.providers, tt.providerSource, cfg.Providers, cfg.ProviderSource)
+			}
+		})
+	}
+}
+
+func TestSamplerEnv(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		env     map[string]string
+		args    []string
+		sampler string
+		ratio   float64
+		source  cobraotel.Source
+	}{
+		{
+			name:    "defaults",
+			sampler: "parentbased_traceidratio",
+			ratio:   0.01,
+			source:  cobraotel.SourceDefault,
+		},
+		{
+			name:    "sampler",
+			env:     map[string]string{"OTEL_TRACES_SAMPLER": "always_on"},
+			sampler: "always_on",
+			ratio:   0.01,
+			source:  cobraotel.SourceEnv,
+		},
+		{
+			name:    "ratio defaults to 1",
+			env:     map[string]string{"OTEL_TRACES_SAMPLER": "traceidratio"},
+			sampler: "traceidratio",
+			ratio:   1,
+			source:  cobraotel.SourceEnv,
+		},
+		{
+			name:    "ratio",
+			env:     map[string]string{"OTEL_TRACES_SAMPLER": "parentbased_traceidratio", "OTEL_TRACES_SAMPLER_ARG": "0.25"},
+			sampler: "parentbased_traceidratio",
+			ratio:   0.25,
+			source:  cobraotel.SourceEnv,
+		},
+		{
+			name:    "flag overrides env",
+			env:     map[string]string{"OTEL_TRACES_SAMPLER": "always_off", "OTEL_TRACES_SAMPLER_ARG": "0.25"},
+			args:    []string{"--otel-sample-ratio=0.5"},
+			sampler: "parentbased_traceidratio",
+			ratio:   0.5,
+			source:  cobraotel.SourceFlag,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := configFromEnv(t, nil, tt.env, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Sampler != tt.sampler || cfg.SampleRatio != tt.ratio || cfg.SamplerSource != tt.source {
+				t.Fatalf("expected sampler %s(%v) from %s, got %s(%v) from %s", tt.sampler, tt.ratio, tt.source, cfg.Sampler, cfg.SampleRatio, cfg.SamplerSource)
+			}
+		})
+	}
+}
+
+func TestOTLPProtocolDetection(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		env       map[string]string
+		args      []string
+		providers []string
+		source    cobraotel.Source
+	}{
+		{
+			name:      "default",
+			args:      []string{"--otel-provider=otlp"},
+			providers: []string{"otlphttp"},
+			source:    cobraotel.SourceFlag,
+		},
+		{
+			name:      "grpc port",
+			args:      []string{"--otel-provider=otlp", "--otel-endpoint=collector:4317"},
+			providers: []string{"otlpgrpc"},
+			source:    cobraotel.SourceFlag,
+		},
+		{
+			name:      "http port",
+			env:       map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "https://collector:4318"},
+			args:      []string{"--otel-provider=otlp"},
+			providers: []string{"otlphttp"},
+			source:    cobraotel.SourceFlag,
+		},
+		{
+			name:      "unix socket",
+			args:      []string{"--otel-provider=otlp", "--otel-endpoint=unix:///run/otel.sock"},
+			providers: []string{"otlpgrpc"},
+			source:    cobraotel.SourceFlag,
+		},
+		{
+			name:      "protocol env overrides port",
+			env:       map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "grpc"},
+			args:      []string{"--otel-provider=otlp,stdout", "--otel-endpoint=collector:4318"},
+			providers: []string{"otlpgrpc", "stdout"},
+			source:    cobraotel.SourceFlag,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := configFromEnv(t, nil, tt.env, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg.Providers, tt.providers) || cfg.ProviderSource != tt.source {
+				t.Fatalf("expected providers %v from %s, got %v from %s", tt.providers, tt.source, cfg.Providers, cfg.ProviderSource)
+			}
+		})
+	}
+}
+
+func TestEnvErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		env      map[string]string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "insecure",
+			env:      map[string]string{"OTEL_EXPORTER_OTLP_TRACES_INSECURE": "maybe"},
+			expected: `invalid value for OTEL_EXPORTER_OTLP_TRACES_INSECURE: strconv.ParseBool: parsing "maybe": invalid syntax`,
+		},
+		{
+			name:     "protocol",
+			env:      map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "http/json"},
+			expected: "unsupported value for OTEL_EXPORTER_OTLP_PROTOCOL: http/json",
+		},
+		{
+			name:     "protocol with otlp provider",
+			env:      map[string]string{"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL": "grpc/json"},
+			args:     []string{"--otel-provider=otlp"},
+			expected: "unsupported value for OTEL_EXPORTER_OTLP_TRACES_PROTOCOL: grpc/json",
+		},
+		{
+			name:     "sampler",
+			env:      map[string]string{"OTEL_TRACES_SAMPLER": "jaeger_remote"},
+			expected: "unsupported value for OTEL_TRACES_SAMPLER: jaeger_remote",
+		},
+		{
+			name:     "sampler ratio",
+			env:      map[string]string{"OTEL_TRACES_SAMPLER": "traceidratio", "OTEL_TRACES_SAMPLER_ARG": "2"},
+			expected: "invalid value for OTEL_TRACES_SAMPLER_ARG: must be a ratio between 0 and 1: 2",
+		},
+		{
+			name:     "sampler ratio not a number",
+			env:      map[string]string{"OTEL_TRACES_SAMPLER": "traceidratio", "OTEL_TRACES_SAMPLER_ARG": "NaN"},
+			expected: "invalid value for OTEL_TRACES_SAMPLER_ARG: must be a ratio between 0 and 1: NaN",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := configFromEnv(t, []cobraotel.Option{cobraotel.WithDefaultProvider("otlpgrpc")}, tt.env, tt.args...)
+			if err == nil || err.Error() != tt.expected {
+				t.Fatalf("expected error %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestRequireTLS(t *testing.T) {
+	opts := []cobraotel.Option{cobraotel.WithDefaultProvider("otlpgrpc")}
+	for _, tt := range []struct {
+		name     string
+		env      map[string]string
+		args     []string
+		expected string
+	}{
+		{
+			name: "tls",
+			args: []string{"--otel-endpoint=collector:4317"},
+		},
+		{
+			name: "https endpoint",
+			env:  map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "https://collector:4318"},
+		},
+		{
+			name: "not exporting via otlp",
+			args: []string{"--otel-provider=stdout", "--otel-insecure"},
+		},
+		{
+			name:     "insecure flag",
+			args:     []string{"--otel-insecure"},
+			expected: "failed to configure tracing: TLS is required but exporting insecurely was configured by flag",
+		},
+		{
+			name:     "insecure env",
+			env:      map[string]string{"OTEL_EXPORTER_OTLP_INSECURE": "true"},
+			expected: "failed to configure tracing: TLS is required but exporting insecurely was configured by env",
+		},
+		{
+			name:     "unix socket",
+			args:     []string{"--otel-endpoint=unix:///var/run/otel.sock"},
+			expected: "failed to configure tracing: TLS is required but connections to the unix socket endpoint unix:///var/run/otel.sock are never encrypted",
+		},
+		{
+			name:     "http endpoint",
+			env:      map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"},
+			expected: "failed to configure tracing: TLS is required but the endpoint http://collector:4318 configured by env uses plaintext HTTP",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := configFromEnv(t, opts, tt.env, append(tt.args, "--require-tls")...)
+			if tt.expected == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.expected {
+				t.Fatalf("expected error %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package cobraotel_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil/v2/cobrahttp"
+	"github.com/jzelinskie/cobrautil/v2/cobraotel"
+)
+
+func ExampleBuilder_MetricsHandler() {
+	otelb := cobraotel.New("myservice")
+
+	// Serve the metrics on a dedicated server configured by "--metrics-*" flags.
+	metricsb := cobrahttp.New("metrics",
+		cobrahttp.WithFlagPrefix("metrics"),
+		cobrahttp.WithDefaultAddress(":9090"),
+		cobrahttp.WithHandler(otelb.MetricsHandler()),
+	)
+
+	cmd := &cobra.Command{
+		Use:     "serve",
+		PreRunE: otelb.RunE(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return metricsb.ListenFromFlags(cmd, metricsb.ServerFromFlags(cmd))
+		},
+	}
+	otelb.RegisterFlags(cmd.Flags())
+	metricsb.RegisterFlags(cmd.Flags())
+}
+
+func ExampleBuilder_Shutdown() {
+	otelb := cobraotel.New("myservice")
+
+	cmd := &cobra.Command{
+		Use:     "serve",
+		PreRunE: otelb.RunE(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				_ = otelb.Shutdown(ctx)
+			}()
+
+			// Serve until the command is canceled.
+			<-cmd.Context().Done()
+			return nil
+		},
+	}
+	otelb.RegisterFlags(cmd.Flags())
+}
@@ -0,0 +1,89 @@
+package cobraotel
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// forceSampler samples every span whose context carries a baggage member with
+// the configured key and a truthy value, deferring to the next sampler
+// otherwise.
+type forceSampler struct {
+	key  string
+	next trace.Sampler
+}
+
+var _ trace.Sampler = forceSampler{}
+
+func (s forceSampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	if forced(baggage.FromContext(p.ParentContext).Member(s.key).Value()) {
+		return trace.SamplingResult{
+			Decision:   trace.RecordAndSample,
+			Tracestate: oteltrace.SpanContextFromContext(p.ParentContext).TraceState(),
+		}
+	}
+	return s.next.ShouldSample(p)
+}
+
+func (s forceSampler) Description() string {
+	return fmt.Sprintf("ForceSample{key:%s,next:%s}", s.key, s.next.Description())
+}
+
+// forced returns true for any non-empty value other than one that parses as
+// false.
+func forced(value string) bool {
+	if value == "" {
+		return false
+	}
+	if b, err := strconv.ParseBool(value); err == nil {
+		return b
+	}
+	return true
+}
+
+// ForceSampleMiddleware returns middleware that copies the header named by
+// the "$PREFIX-force-sample-key" flag into the baggage of each request's
+// context, so that requests carrying the header are always sampled.
+//
+// The middleware must wrap the handler that starts spans for requests, and
+// does nothing if the flag is empty.
+func (b *Builder) ForceSampleMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := b.status.forceSampleKey()
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		value := r.Header.Get(key)
+		if !forced(value) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		m, err := baggage.NewMember(key, "true")
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		bag, err := baggage.FromContext(r.Context()).SetMember(m)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(baggage.ContextWithBaggage(r.Context(), bag)))
+	})
+}
+
+// WithForceSampleKey sets the default value of the "$PREFIX-force-sample-key"
+// flag.
+//
+// Defaults to an empty string, which disables force-sampling.
+func WithForceSampleKey(key string) Option {
+	return func(b *Builder) { b.defaultForceSampleKey = key }
+}
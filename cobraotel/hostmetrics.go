@@ -0,0 +1,163 @@
+package cobraotel
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelmetric "go.opentelemetry.io/otel/metric"
+)
+
+// clockTicks is the number of USER_HZ clock ticks per second in which
+// /proc/stat reports CPU times, which is 100 on every supported architecture.
+const clockTicks = 100
+
+// cpuTimes are the CPU times of the host, in seconds, by state.
+type cpuTimes struct {
+	user, system, idle, other float64
+}
+
+// readCPUTimes parses the aggregate CPU times from the contents of
+// /proc/stat.
+func readCPUTimes(r io.Reader) (cpuTimes, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 9 || fields[0] != "cpu" {
+			continue
+		}
+
+		// user nice system idle iowait irq softirq steal
+		var ticks [8]float64
+		for i := range ticks {
+			v, err := strconv.ParseUint(fields[i+1], 10, 64)
+			if err != nil {
+				return cpuTimes{}, fmt.Errorf("invalid CPU time %q: %w", fields[i+1], err)
+			}
+			ticks[i] = float64(v) / clockTicks
+		}
+		return cpuTimes{
+			user:   ticks[0],
+			system: ticks[2],
+			idle:   ticks[3],
+			other:  ticks[1] + ticks[4] + ticks[5] + ticks[6] + ticks[7],
+		}, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return cpuTimes{}, err
+	}
+	return cpuTimes{}, fmt.Errorf("no aggregate CPU times")
+}
+
+// memoryStats are the total and available memory of the host, in bytes.
+type memoryStats struct {
+	total, available int64
+}
+
+// readMemoryStats parses the total and available memory from the contents of
+// /proc/meminfo.
+func readMemoryStats(r io.Reader) (memoryStats, error) {
+	var stats memoryStats
+	var found int
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		var dst *int64
+		switch fields[0] {
+		case "MemTotal:":
+			dst = &stats.total
+		case "MemAvailable:":
+			dst = &stats.available
+		default:
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return memoryStats{}, fmt.Errorf("invalid %s %q: %w", strings.TrimSuffix(fields[0], ":"), fields[1], err)
+		}
+		*dst = kb * 1024
+		found++
+	}
+	if err := scanner.Err(); err != nil {
+		return memoryStats{}, err
+	}
+	if found != 2 {
+		return memoryStats{}, fmt.Errorf("missing MemTotal or MemAvailable")
+	}
+	return stats, nil
+}
+
+func readProcFile[T any](path string, parse func(io.Reader) (T, error)) (T, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	defer f.Close()
+
+	v, err := parse(f)
+	if err != nil {
+		return v, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return v, nil
+}
+
+// startHostMetrics registers instruments reporting the CPU and memory
+// statistics of the host read from /proc, which is only available on Linux.
+//
+// The instrument names follow those of
+// go.opentelemetry.io/contrib/instrumentation/host, which is not used because
+// it depends on gopsutil.
+func startHostMetrics(meter otelmetric.Meter) error {
+	cpuTime, err := meter.Float64ObservableCounter("system.cpu.time", otelmetric.WithUnit("s"), otelmetric.WithDescription("Accumulated CPU time spent by the host"))
+	if err != nil {
+		return fmt.Errorf("failed to create host metric system.cpu.time: %w", err)
+	}
+	memoryUsage, err := meter.Int64ObservableUpDownCounter("system.memory.usage", otelmetric.WithUnit("By"), otelmetric.WithDescription("Memory usage of the host"))
+	if err != nil {
+		return fmt.Errorf("failed to create host metric system.memory.usage: %w", err)
+	}
+	memoryUtilization, err := meter.Float64ObservableGauge("system.memory.utilization", otelmetric.WithUnit("1"), otelmetric.WithDescription("Fraction of the memory of the host that is used"))
+	if err != nil {
+		return fmt.Errorf("failed to create host metric system.memory.utilization: %w", err)
+	}
+
+	state := func(s string) otelmetric.ObserveOption {
+		return otelmetric.WithAttributes(attribute.String("state", s))
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o otelmetric.Observer) error {
+		cpu, err := readProcFile("/proc/stat", readCPUTimes)
+		if err != nil {
+			return err
+		}
+		o.ObserveFloat64(cpuTime, cpu.user, state("user"))
+		o.ObserveFloat64(cpuTime, cpu.system, state("system"))
+		o.ObserveFloat64(cpuTime, cpu.idle, state("idle"))
+		o.ObserveFloat64(cpuTime, cpu.other, state("other"))
+
+		mem, err := readProcFile("/proc/meminfo", readMemoryStats)
+		if err != nil {
+			return err
+		}
+		used := mem.total - mem.available
+		o.ObserveInt64(memoryUsage, used, state("used"))
+		o.ObserveInt64(memoryUsage, mem.available, state("available"))
+		if mem.total > 0 {
+			o.ObserveFloat64(memoryUtilization, float64(used)/float64(mem.total), state("used"))
+		}
+		return nil
+	}, cpuTime, memoryUsage, memoryUtilization)
+	if err != nil {
+		return fmt.Errorf("failed to register host metrics: %w", err)
+	}
+	return nil
+}
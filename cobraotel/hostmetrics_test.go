@@ -0,0 +1,74 @@
+package cobraotel
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestReadCPUTimes(t *testing.T) {
+	cpu, err := readCPUTimes(strings.NewReader(`cpu  1000 100 500 8000 200 10 20 30 0 0
+cpu0 500 50 250 4000 100 5 10 15 0 0
+intr 123
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (cpuTimes{user: 10, system: 5, idle: 80, other: 3.6}); cpu != expected {
+		t.Fatalf("expected %+v, got %+v", expected, cpu)
+	}
+
+	if _, err := readCPUTimes(strings.NewReader("intr 123\n")); err == nil {
+		t.Fatal("expected an error without aggregate CPU times")
+	}
+}
+
+func TestReadMemoryStats(t *testing.T) {
+	mem, err := readMemoryStats(strings.NewReader(`MemTotal:        2048 kB
+MemFree:          512 kB
+MemAvailable:    1024 kB
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (memoryStats{total: 2048 * 1024, available: 1024 * 1024}); mem != expected {
+		t.Fatalf("expected %+v, got %+v", expected, mem)
+	}
+
+	if _, err := readMemoryStats(strings.NewReader("MemTotal: 2048 kB\n")); err == nil {
+		t.Fatal("expected an error without MemAvailable")
+	}
+}
+
+func TestHostMetrics(t *testing.T) {
+	if _, err := os.Stat("/proc/meminfo"); err != nil {
+		t.Skip("/proc is not available")
+	}
+
+	reader := metric.NewManualReader()
+	mp := metric.NewMeterProvider(metric.WithReader(reader))
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+	if err := startHostMetrics(mp.Meter("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			names[m.Name] = true
+		}
+	}
+	for _, name := range []string{"system.cpu.time", "system.memory.usage", "system.memory.utilization"} {
+		if !names[name] {
+			t.Errorf("expected %s to be collected, got %v", name, names)
+		}
+	}
+}
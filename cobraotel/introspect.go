@@ -0,0 +1,161 @@
+package cobraotel
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// tracingStatus records the configuration applied by RunE and the outcome of
+// exports so that it can be reported by TracingConfigHandler.
+type tracingStatus struct {
+	mu         sync.Mutex
+	configured bool
+	cfg        Config
+	res        *resource.Resource
+
+	lastExport    time.Time
+	lastError     error
+	lastErrorTime time.Time
+	exportedSpans int64
+	failedExports int64
+}
+
+func (s *tracingStatus) setConfig(cfg Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.configured, s.cfg = true, cfg
+}
+
+func (s *tracingStatus) setResource(res *resource.Resource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.res = res
+}
+
+// setSampleRatio updates the configured sample ratio, returning the name of
+// the configured sampler and whether tracing has been configured.
+func (s *tracingStatus) setSampleRatio(ratio float64) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.configured {
+		return "", false
+	}
+	s.cfg.SampleRatio = ratio
+	return s.cfg.Sampler, true
+}
+
+func (s *tracingStatus) forceSampleKey() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg.ForceSampleKey
+}
+
+func (s *tracingStatus) recordExport(n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if err != nil {
+		s.failedExports++
+		s.lastError, s.lastErrorTime = err, now
+		return
+	}
+	s.exportedSpans += int64(n)
+	s.lastExport = now
+}
+
+// statusExporter records the outcome of every export of the SpanExporter it
+// wraps.
+type statusExporter struct {
+	trace.SpanExporter
+	status *tracingStatus
+}
+
+func (e statusExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	e.status.recordExport(len(spans), err)
+	return err
+}
+
+type tracingConfigResponse struct {
+	Configured  bool              `json:"configured"`
+	Providers   []string          `json:"providers"`
+	Endpoint    string            `json:"endpoint,omitempty"`
+	Insecure    bool              `json:"insecure"`
+	Sampler     string            `json:"sampler,omitempty"`
+	SampleRatio float64           `json:"sampleRatio"`
+	Propagators []string          `json:"propagators,omitempty"`
+	Resource    map[string]string `json:"resource,omitempty"`
+	Exporter    *exporterResponse `json:"exporter,omitempty"`
+}
+
+type exporterResponse struct {
+	ExportedSpans int64      `json:"exportedSpans"`
+	FailedExports int64      `json:"failedExports"`
+	LastExport    *time.Time `json:"lastExport,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorTime *time.Time `json:"lastErrorTime,omitempty"`
+}
+
+func (s *tracingStatus) response() tracingConfigResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp := tracingConfigResponse{Configured: s.configured}
+	if !s.configured {
+		return resp
+	}
+
+	resp.Providers = s.cfg.Providers
+	resp.Endpoint = s.cfg.Endpoint
+	resp.Insecure = s.cfg.Insecure
+	resp.Sampler = s.cfg.Sampler
+	resp.SampleRatio = s.cfg.SampleRatio
+	resp.Propagators = s.cfg.Propagators
+
+	if s.res != nil {
+		resp.Resource = make(map[string]string, s.res.Len())
+		for _, kv := range s.res.Attributes() {
+			resp.Resource[string(kv.Key)] = kv.Value.Emit()
+		}
+	}
+
+	if len(s.cfg.Providers) > 0 {
+		resp.Exporter = &exporterResponse{
+			ExportedSpans: s.exportedSpans,
+			FailedExports: s.failedExports,
+		}
+		if !s.lastExport.IsZero() {
+			lastExport := s.lastExport
+			resp.Exporter.LastExport = &lastExport
+		}
+		if s.lastError != nil {
+			lastErrorTime := s.lastErrorTime
+			resp.Exporter.LastError = s.lastError.Error()
+			resp.Exporter.LastErrorTime = &lastErrorTime
+		}
+	}
+
+	return resp
+}
+
+// TracingConfigHandler returns an http.Handler that reports the live tracing
+// configuration applied by RunE as JSON, including the provider, endpoint,
+// sampler, propagators, resource attributes, and the status of recent
+// exports.
+//
+// The handler is intended to be mounted on a debug or admin server.
+func (b *Builder) TracingConfigHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(b.status.response())
+	})
+}
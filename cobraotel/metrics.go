@@ -0,0 +1,69 @@
+package cobraotel
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/sdk/metric"
+)
+
+func (b *Builder) initOtelMeter(cfg Config) error {
+	res, err := b.resource(cfg)
+	if err != nil {
+		return err
+	}
+
+	var reader metric.Reader
+	switch cfg.MetricsProvider {
+	case "prometheus":
+		reader, err = otelprometheus.New(otelprometheus.WithRegisterer(b.registry))
+		if err != nil {
+			return err
+		}
+	default:
+		return unsupportedValueError(b.prefix("metrics-provider"), cfg.MetricsProvider, metricsProviders)
+	}
+
+	opts := []metric.Option{
+		metric.WithReader(reader),
+		metric.WithResource(res),
+	}
+	if view := cfg.metricsView(); view != nil {
+		opts = append(opts, metric.WithView(view))
+	}
+	if len(b.views) > 0 {
+		opts = append(opts, metric.WithView(b.views...))
+	}
+
+	mp := metric.NewMeterProvider(opts...)
+	if cfg.RuntimeMetrics {
+		if err := startRuntimeMetrics(mp); err != nil {
+			return err
+		}
+	}
+
+	b.shutdowns.add(mp.Shutdown)
+	otel.SetMeterProvider(mp)
+	return nil
+}
+
+// MetricsHandler returns an http.Handler that serves the metrics collected
+// when the "$PREFIX-metrics-provider" flag is "prometheus" in the Prometheus
+// exposition format.
+//
+// The handler can be mounted on the server from a cobrahttp.Builder or serve
+// as the handler of a dedicated metrics server.
+func (b *Builder) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(b.registry, promhttp.HandlerOpts{})
+}
+
+// WithPrometheusRegistry defines the registry that metrics are registered
+// with when the "$PREFIX-metrics-provider" flag is "prometheus".
+//
+// Defaults to a new, empty registry.
+func WithPrometheusRegistry(registry *prometheus.Registry) Option {
+	return func(b *Builder) { b.registry = registry }
+}
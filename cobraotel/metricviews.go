@@ -0,0 +1,133 @@
+package cobraotel
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/jzelinskie/cobrautil/v2"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/sdk/metric"
+)
+
+// HistogramBoundaries are the explicit bucket boundaries of the histogram
+// instruments whose names match Pattern.
+type HistogramBoundaries struct {
+	Pattern    string
+	Boundaries []float64
+}
+
+// metricViewsFromFlags resolves the "$PREFIX-metrics-drop",
+// "$PREFIX-metrics-rename", and "$PREFIX-metrics-histogram-boundaries" flags.
+//
+// Patterns use the syntax of path.Match, like the span name denylist.
+// Instruments can only be renamed individually because the SDK would merge
+// every instrument matching a pattern into a single stream.
+func (b *Builder) metricViewsFromFlags(cmd *cobra.Command, cfg *Config) error {
+	cfg.MetricsDrop = cobrautil.MustGetStringSlice(cmd, b.prefix("metrics-drop"))
+	for _, pattern := range cfg.MetricsDrop {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --%s %q: %w", b.prefix("metrics-drop"), pattern, err)
+		}
+	}
+
+	cfg.MetricsRename = cobrautil.MustGetStringToString(cmd, b.prefix("metrics-rename"))
+	for name, rename := range cfg.MetricsRename {
+		if strings.ContainsAny(name, "*?[") || rename == "" {
+			return fmt.Errorf("invalid --%s %q: must be the name of an instrument and its new name (e.g. \"http.server.duration=http.duration\")", b.prefix("metrics-rename"), name+"="+rename)
+		}
+	}
+
+	for _, value := range cobrautil.MustGetStringArray(cmd, b.prefix("metrics-histogram-boundaries")) {
+		hb, err := parseHistogramBoundaries(value)
+		if err != nil {
+			return fmt.Errorf("invalid --%s %q: %w", b.prefix("metrics-histogram-boundaries"), value, err)
+		}
+		cfg.MetricsHistogramBoundaries = append(cfg.MetricsHistogramBoundaries, hb)
+	}
+
+	return nil
+}
+
+// parseHistogramBoundaries parses a pattern and its boundaries, e.g.
+// "http.server.duration=0.005,0.01,0.1,1".
+func parseHistogramBoundaries(value string) (HistogramBoundaries, error) {
+	pattern, boundaries, ok := strings.Cut(value, "=")
+	if !ok || pattern == "" {
+		return HistogramBoundaries{}, errors.New(`must be a pattern and its boundaries (e.g. "http.server.duration=0.005,0.01,0.1,1")`)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return HistogramBoundaries{}, err
+	}
+
+	hb := HistogramBoundaries{Pattern: pattern}
+	for _, s := range splitNonEmpty(boundaries) {
+		boundary, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return HistogramBoundaries{}, err
+		}
+		if n := len(hb.Boundaries); n > 0 && boundary <= hb.Boundaries[n-1] {
+			return HistogramBoundaries{}, errors.New("boundaries must be increasing")
+		}
+		hb.Boundaries = append(hb.Boundaries, boundary)
+	}
+	return hb, nil
+}
+
+// metricsView returns a view applying the flags to every instrument, or nil if
+// none are set.
+//
+// The flags are combined into a single view because the SDK exports an
+// instrument once for every view that matches it.
+func (c Config) metricsView() metric.View {
+	if len(c.MetricsDrop) == 0 && len(c.MetricsRename) == 0 && len(c.MetricsHistogramBoundaries) == 0 {
+		return nil
+	}
+
+	return func(inst metric.Instrument) (metric.Stream, bool) {
+		stream := metric.Stream{Name: inst.Name, Description: inst.Description, Unit: inst.Unit}
+		for _, pattern := range c.MetricsDrop {
+			if matched, _ := path.Match(pattern, inst.Name); matched {
+				stream.Aggregation = metric.AggregationDrop{}
+				return stream, true
+			}
+		}
+
+		name, renamed := c.MetricsRename[inst.Name]
+		if renamed {
+			stream.Name = name
+		}
+
+		if inst.Kind == metric.InstrumentKindHistogram {
+			for _, hb := range c.MetricsHistogramBoundaries {
+				if matched, _ := path.Match(hb.Pattern, inst.Name); matched {
+					stream.Aggregation = metric.AggregationExplicitBucketHistogram{Boundaries: hb.Boundaries}
+					return stream, true
+				}
+			}
+		}
+
+		return stream, renamed
+	}
+}
+
+// WithMetricViews adds views that customize the metrics collected when a
+// metrics provider is configured, such as to change their aggregation.
+//
+// The views are registered in addition to the one configured by the
+// "$PREFIX-metrics-drop", "$PREFIX-metrics-rename", and
+// "$PREFIX-metrics-histogram-boundaries" flags, and an instrument matched by
+// several views is exported once for each of them.
+func WithMetricViews(views ...metric.View) Option {
+	return func(b *Builder) { b.views = append(b.views, views...) }
+}
+
+// WithMetricsDrop sets the default value of the "$PREFIX-metrics-drop" flag,
+// such as to drop high-cardinality instruments of a dependency.
+//
+// Defaults to no patterns.
+func WithMetricsDrop(patterns ...string) Option {
+	return func(b *Builder) { b.defaultMetricsDrop = patterns }
+}
@@ -0,0 +1,126 @@
+package cobraotel_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/metric"
+
+	"github.com/jzelinskie/cobrautil/v2/cobraotel"
+)
+
+func TestMetricViews(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	b := cobraotel.New("test",
+		cobraotel.WithPrometheusRegistry(registry),
+		cobraotel.WithMetricsDrop("dropped.*"),
+		cobraotel.WithMetricViews(metric.NewView(metric.Instrument{Name: "custom"}, metric.Stream{Name: "custom.view"})),
+	)
+	cmd := &cobra.Command{Use: "test", RunE: b.RunE()}
+	b.RegisterFlags(cmd.Flags())
+	cmd.SetArgs([]string{
+		"--otel-metrics-provider=prometheus",
+		"--otel-metrics-rename=requests=renamed.requests",
+		"--otel-metrics-histogram-boundaries=latency*=1,10",
+		"--otel-metrics-histogram-boundaries=latency=100",
+	})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = b.Shutdown(context.Background()) })
+
+	ctx := context.Background()
+	meter := otel.GetMeterProvider().Meter("test")
+	for _, name := range []string{"dropped.requests", "requests", "custom"} {
+		counter, err := meter.Int64Counter(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counter.Add(ctx, 1)
+	}
+	for _, name := range []string{"latency", "size"} {
+		histogram, err := meter.Float64Histogram(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		histogram.Record(ctx, 5)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buckets := make(map[string][]float64)
+	for _, family := range families {
+		var bounds []float64
+		for _, m := range family.GetMetric() {
+			for _, bucket := range m.GetHistogram().GetBucket() {
+				bounds = append(bounds, bucket.GetUpperBound())
+			}
+		}
+		buckets[family.GetName()] = bounds
+	}
+
+	for _, name := range []string{"dropped_requests_total", "requests_total", "custom_total"} {
+		if _, ok := buckets[name]; ok {
+			t.Errorf("expected %s not to be exported", name)
+		}
+	}
+	for _, name := range []string{"renamed_requests_total", "custom_view_total", "size"} {
+		if _, ok := buckets[name]; !ok {
+			t.Errorf("expected %s to be exported", name)
+		}
+	}
+	if !reflect.DeepEqual(buckets["latency"], []float64{1, 10}) {
+		t.Errorf("expected the boundaries of the first matching pattern, got %v", buckets["latency"])
+	}
+	if len(buckets["size"]) <= 2 {
+		t.Errorf("expected the default boundaries, got %v", buckets["size"])
+	}
+}
+
+func TestMetricViewErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "drop pattern",
+			args:     []string{"--otel-metrics-drop=[rpc"},
+			expected: `invalid --otel-metrics-drop "[rpc": syntax error in pattern`,
+		},
+		{
+			name:     "rename pattern",
+			args:     []string{"--otel-metrics-rename=rpc.*=rpc"},
+			expected: `invalid --otel-metrics-rename "rpc.*=rpc": must be the name of an instrument and its new name`,
+		},
+		{
+			name:     "boundaries without pattern",
+			args:     []string{"--otel-metrics-histogram-boundaries=1,10"},
+			expected: `invalid --otel-metrics-histogram-boundaries "1,10": must be a pattern and its boundaries`,
+		},
+		{
+			name:     "boundaries not increasing",
+			args:     []string{"--otel-metrics-histogram-boundaries=latency=10,1"},
+			expected: `invalid --otel-metrics-histogram-boundaries "latency=10,1": boundaries must be increasing`,
+		},
+		{
+			name:     "boundaries not numbers",
+			args:     []string{"--otel-metrics-histogram-boundaries=latency=1s"},
+			expected: `invalid --otel-metrics-histogram-boundaries "latency=1s": strconv.ParseFloat: parsing "1s": invalid syntax`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := configFromEnv(t, nil, nil, tt.args...)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+				t.Fatalf("expected error %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
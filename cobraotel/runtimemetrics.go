@@ -0,0 +1,95 @@
+package cobraotel
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/metrics"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelmetric "go.opentelemetry.io/otel/metric"
+)
+
+// runtimeMetrics maps the names of samples read from runtime/metrics to the
+// OpenTelemetry instruments they are reported as.
+//
+// The instrument names follow those of
+// go.opentelemetry.io/contrib/instrumentation/runtime so that dashboards can
+// be shared, but are collected directly: the release compatible with the
+// OpenTelemetry SDK this module depends on reads runtime.MemStats, which
+// stops the world on every collection. Idle CPU time is not reported because
+// it is time during which the process was not running.
+var runtimeMetrics = []struct {
+	sample      string
+	name        string
+	unit        string
+	description string
+	counter     bool
+	attrs       []attribute.KeyValue
+}{
+	{"/sched/goroutines:goroutines", "process.runtime.go.goroutines", "{goroutine}", "Number of goroutines that currently exist", false, nil},
+	{"/gc/cycles/total:gc-cycles", "process.runtime.go.gc.count", "{cycle}", "Number of completed garbage collection cycles", true, nil},
+	{"/gc/heap/allocs:bytes", "process.runtime.go.mem.heap_alloc_total", "By", "Cumulative bytes allocated to the heap", true, nil},
+	{"/memory/classes/heap/objects:bytes", "process.runtime.go.mem.heap_alloc", "By", "Bytes of allocated heap objects", false, nil},
+	{"/memory/classes/total:bytes", "process.runtime.go.mem.total", "By", "Bytes of memory mapped by the Go runtime", false, nil},
+	{"/cpu/classes/user:cpu-seconds", "process.cpu.time", "s", "Estimated CPU time spent by the process", true, []attribute.KeyValue{attribute.String("state", "user")}},
+	{"/cpu/classes/gc/total:cpu-seconds", "process.cpu.time", "s", "Estimated CPU time spent by the process", true, []attribute.KeyValue{attribute.String("state", "gc")}},
+}
+
+// startRuntimeMetrics registers instruments reporting Go runtime and process
+// CPU statistics with the provided MeterProvider, along with the CPU and
+// memory statistics of the host on Linux.
+func startRuntimeMetrics(mp otelmetric.MeterProvider) error {
+	meter := mp.Meter("github.com/jzelinskie/cobrautil/v2/cobraotel")
+
+	samples := make([]metrics.Sample, len(runtimeMetrics))
+	observables := make([]otelmetric.Observable, len(runtimeMetrics))
+	instruments := make(map[string]otelmetric.Observable)
+	var unique []otelmetric.Observable
+	for i, m := range runtimeMetrics {
+		samples[i].Name = m.sample
+
+		// Instruments with the same name are distinguished by attributes.
+		if inst, ok := instruments[m.name]; ok {
+			observables[i] = inst
+			continue
+		}
+
+		var err error
+		switch {
+		case m.counter && m.unit == "s":
+			observables[i], err = meter.Float64ObservableCounter(m.name, otelmetric.WithUnit(m.unit), otelmetric.WithDescription(m.description))
+		case m.counter:
+			observables[i], err = meter.Int64ObservableCounter(m.name, otelmetric.WithUnit(m.unit), otelmetric.WithDescription(m.description))
+		default:
+			observables[i], err = meter.Int64ObservableUpDownCounter(m.name, otelmetric.WithUnit(m.unit), otelmetric.WithDescription(m.description))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create runtime metric %s: %w", m.name, err)
+		}
+		instruments[m.name] = observables[i]
+		unique = append(unique, observables[i])
+	}
+
+	_, err := meter.RegisterCallback(func(_ context.Context, o otelmetric.Observer) error {
+		metrics.Read(samples)
+		for i, s := range samples {
+			opt := otelmetric.WithAttributes(runtimeMetrics[i].attrs...)
+			switch s.Value.Kind() {
+			case metrics.KindUint64:
+				o.ObserveInt64(observables[i].(otelmetric.Int64Observable), int64(s.Value.Uint64()), opt)
+			case metrics.KindFloat64:
+				o.ObserveFloat64(observables[i].(otelmetric.Float64Observable), s.Value.Float64(), opt)
+			}
+		}
+		return nil
+	}, unique...)
+	if err != nil {
+		return fmt.Errorf("failed to register runtime metrics: %w", err)
+	}
+
+	if runtime.GOOS == "linux" {
+		return startHostMetrics(meter)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package cobraotel
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/jzelinskie/cobrautil/v2"
+)
+
+// shutdowns collects the functions that stop the providers installed by RunE.
+type shutdowns struct {
+	mu  sync.Mutex
+	fns []func(context.Context) error
+}
+
+func (s *shutdowns) add(fn func(context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fns = append(s.fns, fn)
+}
+
+// run calls every function in the reverse order they were added and forgets
+// them, so that it is safe to call more than once.
+func (s *shutdowns) run(ctx context.Context) error {
+	s.mu.Lock()
+	fns := s.fns
+	s.fns = nil
+	s.mu.Unlock()
+
+	var errs []error
+	for i := len(fns) - 1; i >= 0; i-- {
+		if err := fns[i](ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Shutdown flushes any buffered telemetry and stops the tracer and meter
+// providers installed by RunE, waiting until the provided context is
+// canceled.
+//
+// Commands should defer a call to Shutdown after RunE succeeds so that spans
+// that have yet to be exported are not lost when the process exits.
+// It is safe to call Shutdown more than once or if RunE installed nothing.
+func (b *Builder) Shutdown(ctx context.Context) error {
+	return b.shutdowns.run(ctx)
+}
+
+// WithFlusher registers Shutdown with the provided Flusher when RunE
+// succeeds, so that telemetry is flushed along with everything else at the end
+// of the process.
+func WithFlusher(f *cobrautil.Flusher) Option {
+	return func(b *Builder) { b.flusher = f }
+}
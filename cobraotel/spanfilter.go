@@ -0,0 +1,59 @@
+package cobraotel
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// newSpanNameDenylistProcessor creates a SpanProcessor that drops any spans
+// with names matching one of the provided glob patterns instead of forwarding
+// them to the next processor.
+//
+// Patterns use the syntax of path.Match, so "*" does not match "/".
+func newSpanNameDenylistProcessor(next trace.SpanProcessor, patterns []string) (trace.SpanProcessor, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid span name denylist pattern %q: %w", pattern, err)
+		}
+	}
+
+	return &spanNameDenylistProcessor{next: next, denylist: patterns}, nil
+}
+
+type spanNameDenylistProcessor struct {
+	next     trace.SpanProcessor
+	denylist []string
+}
+
+var _ trace.SpanProcessor = (*spanNameDenylistProcessor)(nil)
+
+func (p *spanNameDenylistProcessor) OnStart(parent context.Context, s trace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p *spanNameDenylistProcessor) OnEnd(s trace.ReadOnlySpan) {
+	if p.denied(s.Name()) {
+		return
+	}
+	p.next.OnEnd(s)
+}
+
+func (p *spanNameDenylistProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p *spanNameDenylistProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+func (p *spanNameDenylistProcessor) denied(name string) bool {
+	for _, pattern := range p.denylist {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
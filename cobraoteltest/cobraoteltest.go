@@ -0,0 +1,97 @@
+// Package cobraoteltest implements utilities for testing the instrumentation
+// of programs that configure OpenTelemetry with cobraotel.
+//
+// A Recorder configures tracing from flags exactly as a program using the
+// cobraotel builder would, but records spans in memory so that tests can
+// assert on them without running a collector.
+package cobraoteltest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/jzelinskie/cobrautil/v2/cobraotel"
+)
+
+// DefaultArgs are the arguments parsed before those provided to NewRecorder.
+//
+// They sample every trace.
+var DefaultArgs = []string{
+	"--otel-sample-ratio=1",
+}
+
+// Recorder is a command with the flags of a cobraotel.Builder whose spans are
+// recorded in memory.
+type Recorder struct {
+	Command *cobra.Command
+	Otel    *cobraotel.Builder
+
+	// Exporter records every span ended by the configured TracerProvider.
+	Exporter *tracetest.InMemoryExporter
+}
+
+// NewRecorder configures OpenTelemetry from the provided arguments, which are
+// parsed after DefaultArgs, and records every span in memory.
+//
+// The global TracerProvider and TextMapPropagator are replaced until the test
+// completes, so tests using a Recorder must not run in parallel.
+func NewRecorder(t testing.TB, args ...string) *Recorder {
+	t.Helper()
+
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+
+	r := &Recorder{Exporter: tracetest.NewInMemoryExporter()}
+	r.Otel = cobraotel.New("cobraoteltest", cobraotel.WithSpanProcessors(trace.NewSimpleSpanProcessor(r.Exporter)))
+	r.Command = &cobra.Command{
+		Use:     "cobraoteltest",
+		PreRunE: r.Otel.RunE(),
+	}
+	r.Otel.RegisterFlags(r.Command.Flags())
+
+	if err := r.Command.ParseFlags(append(append([]string{}, DefaultArgs...), args...)); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+	if err := r.Command.PreRunE(r.Command, nil); err != nil {
+		t.Fatalf("failed to configure OpenTelemetry: %v", err)
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := r.Otel.Shutdown(ctx); err != nil {
+			t.Errorf("failed to shut down OpenTelemetry: %v", err)
+		}
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	return r
+}
+
+// Spans returns every span recorded since the Recorder was created or last
+// reset.
+func (r *Recorder) Spans() tracetest.SpanStubs {
+	return r.Exporter.GetSpans()
+}
+
+// SpanNames returns the names of every span recorded since the Recorder was
+// created or last reset, in the order they ended.
+func (r *Recorder) SpanNames() []string {
+	spans := r.Spans()
+	names := make([]string, 0, len(spans))
+	for _, s := range spans {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// Reset forgets every span recorded so far.
+func (r *Recorder) Reset() {
+	r.Exporter.Reset()
+}
@@ -0,0 +1,33 @@
+package cobraoteltest_test
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+
+	"github.com/jzelinskie/cobrautil/v2/cobraoteltest"
+)
+
+func handle(ctx context.Context) {
+	_, span := otel.Tracer("myservice").Start(ctx, "handle")
+	defer span.End()
+}
+
+func TestRecorder(t *testing.T) {
+	r := cobraoteltest.NewRecorder(t, "--otel-service-name=myservice")
+
+	handle(context.Background())
+	if names := r.SpanNames(); len(names) != 1 || names[0] != "handle" {
+		t.Fatalf("expected only the handle span, got %v", names)
+	}
+
+	if name, ok := r.Spans()[0].Resource.Set().Value("service.name"); !ok || name.AsString() != "myservice" {
+		t.Fatalf("expected the service name from flags, got %v", name.Emit())
+	}
+
+	r.Reset()
+	if spans := r.Spans(); len(spans) != 0 {
+		t.Fatalf("expected no spans after reset, got %d", len(spans))
+	}
+}
@@ -0,0 +1,96 @@
+package cobraproclimits
+
+import (
+	"runtime/debug"
+	"strings"
+	"testing"
+
+	"github.com/KimMachineGun/automemlimit/memlimit"
+	"github.com/spf13/cobra"
+)
+
+func gcSettings() (gcPercent int, memoryLimit int64) {
+	gcPercent = debug.SetGCPercent(100)
+	debug.SetGCPercent(gcPercent)
+	return gcPercent, debug.SetMemoryLimit(-1)
+}
+
+func TestGCBallast(t *testing.T) {
+	defer func(provider memlimit.Provider) { memoryLimit = provider }(memoryLimit)
+	memoryLimit = memlimit.Limit(1 << 30)
+
+	gcPercent, limit := gcSettings()
+	for _, tt := range []struct {
+		name              string
+		args              []string
+		expectedErr       string
+		expectedGCPercent int
+		expectedLimit     int64
+		expectedData      int
+	}{
+		{
+			name:              "disabled",
+			expectedGCPercent: gcPercent,
+			expectedLimit:     limit,
+		},
+		{
+			name:              "allocate",
+			args:              []string{"--gc-ballast-bytes=1024"},
+			expectedGCPercent: gcPercent,
+			expectedLimit:     limit,
+			expectedData:      1024,
+		},
+		{
+			name:              "memlimit",
+			args:              []string{"--gc-ballast-bytes=1024", "--gc-ballast-strategy=memlimit"},
+			expectedGCPercent: -1,
+			expectedLimit:     1 << 30 * 9 / 10,
+		},
+		{
+			name:        "memlimit exceeding the limit",
+			args:        []string{"--gc-ballast-bytes=1073741824", "--gc-ballast-strategy=memlimit"},
+			expectedErr: "invalid --gc-ballast-bytes: 1073741824 exceeds 90% of the memory limit",
+		},
+		{
+			name:        "unknown strategy",
+			args:        []string{"--gc-ballast-bytes=1024", "--gc-ballast-strategy=other"},
+			expectedErr: "unknown GC ballast strategy: other",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			defer ResetGCBallast()
+
+			cmd := &cobra.Command{Use: "test"}
+			RegisterGCBallastFlags(cmd.Flags())
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := SetGCBallastRunE()(cmd, nil)
+			if tt.expectedErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.expectedErr) {
+					t.Fatalf("expected an error starting with %q, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if p, l := gcSettings(); p != tt.expectedGCPercent || l != tt.expectedLimit {
+				t.Errorf("expected GOGC=%d and GOMEMLIMIT=%d, got GOGC=%d and GOMEMLIMIT=%d", tt.expectedGCPercent, tt.expectedLimit, p, l)
+			}
+			if len(ballast.data) != tt.expectedData {
+				t.Errorf("expected a ballast of %d bytes, got %d", tt.expectedData, len(ballast.data))
+			}
+
+			ResetGCBallast()
+			if p, l := gcSettings(); p != gcPercent || l != limit {
+				t.Errorf("expected GOGC=%d and GOMEMLIMIT=%d after reset, got GOGC=%d and GOMEMLIMIT=%d", gcPercent, limit, p, l)
+			}
+			if ballast.data != nil {
+				t.Errorf("expected the ballast to be released after reset")
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+// Package cobraprometheus implements a builder for registering flags and
+// producing Cobra RunFuncs that push Prometheus metrics to a Pushgateway.
+package cobraprometheus
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jzelinskie/cobrautil/v2"
+	"github.com/jzelinskie/stringz"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Option is function used to configure Prometheus within a Cobra RunFunc.
+type Option func(*Builder)
+
+// New creates a Cobra RunFunc Builder for pushing Prometheus metrics.
+//
+// If empty, jobName defaults to the name of the running binary.
+func New(jobName string, opts ...Option) *Builder {
+	b := &Builder{
+		flagPrefix:  "metrics",
+		jobName:     stringz.DefaultEmpty(jobName, filepath.Base(os.Args[0])),
+		gatherer:    prometheus.DefaultGatherer,
+		preRunLevel: 0,
+		logger:      logr.Discard(),
+	}
+	for _, configure := range opts {
+		configure(b)
+	}
+	return b
+}
+
+// Builder is used to configure pushing Prometheus metrics via Cobra.
+//
+// This is intended for batch jobs and CLI invocations that do not live long
+// enough to be scraped.
+type Builder struct {
+	flagPrefix  string
+	jobName     string
+	gatherer    prometheus.Gatherer
+	logger      logr.Logger
+	preRunLevel int
+	flusher     *cobrautil.Flusher
+
+	mu     sync.Mutex
+	pusher *push.Pusher
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func (b *Builder) prefix(s string) string {
+	return cobrautil.PrefixJoiner(b.flagPrefix)(s)
+}
+
+// RegisterFlags adds flags for configuring pushing Prometheus metrics.
+//
+// The following flags are added:
+// - "$PREFIX-push-endpoint"
+// - "$PREFIX-push-job"
+// - "$PREFIX-push-interval"
+func (b *Builder) RegisterFlags(flags *pflag.FlagSet) {
+	flags.String(b.prefix("push-endpoint"), "", "Prometheus Pushgateway endpoint metrics are pushed to (disabled if empty)")
+	flags.String(b.prefix("push-job"), b.jobName, "job name used when pushing metrics to the Prometheus Pushgateway")
+	flags.Duration(b.prefix("push-interval"), 0, "how often metrics are pushed while running (only pushed on exit if zero)")
+}
+
+// RegisterNamedFlags adds the flags from RegisterFlags() to the "Metrics"
+// section of the provided NamedFlagSets.
+func (b *Builder) RegisterNamedFlags(nfs *cobrautil.NamedFlagSets) {
+	b.RegisterFlags(nfs.FlagSet("Metrics"))
+}
+
+// RunE returns a Cobra RunFunc that configures pushing metrics to a
+// Pushgateway and, if configured, starts periodically pushing them in the
+// background.
+//
+// PostRunE or Flush must be used to stop the background pushing and push the
+// final values of the metrics.
+//
+// The required flags can be added to a command by using RegisterFlags().
+func (b *Builder) RunE() cobrautil.CobraRunFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if cobrautil.IsBuiltinCommand(cmd) {
+			return nil // No-op for builtins
+		}
+
+		endpoint := cobrautil.MustGetStringExpanded(cmd, b.prefix("push-endpoint"))
+		if endpoint == "" {
+			return nil
+		}
+
+		job := cobrautil.MustGetString(cmd, b.prefix("push-job"))
+		interval := cobrautil.MustGetDuration(cmd, b.prefix("push-interval"))
+		if interval < 0 {
+			return fmt.Errorf("invalid --%s: must not be negative", b.prefix("push-interval"))
+		}
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		b.pusher = push.New(endpoint, job).Gatherer(b.gatherer)
+		if interval > 0 {
+			b.stop = make(chan struct{})
+			b.done = make(chan struct{})
+			go b.pushPeriodically(cmd.Context(), b.pusher, interval, b.stop, b.done)
+		}
+		if b.flusher != nil {
+			b.flusher.Register("prometheus", b.Flush)
+		}
+
+		b.logger.V(b.preRunLevel).Info(
+			"configured prometheus pushgateway",
+			"endpoint", endpoint,
+			"job", job,
+			"interval", interval,
+		)
+		return nil
+	}
+}
+
+// PostRunE returns a Cobra RunFunc that stops any periodic pushing started by
+// RunE and pushes the final values of the metrics to the Pushgateway.
+//
+// Cobra does not run PostRunE when RunE returns an error, so the final values
+// of failed commands are only pushed if Flush is called, e.g. deferred within
+// RunE or via WithFlusher and cobrautil.Main.
+func (b *Builder) PostRunE() cobrautil.CobraRunFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		// The command's context may already be canceled, but the final values
+		// should still be pushed.
+		return b.Flush(context.Background())
+	}
+}
+
+// Flush stops any periodic pushing started by RunE and pushes the final
+// values of the metrics to the Pushgateway, giving up when the provided
+// context is canceled.
+//
+// It is safe to call Flush more than once or if pushing is disabled; only the
+// first successful call pushes.
+func (b *Builder) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pusher == nil {
+		return nil
+	}
+
+	if b.stop != nil {
+		close(b.stop)
+		<-b.done
+		b.stop, b.done = nil, nil
+	}
+
+	if err := b.pusher.PushContext(ctx); err != nil {
+		return fmt.Errorf("failed to push metrics: %w", err)
+	}
+	b.pusher = nil
+
+	b.logger.V(b.preRunLevel).Info("pushed metrics to prometheus pushgateway")
+	return nil
+}
+
+func (b *Builder) pushPeriodically(ctx context.Context, pusher *push.Pusher, interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := pusher.PushContext(ctx); err != nil {
+				b.logger.Error(err, "failed to push metrics to prometheus pushgateway")
+			}
+		}
+	}
+}
+
+// WithLogger configures logging of pushing metrics.
+func WithLogger(logger logr.Logger) Option {
+	return func(b *Builder) { b.logger = logger }
+}
+
+// WithFlagPrefix defines prefix used with the generated flags.
+//
+// Defaults to "metrics".
+func WithFlagPrefix(flagPrefix string) Option {
+	return func(b *Builder) { b.flagPrefix = flagPrefix }
+}
+
+// WithPreRunLevel defines the logging level used for pre-run log messages.
+//
+// Defaults to "debug".
+func WithPreRunLevel(preRunLevel int) Option {
+	return func(b *Builder) { b.preRunLevel = preRunLevel }
+}
+
+// WithGatherer defines the source of the metrics that are pushed.
+//
+// Defaults to prometheus.DefaultGatherer.
+func WithGatherer(gatherer prometheus.Gatherer) Option {
+	return func(b *Builder) { b.gatherer = gatherer }
+}
+
+// WithFlusher registers Flush with the provided Flusher when RunE configures
+// pushing, so that the final values of the metrics are pushed within the
+// "flush-timeout" along with everything else at the end of the process.
+func WithFlusher(f *cobrautil.Flusher) Option {
+	return func(b *Builder) { b.flusher = f }
+}
@@ -0,0 +1,116 @@
+package cobraprometheus_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil/v2"
+	"github.com/jzelinskie/cobrautil/v2/cobraprometheus"
+)
+
+// pushgateway records the pushes it receives.
+type pushgateway struct {
+	mu     sync.Mutex
+	pushes []string
+}
+
+func (p *pushgateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pushes = append(p.pushes, r.Method+" "+r.URL.Path+" "+string(body))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (p *pushgateway) Pushes() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.pushes...)
+}
+
+// newCommand creates a command that pushes the "jobs_total" counter to a new
+// Pushgateway after running run.
+func newCommand(t *testing.T, run func(cmd *cobra.Command, b *cobraprometheus.Builder) error, opts ...cobraprometheus.Option) (*cobra.Command, *pushgateway) {
+	t.Helper()
+
+	gateway := &pushgateway{}
+	srv := httptest.NewServer(gateway)
+	t.Cleanup(srv.Close)
+
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "jobs_total"})
+	registry.MustRegister(counter)
+
+	b := cobraprometheus.New("myjob", append([]cobraprometheus.Option{cobraprometheus.WithGatherer(registry)}, opts...)...)
+	cmd := &cobra.Command{
+		Use:      "myjob",
+		PreRunE:  b.RunE(),
+		PostRunE: b.PostRunE(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			counter.Inc()
+			return run(cmd, b)
+		},
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+	b.RegisterFlags(cmd.Flags())
+	cmd.SetArgs([]string{"--metrics-push-endpoint", srv.URL})
+	return cmd, gateway
+}
+
+func TestPostRunE(t *testing.T) {
+	cmd, gateway := newCommand(t, func(*cobra.Command, *cobraprometheus.Builder) error { return nil })
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	pushes := gateway.Pushes()
+	if len(pushes) != 1 || !strings.HasPrefix(pushes[0], "PUT /metrics/job/myjob ") || !strings.Contains(pushes[0], "jobs_total") {
+		t.Fatalf("expected the counter to be pushed once, got %q", pushes)
+	}
+}
+
+func TestFlushFailedCommand(t *testing.T) {
+	cmd, gateway := newCommand(t, func(cmd *cobra.Command, b *cobraprometheus.Builder) (err error) {
+		defer func() { err = errors.Join(err, b.Flush(cmd.Context())) }()
+		return errors.New("job failed")
+	})
+	if err := cmd.ExecuteContext(context.Background()); err == nil || err.Error() != "job failed" {
+		t.Fatalf("expected the job to fail, got %v", err)
+	}
+
+	// PostRunE is skipped, but the deferred Flush pushes the final values.
+	if pushes := gateway.Pushes(); len(pushes) != 1 || !strings.Contains(pushes[0], "jobs_total") {
+		t.Fatalf("expected the counter to be pushed once, got %q", pushes)
+	}
+}
+
+func TestWithFlusher(t *testing.T) {
+	flusher := cobrautil.NewFlusher()
+	cmd, gateway := newCommand(t, func(*cobra.Command, *cobraprometheus.Builder) error {
+		return errors.New("job failed")
+	}, cobraprometheus.WithFlusher(flusher))
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected the job to fail")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := flusher.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if pushes := gateway.Pushes(); len(pushes) != 1 || !strings.Contains(pushes[0], "jobs_total") {
+		t.Fatalf("expected the counter to be pushed once, got %q", pushes)
+	}
+}
@@ -0,0 +1,209 @@
+// Package cobrastate implements a builder for registering a flag that
+// configures a directory used to persist small amounts of state between
+// invocations of a program (e.g. update check timestamps or caches).
+package cobrastate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/go-logr/logr"
+	"github.com/jzelinskie/cobrautil/v2"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Option is function used to configure the state directory within a Cobra
+// RunFunc.
+type Option func(*Builder)
+
+// New creates a Cobra RunFunc Builder for a program's state directory.
+//
+// The name of the program is used as the name of the directory created in
+// the OS-appropriate location for application state.
+func New(programName string, opts ...Option) *Builder {
+	b := &Builder{
+		flagPrefix:  "state",
+		programName: programName,
+		preRunLevel: 0,
+		logger:      logr.Discard(),
+	}
+	for _, configure := range opts {
+		configure(b)
+	}
+	return b
+}
+
+// Builder is used to configure a state directory via Cobra.
+type Builder struct {
+	flagPrefix  string
+	programName string
+	logger      logr.Logger
+	preRunLevel int
+}
+
+func (b *Builder) prefix(s string) string {
+	return cobrautil.PrefixJoiner(b.flagPrefix)(s)
+}
+
+// WithLogger configures logging of the selected state directory.
+func WithLogger(logger logr.Logger) Option {
+	return func(b *Builder) {
+		b.logger = logger
+	}
+}
+
+// WithFlagPrefix defines prefix used with the generated flags. Defaults to "state".
+func WithFlagPrefix(flagPrefix string) Option {
+	return func(b *Builder) {
+		b.flagPrefix = flagPrefix
+	}
+}
+
+// WithPreRunLevel defines the logging level used for pre-run log messages. Defaults to "debug".
+func WithPreRunLevel(preRunLevel int) Option {
+	return func(b *Builder) {
+		b.preRunLevel = preRunLevel
+	}
+}
+
+// RegisterFlags adds flags for configuring the state directory.
+//
+// The following flags are added:
+// - "$PREFIX-dir"
+func (b *Builder) RegisterFlags(flags *pflag.FlagSet) {
+	defaultDir, _ := DefaultDir(b.programName)
+	flags.String(b.prefix("dir"), defaultDir, "directory used to persist state between invocations")
+}
+
+// RegisterNamedFlags adds the flags from RegisterFlags() to the "State"
+// section of the provided NamedFlagSets.
+func (b *Builder) RegisterNamedFlags(nfs *cobrautil.NamedFlagSets) {
+	b.RegisterFlags(nfs.FlagSet("State"))
+}
+
+// RegisterFlagCompletion adds completion functions for the flags registered
+// by RegisterFlags().
+func (b *Builder) RegisterFlagCompletion(cmd *cobra.Command) error {
+	return cmd.RegisterFlagCompletionFunc(b.prefix("dir"), func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return nil, cobra.ShellCompDirectiveFilterDirs
+	})
+}
+
+// DirFromFlags returns the state directory configured by the flags
+// registered by RegisterFlags().
+func (b *Builder) DirFromFlags(cmd *cobra.Command) (Dir, error) {
+	path := cobrautil.MustGetStringExpanded(cmd, b.prefix("dir"))
+	if path == "" {
+		return "", fmt.Errorf("no state directory configured: --%s must be set", b.prefix("dir"))
+	}
+
+	b.logger.V(b.preRunLevel).Info("using state directory", "path", path)
+	return Dir(path), nil
+}
+
+// DefaultDir returns the OS-appropriate directory for storing the state of
+// the provided program:
+//
+//   - Linux and BSDs: $XDG_STATE_HOME/$PROGRAM, falling back to ~/.local/state/$PROGRAM
+//   - macOS: ~/Library/Application Support/$PROGRAM
+//   - Windows: %AppData%\$PROGRAM
+func DefaultDir(programName string) (string, error) {
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, programName), nil
+	}
+
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, programName), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", programName), nil
+}
+
+// Dir is a directory containing state files.
+type Dir string
+
+// Path returns the path of the provided state file.
+func (d Dir) Path(name string) string {
+	return filepath.Join(string(d), name)
+}
+
+// ReadJSON decodes the contents of the provided state file into v.
+//
+// If the file does not exist, the returned error matches fs.ErrNotExist.
+func (d Dir) ReadJSON(name string, v any) error {
+	data, err := os.ReadFile(d.Path(name))
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode state file %s: %w", name, err)
+	}
+	return nil
+}
+
+// WriteJSON atomically replaces the contents of the provided state file with
+// the JSON encoding of v, creating the directory if necessary.
+//
+// The file is written to a temporary file in the same directory that is
+// renamed over the original, so readers never observe a partial write.
+func (d Dir) WriteJSON(name string, v any) (err error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state file %s: %w", name, err)
+	}
+
+	path := d.Path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write state file %s: %w", name, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write state file %s: %w", name, err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write state file %s: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write state file %s: %w", name, err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to write state file %s: %w", name, err)
+	}
+	return nil
+}
+
+// Remove deletes the provided state file, if it exists.
+func (d Dir) Remove(name string) error {
+	if err := os.Remove(d.Path(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove state file %s: %w", name, err)
+	}
+	return nil
+}
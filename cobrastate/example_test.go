@@ -0,0 +1,50 @@
+package cobrastate_test
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil/v2/cobrastate"
+)
+
+func ExampleDir_WriteJSON() {
+	tmp, _ := os.MkdirTemp("", "cobrastate")
+	defer os.RemoveAll(tmp)
+
+	stateb := cobrastate.New("mycli")
+	cmd := &cobra.Command{Use: "mycli"}
+	stateb.RegisterFlags(cmd.Flags())
+	_ = cmd.Flags().Parse([]string{"--state-dir", tmp})
+
+	dir, err := stateb.DirFromFlags(cmd)
+	if err != nil {
+		panic(err)
+	}
+
+	type updateCheck struct {
+		LastChecked time.Time `json:"lastChecked"`
+	}
+
+	var state updateCheck
+	if err := dir.ReadJSON("update-check.json", &state); errors.Is(err, fs.ErrNotExist) {
+		fmt.Println("never checked")
+	}
+
+	state.LastChecked = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := dir.WriteJSON("update-check.json", state); err != nil {
+		panic(err)
+	}
+
+	if err := dir.ReadJSON("update-check.json", &state); err != nil {
+		panic(err)
+	}
+	fmt.Println(state.LastChecked.Format(time.DateOnly))
+	// Output:
+	// never checked
+	// 2024-01-01
+}
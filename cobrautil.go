@@ -1,71 +1,23 @@
 package cobrautil
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
+	"regexp"
+	"runtime"
 	"strings"
 
-	"github.com/go-logr/logr"
-	"github.com/joho/godotenv"
 	"github.com/jzelinskie/stringz"
 	"github.com/spf13/cobra"
-	"github.com/spf13/pflag"
-	"github.com/spf13/viper"
+
+	"github.com/jzelinskie/cobrautil/v2/internal/builtins"
 )
 
 // IsBuiltinCommand checks against a hard-coded list of the names of commands
 // that cobra provides out-of-the-box.
 func IsBuiltinCommand(cmd *cobra.Command) bool {
-	return stringz.SliceContains([]string{
-		"help [command]",
-		"completion [command]",
-	},
-		cmd.Use,
-	)
-}
-
-// SyncViperPreRunE returns a CobraRunFunc that synchronizes Viper environment
-// flags with the provided prefix.
-//
-// Thanks to Carolyn Van Slyck: https://github.com/carolynvs/stingoftheviper
-func SyncViperPreRunE(prefix string) CobraRunFunc {
-	prefix = strings.ReplaceAll(strings.ToUpper(prefix), "-", "_")
-	return func(cmd *cobra.Command, args []string) error {
-		if IsBuiltinCommand(cmd) {
-			return nil // No-op for builtins
-		}
-
-		v := viper.New()
-		v.AllowEmptyEnv(true)
-		viper.SetEnvPrefix(prefix)
-
-		cmd.Flags().VisitAll(func(f *pflag.Flag) {
-			suffix := strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
-			_ = v.BindEnv(f.Name, prefix+"_"+suffix)
-
-			if !f.Changed && v.IsSet(f.Name) {
-				val := v.Get(f.Name)
-				_ = cmd.Flags().Set(f.Name, fmt.Sprintf("%v", val))
-			}
-		})
-
-		return nil
-	}
-}
-
-// SyncViperDotEnvPreRunE returns a CobraRunFunc that loads a .dotenv file
-// before synchronizing Viper environment flags with the provided prefix.
-//
-// If empty, envfilePath defaults to ".env".
-// The .dotenv file is loaded first before any additional Viper behavior.
-func SyncViperDotEnvPreRunE(prefix, envfilePath string, l logr.Logger) CobraRunFunc {
-	if err := godotenv.Load(stringz.DefaultEmpty(envfilePath, ".env")); err != nil {
-		l.V(2).Info(
-			"skipped loading dotenv",
-			"path", envfilePath,
-			"err", err,
-		)
-	}
-	return SyncViperPreRunE(prefix)
+	return builtins.IsBuiltinCommand(cmd)
 }
 
 // CobraRunFunc is the signature of cobra.Command RunFuncs.
@@ -83,6 +35,42 @@ func CommandStack(cmdfns ...CobraRunFunc) CobraRunFunc {
 	}
 }
 
+// CommandStackAll chains together a collection of CobraRunFuncs into one
+// that runs every function, even after one fails, and returns all of the
+// errors joined together.
+//
+// Each error is annotated with the position and name of the function that
+// returned it, so that every misconfigured flag can be reported at once.
+// This is intended for functions that only validate configuration: functions
+// that depend on the side effects of earlier functions should use
+// CommandStack instead.
+func CommandStackAll(cmdfns ...CobraRunFunc) CobraRunFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		var errs []error
+		for i, cmdfn := range cmdfns {
+			if err := cmdfn(cmd, args); err != nil {
+				errs = append(errs, fmt.Errorf("stage %d (%s): %w", i+1, funcName(cmdfn), err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// funcName returns the name of the package and function that created fn,
+// e.g. "cobraotel.(*Builder).RunE".
+func funcName(fn CobraRunFunc) string {
+	f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer())
+	if f == nil {
+		return "unknown"
+	}
+
+	// Closures are named after the function that returned them.
+	name := closureSuffix.ReplaceAllString(f.Name(), "")
+	return name[strings.LastIndex(name, "/")+1:]
+}
+
+var closureSuffix = regexp.MustCompile(`(\.func\d+)+$`)
+
 // PrefixJoiner joins a list of strings with the "-" separator, including the provided prefix string
 //
 // example: PrefixJoiner("hi")("how", "are", "you") = "hi-how-are-you"
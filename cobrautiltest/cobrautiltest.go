@@ -0,0 +1,224 @@
+// Package cobrautiltest implements utilities for testing programs composed
+// from the builders in this module.
+//
+// A Stack brings up logging, tracing, a gRPC server, and an HTTP server from
+// flags exactly as a program using the builders would, but listens on
+// ephemeral local ports and records spans in memory so that tests can
+// exercise the full stack over real network connections.
+package cobrautiltest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/jzelinskie/cobrautil/v2"
+	"github.com/jzelinskie/cobrautil/v2/cobragrpc"
+	"github.com/jzelinskie/cobrautil/v2/cobrahttp"
+	"github.com/jzelinskie/cobrautil/v2/cobraotel"
+	"github.com/jzelinskie/cobrautil/v2/cobraviper"
+	"github.com/jzelinskie/cobrautil/v2/cobrazerolog"
+)
+
+// EnvPrefix is the prefix of the environment variables synchronized with the
+// flags of a Stack.
+const EnvPrefix = "COBRAUTILTEST"
+
+// DefaultArgs are the arguments parsed before those provided to NewStack.
+//
+// They enable both servers and sample every trace.
+var DefaultArgs = []string{
+	"--grpc-enabled",
+	"--http-enabled",
+	"--otel-sample-ratio=1",
+	"--log-level=error",
+}
+
+// Stack is a running set of every builder configured from flags.
+type Stack struct {
+	Command *cobra.Command
+
+	Zerolog *cobrazerolog.Builder
+	Otel    *cobraotel.Builder
+	GRPC    *cobragrpc.Builder
+	HTTP    *cobrahttp.Builder
+
+	// Logger is the logger configured by the Zerolog builder.
+	Logger zerolog.Logger
+
+	// Spans records every span ended by the configured TracerProvider.
+	Spans *tracetest.InMemoryExporter
+
+	// Health is the health service registered on the gRPC server.
+	Health *health.Server
+
+	GRPCServer *grpc.Server
+	HTTPServer *http.Server
+
+	// GRPCAddr and HTTPAddr are the addresses the servers are listening on.
+	GRPCAddr string
+	HTTPAddr string
+
+	grpcDone chan error
+	httpDone chan error
+}
+
+// NewStack configures and starts every builder from the provided arguments,
+// which are parsed after DefaultArgs.
+//
+// Environment variables with the EnvPrefix are synchronized with the flags
+// the same way cobraviper.SyncPreRunE would for a program. The servers listen on
+// ephemeral ports on the loopback interface regardless of the configured
+// addresses and are gracefully stopped when the test completes.
+func NewStack(t testing.TB, handler http.Handler, args ...string) *Stack {
+	t.Helper()
+
+	s := &Stack{
+		Spans:    tracetest.NewInMemoryExporter(),
+		Health:   health.NewServer(),
+		grpcDone: make(chan error, 1),
+		httpDone: make(chan error, 1),
+	}
+	s.Zerolog = cobrazerolog.New(cobrazerolog.WithTarget(func(l zerolog.Logger) { s.Logger = l }))
+	s.Otel = cobraotel.New("cobrautiltest", cobraotel.WithSpanProcessors(trace.NewSimpleSpanProcessor(s.Spans)))
+	s.GRPC = cobragrpc.New("cobrautiltest")
+	s.HTTP = cobrahttp.New("cobrautiltest", cobrahttp.WithHandler(handler))
+
+	s.Command = &cobra.Command{
+		Use: "cobrautiltest",
+		PreRunE: cobrautil.CommandStack(
+			cobraviper.SyncPreRunE(EnvPrefix),
+			s.Zerolog.RunE(),
+			s.Otel.RunE(),
+		),
+	}
+	s.Zerolog.RegisterFlags(s.Command.Flags())
+	s.Otel.RegisterFlags(s.Command.Flags())
+	s.GRPC.RegisterFlags(s.Command.Flags())
+	s.HTTP.RegisterFlags(s.Command.Flags())
+
+	if err := s.Command.ParseFlags(append(append([]string{}, DefaultArgs...), args...)); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+	if err := s.Command.PreRunE(s.Command, nil); err != nil {
+		t.Fatalf("failed to run builders: %v", err)
+	}
+
+	s.startGRPC(t)
+	s.startHTTP(t)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			t.Errorf("failed to shut down: %v", err)
+		}
+	})
+
+	return s
+}
+
+func (s *Stack) startGRPC(t testing.TB) {
+	t.Helper()
+
+	cfg, err := s.GRPC.ConfigFromFlags(s.Command)
+	if err != nil {
+		t.Fatalf("failed to configure gRPC server: %v", err)
+	}
+	if !cfg.Enabled {
+		close(s.grpcDone)
+		return
+	}
+
+	s.GRPCServer, err = s.GRPC.ServerFromFlags(s.Command)
+	if err != nil {
+		t.Fatalf("failed to create gRPC server: %v", err)
+	}
+	healthpb.RegisterHealthServer(s.GRPCServer, s.Health)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen for gRPC: %v", err)
+	}
+	s.GRPCAddr = l.Addr().String()
+	go func() {
+		s.grpcDone <- s.GRPCServer.Serve(l)
+		close(s.grpcDone)
+	}()
+}
+
+func (s *Stack) startHTTP(t testing.TB) {
+	t.Helper()
+
+	cfg, err := s.HTTP.ConfigFromFlags(s.Command)
+	if err != nil {
+		t.Fatalf("failed to configure HTTP server: %v", err)
+	}
+	if !cfg.Enabled {
+		close(s.httpDone)
+		return
+	}
+
+	s.HTTPServer = s.HTTP.ServerFromFlags(s.Command)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen for HTTP: %v", err)
+	}
+	s.HTTPAddr = l.Addr().String()
+	go func() {
+		if cfg.Insecure() {
+			s.httpDone <- s.HTTPServer.Serve(l)
+		} else {
+			s.httpDone <- s.HTTPServer.ServeTLS(l, cfg.TLSCertPath, cfg.TLSKeyPath)
+		}
+		close(s.httpDone)
+	}()
+}
+
+// Shutdown gracefully stops both servers, waiting for in-flight requests to
+// complete until the provided context is canceled.
+//
+// It is safe to call Shutdown more than once.
+func (s *Stack) Shutdown(ctx context.Context) error {
+	s.Health.Shutdown()
+
+	var errs []error
+	if s.HTTPServer != nil {
+		if err := s.HTTPServer.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if s.GRPCServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			s.GRPCServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			s.GRPCServer.Stop()
+			errs = append(errs, ctx.Err())
+		}
+	}
+
+	for _, done := range []chan error{s.grpcDone, s.httpDone} {
+		if err, ok := <-done; ok && err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, grpc.ErrServerStopped) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,223 @@
+package cobrautiltest_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/jzelinskie/cobrautil/v2/cobrautiltest"
+)
+
+// tracedHandler responds after recording a span and sleeping for the
+// duration in the "sleep" query parameter.
+var tracedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	_, span := otel.Tracer("cobrautiltest").Start(r.Context(), "handler")
+	defer span.End()
+
+	if sleep, err := time.ParseDuration(r.URL.Query().Get("sleep")); err == nil {
+		time.Sleep(sleep)
+	}
+	_, _ = io.WriteString(w, "ok")
+})
+
+func checkHealth(t *testing.T, addr string, creds credentials.TransportCredentials) healthpb.HealthCheckResponse_ServingStatus {
+	t.Helper()
+
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.Status
+}
+
+func get(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	return string(body)
+}
+
+func TestStackPlaintext(t *testing.T) {
+	s := cobrautiltest.NewStack(t, tracedHandler)
+
+	if status := checkHealth(t, s.GRPCAddr, insecure.NewCredentials()); status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expected gRPC server to be serving, got %s", status)
+	}
+
+	if body := get(t, http.DefaultClient, "http://"+s.HTTPAddr); body != "ok" {
+		t.Fatalf("unexpected response body: %q", body)
+	}
+
+	spans := s.Spans.GetSpans()
+	if len(spans) != 2 || spans[0].Name != "grpc.health.v1.Health/Check" || spans[1].Name != "handler" {
+		t.Fatalf("expected the gRPC and handler spans to be recorded, got %v", spans.Snapshots())
+	}
+}
+
+func TestStackGRPCTracingDisabled(t *testing.T) {
+	s := cobrautiltest.NewStack(t, tracedHandler, "--grpc-tracing-enabled=false")
+
+	if status := checkHealth(t, s.GRPCAddr, insecure.NewCredentials()); status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expected gRPC server to be serving, got %s", status)
+	}
+
+	if spans := s.Spans.GetSpans(); len(spans) != 0 {
+		t.Fatalf("expected no spans to be recorded, got %v", spans.Snapshots())
+	}
+}
+
+func TestStackTLS(t *testing.T) {
+	certPath, keyPath, pool := cobrautiltest.WriteCertificate(t)
+	s := cobrautiltest.NewStack(t, tracedHandler,
+		"--grpc-tls-cert-path="+certPath,
+		"--grpc-tls-key-path="+keyPath,
+		"--http-tls-cert-path="+certPath,
+		"--http-tls-key-path="+keyPath,
+	)
+
+	tlsConfig := &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	if status := checkHealth(t, s.GRPCAddr, credentials.NewTLS(tlsConfig)); status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expected gRPC server to be serving, got %s", status)
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	if body := get(t, client, "https://"+s.HTTPAddr); body != "ok" {
+		t.Fatalf("unexpected response body: %q", body)
+	}
+
+	// Clients that do not trust the certificate must be rejected.
+	untrusted := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: x509.NewCertPool(), MinVersion: tls.VersionTLS12}}}
+	if resp, err := untrusted.Get("https://" + s.HTTPAddr); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected untrusted client to fail the TLS handshake")
+	}
+}
+
+func TestStackGRPCMutualTLS(t *testing.T) {
+	certPath, keyPath, pool := cobrautiltest.WriteCertificate(t)
+	s := cobrautiltest.NewStack(t, tracedHandler,
+		"--grpc-tls-cert-path="+certPath,
+		"--grpc-tls-key-path="+keyPath,
+		"--grpc-tls-client-ca-path="+certPath,
+		"--grpc-client-auth=require-and-verify",
+	)
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig := &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if status := checkHealth(t, s.GRPCAddr, credentials.NewTLS(tlsConfig)); status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expected gRPC server to be serving, got %s", status)
+	}
+
+	// Clients that do not present a certificate must be rejected.
+	conn, err := grpc.Dial(s.GRPCAddr, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err == nil {
+		t.Fatal("expected client without a certificate to be rejected")
+	}
+}
+
+func TestStackEnvOverrides(t *testing.T) {
+	t.Setenv(cobrautiltest.EnvPrefix+"_OTEL_SERVICE_NAME", "from-env")
+	t.Setenv(cobrautiltest.EnvPrefix+"_LOG_LEVEL", "debug")
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.environment=test")
+	s := cobrautiltest.NewStack(t, tracedHandler)
+
+	// Flags explicitly provided take precedence over the environment.
+	logCfg, err := s.Zerolog.ConfigFromFlags(s.Command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logCfg.Level.String() != "error" {
+		t.Fatalf("expected log level from flags, got %s", logCfg.Level)
+	}
+
+	_ = get(t, http.DefaultClient, "http://"+s.HTTPAddr)
+	spans := s.Spans.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected one span, got %d", len(spans))
+	}
+
+	attrs := map[string]string{}
+	for _, kv := range spans[0].Resource.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	if attrs["service.name"] != "from-env" {
+		t.Fatalf("expected service name from the environment, got %q", attrs["service.name"])
+	}
+	if attrs["deployment.environment"] != "test" {
+		t.Fatalf("expected resource attributes from the environment, got %v", attrs)
+	}
+}
+
+func TestStackGracefulShutdown(t *testing.T) {
+	s := cobrautiltest.NewStack(t, tracedHandler)
+
+	done := make(chan string)
+	go func() {
+		resp, err := http.Get("http://" + s.HTTPAddr + "/?sleep=200ms")
+		if err != nil {
+			done <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		done <- string(body)
+	}()
+
+	// Wait for the request to be in-flight before shutting down.
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if body := <-done; body != "ok" {
+		t.Fatalf("expected in-flight request to complete, got %q", body)
+	}
+
+	if _, err := http.Get("http://" + s.HTTPAddr); err == nil {
+		t.Fatal("expected requests after shutdown to fail")
+	}
+}
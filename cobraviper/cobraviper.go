@@ -0,0 +1,65 @@
+// Package cobraviper implements Cobra RunFuncs that synchronize flags with
+// environment variables using Viper.
+//
+// This is separate from the root package so that programs that do not use
+// Viper do not depend on it.
+package cobraviper
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/joho/godotenv"
+	"github.com/jzelinskie/stringz"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/jzelinskie/cobrautil/v2/internal/builtins"
+)
+
+// SyncPreRunE returns a Cobra RunFunc that synchronizes Viper environment
+// flags with the provided prefix.
+//
+// Thanks to Carolyn Van Slyck: https://github.com/carolynvs/stingoftheviper
+func SyncPreRunE(prefix string) func(cmd *cobra.Command, args []string) error {
+	prefix = strings.ReplaceAll(strings.ToUpper(prefix), "-", "_")
+	return func(cmd *cobra.Command, args []string) error {
+		if builtins.IsBuiltinCommand(cmd) {
+			return nil // No-op for builtins
+		}
+
+		v := viper.New()
+		v.AllowEmptyEnv(true)
+		viper.SetEnvPrefix(prefix)
+
+		cmd.Flags().VisitAll(func(f *pflag.Flag) {
+			suffix := strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+			_ = v.BindEnv(f.Name, prefix+"_"+suffix)
+
+			if !f.Changed && v.IsSet(f.Name) {
+				val := v.Get(f.Name)
+				_ = cmd.Flags().Set(f.Name, fmt.Sprintf("%v", val))
+			}
+		})
+
+		return nil
+	}
+}
+
+// SyncDotEnvPreRunE returns a Cobra RunFunc that loads a .dotenv file before
+// synchronizing Viper environment flags with the provided prefix.
+//
+// If empty, envfilePath defaults to ".env".
+// The .dotenv file is loaded first before any additional Viper behavior.
+func SyncDotEnvPreRunE(prefix, envfilePath string, l logr.Logger) func(cmd *cobra.Command, args []string) error {
+	if err := godotenv.Load(stringz.DefaultEmpty(envfilePath, ".env")); err != nil {
+		l.V(2).Info(
+			"skipped loading dotenv",
+			"path", envfilePath,
+			"err", err,
+		)
+	}
+	return SyncPreRunE(prefix)
+}
@@ -0,0 +1,232 @@
+// Package cobrawatchdog implements a builder for registering flags and
+// producing a Cobra RunFunc that captures profiles of a process when its
+// resource utilization crosses configured thresholds.
+package cobrawatchdog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/metrics"
+	"runtime/pprof"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jzelinskie/cobrautil/v2"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Option is function used to configure the watchdog within a Cobra RunFunc.
+type Option func(*Builder)
+
+// New creates a Cobra RunFunc Builder for a profiling watchdog.
+func New(opts ...Option) *Builder {
+	b := &Builder{
+		flagPrefix:  "watchdog",
+		preRunLevel: 0,
+		logger:      logr.Discard(),
+	}
+	for _, configure := range opts {
+		configure(b)
+	}
+	return b
+}
+
+// Builder is used to configure a profiling watchdog via Cobra.
+//
+// The watchdog periodically samples runtime statistics and writes pprof
+// profiles when thresholds are crossed, so that data exists to investigate
+// incidents even when nobody was watching the process.
+type Builder struct {
+	flagPrefix  string
+	logger      logr.Logger
+	preRunLevel int
+}
+
+func (b *Builder) prefix(s string) string {
+	return cobrautil.PrefixJoiner(b.flagPrefix)(s)
+}
+
+// RegisterFlags adds flags for configuring the watchdog.
+//
+// The following flags are added:
+// - "$PREFIX-heap-threshold"
+// - "$PREFIX-goroutine-threshold"
+// - "$PREFIX-profile-dir"
+// - "$PREFIX-interval"
+// - "$PREFIX-cooldown"
+func (b *Builder) RegisterFlags(flags *pflag.FlagSet) {
+	flags.Int64(b.prefix("heap-threshold"), 0, "bytes of live heap objects above which a heap profile is captured (disabled if zero)")
+	flags.Int(b.prefix("goroutine-threshold"), 0, "number of goroutines above which a goroutine profile is captured (disabled if zero)")
+	flags.String(b.prefix("profile-dir"), os.TempDir(), "directory captured profiles are written to")
+	flags.Duration(b.prefix("interval"), 10*time.Second, "how often runtime statistics are sampled")
+	flags.Duration(b.prefix("cooldown"), 5*time.Minute, "minimum time between captures of the same kind of profile")
+}
+
+// RegisterNamedFlags adds the flags from RegisterFlags() to the "Watchdog"
+// section of the provided NamedFlagSets.
+func (b *Builder) RegisterNamedFlags(nfs *cobrautil.NamedFlagSets) {
+	b.RegisterFlags(nfs.FlagSet("Watchdog"))
+}
+
+// RegisterFlagCompletion adds completion functions for the flags registered
+// by RegisterFlags().
+func (b *Builder) RegisterFlagCompletion(cmd *cobra.Command) error {
+	return cmd.RegisterFlagCompletionFunc(b.prefix("profile-dir"), func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return nil, cobra.ShellCompDirectiveFilterDirs
+	})
+}
+
+// Config is the configuration of the watchdog resolved from the flags
+// registered by RegisterFlags().
+type Config struct {
+	HeapThreshold      int64
+	GoroutineThreshold int
+	ProfileDir         string
+	Interval           time.Duration
+	Cooldown           time.Duration
+}
+
+// Enabled returns true if any threshold is configured.
+func (c Config) Enabled() bool {
+	return c.HeapThreshold > 0 || c.GoroutineThreshold > 0
+}
+
+// ConfigFromFlags resolves the configuration of the watchdog from the flags
+// registered by RegisterFlags() without starting anything.
+func (b *Builder) ConfigFromFlags(cmd *cobra.Command) (Config, error) {
+	cfg := Config{
+		HeapThreshold:      cobrautil.MustGetInt64(cmd, b.prefix("heap-threshold")),
+		GoroutineThreshold: cobrautil.MustGetInt(cmd, b.prefix("goroutine-threshold")),
+		ProfileDir:         cobrautil.MustGetStringExpanded(cmd, b.prefix("profile-dir")),
+		Interval:           cobrautil.MustGetDuration(cmd, b.prefix("interval")),
+		Cooldown:           cobrautil.MustGetDuration(cmd, b.prefix("cooldown")),
+	}
+
+	if cfg.Enabled() && cfg.Interval <= 0 {
+		return Config{}, fmt.Errorf("invalid --%s: must be positive", b.prefix("interval"))
+	}
+
+	return cfg, nil
+}
+
+// RunE returns a Cobra RunFunc that starts the watchdog in the background
+// until the command's context is canceled.
+//
+// The required flags can be added to a command by using RegisterFlags().
+func (b *Builder) RunE() cobrautil.CobraRunFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if cobrautil.IsBuiltinCommand(cmd) {
+			return nil // No-op for builtins
+		}
+
+		cfg, err := b.ConfigFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		if !cfg.Enabled() {
+			return nil
+		}
+
+		if err := os.MkdirAll(cfg.ProfileDir, 0o700); err != nil {
+			return fmt.Errorf("failed to create watchdog profile directory: %w", err)
+		}
+
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		go b.watch(ctx, cfg)
+
+		b.logger.V(b.preRunLevel).Info(
+			"started watchdog",
+			"heapThreshold", cfg.HeapThreshold,
+			"goroutineThreshold", cfg.GoroutineThreshold,
+			"profileDir", cfg.ProfileDir,
+			"interval", cfg.Interval,
+			"cooldown", cfg.Cooldown,
+		)
+		return nil
+	}
+}
+
+const (
+	heapMetric      = "/memory/classes/heap/objects:bytes"
+	goroutineMetric = "/sched/goroutines:goroutines"
+)
+
+func (b *Builder) watch(ctx context.Context, cfg Config) {
+	samples := []metrics.Sample{{Name: heapMetric}, {Name: goroutineMetric}}
+	lastCaptured := make(map[string]time.Time)
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			metrics.Read(samples)
+			heap, goroutines := samples[0].Value.Uint64(), samples[1].Value.Uint64()
+
+			if cfg.HeapThreshold > 0 && heap > uint64(cfg.HeapThreshold) {
+				b.capture(cfg, "heap", lastCaptured, now, "heapBytes", heap)
+			}
+			if cfg.GoroutineThreshold > 0 && goroutines > uint64(cfg.GoroutineThreshold) {
+				b.capture(cfg, "goroutine", lastCaptured, now, "goroutines", goroutines)
+			}
+		}
+	}
+}
+
+// capture writes the named profile unless one was captured within the
+// cooldown.
+func (b *Builder) capture(cfg Config, profile string, lastCaptured map[string]time.Time, now time.Time, keysAndValues ...any) {
+	if last, ok := lastCaptured[profile]; ok && now.Sub(last) < cfg.Cooldown {
+		return
+	}
+	lastCaptured[profile] = now
+
+	path := filepath.Join(cfg.ProfileDir, fmt.Sprintf("%s-%s.pb.gz", profile, now.UTC().Format("20060102T150405Z")))
+	if err := writeProfile(profile, path); err != nil {
+		b.logger.Error(err, "failed to capture profile", "profile", profile)
+		return
+	}
+
+	b.logger.Info("watchdog threshold crossed; captured profile", append([]any{"profile", profile, "path", path}, keysAndValues...)...)
+}
+
+func writeProfile(profile, path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if err := pprof.Lookup(profile).WriteTo(f, 0); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WithLogger configures logging of the watchdog.
+func WithLogger(logger logr.Logger) Option {
+	return func(b *Builder) { b.logger = logger }
+}
+
+// WithFlagPrefix defines prefix used with the generated flags.
+//
+// Defaults to "watchdog".
+func WithFlagPrefix(flagPrefix string) Option {
+	return func(b *Builder) { b.flagPrefix = flagPrefix }
+}
+
+// WithPreRunLevel defines the logging level used for pre-run log messages.
+//
+// Defaults to "debug".
+func WithPreRunLevel(preRunLevel int) Option {
+	return func(b *Builder) { b.preRunLevel = preRunLevel }
+}
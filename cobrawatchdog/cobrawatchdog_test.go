@@ -0,0 +1,112 @@
+package cobrawatchdog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// profiles returns the names of the profiles written to dir.
+func profiles(t *testing.T, dir, profile string) []string {
+	t.Helper()
+
+	matches, err := filepath.Glob(filepath.Join(dir, profile+"-*.pb.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestWatch(t *testing.T) {
+	cfg := Config{
+		HeapThreshold:      1 << 62,
+		GoroutineThreshold: 1,
+		ProfileDir:         t.TempDir(),
+		Interval:           10 * time.Millisecond,
+		Cooldown:           time.Hour,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		New().watch(ctx, cfg)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// The goroutine threshold is crossed by the test's own goroutines.
+	for deadline := time.Now().Add(5 * time.Second); len(profiles(t, cfg.ProfileDir, "goroutine")) == 0; time.Sleep(cfg.Interval) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected a goroutine profile to be captured")
+		}
+	}
+
+	// Later samples crossing the threshold are within the cooldown.
+	time.Sleep(10 * cfg.Interval)
+	if got := profiles(t, cfg.ProfileDir, "goroutine"); len(got) != 1 {
+		t.Fatalf("expected a single goroutine profile within the cooldown, got %v", got)
+	}
+	if got := profiles(t, cfg.ProfileDir, "heap"); len(got) != 0 {
+		t.Fatalf("expected no heap profile below the threshold, got %v", got)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	cfg := Config{ProfileDir: t.TempDir(), Cooldown: time.Minute}
+	b := New()
+	lastCaptured := make(map[string]time.Time)
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, tt := range []struct {
+		name     string
+		profile  string
+		after    time.Duration
+		expected []string
+	}{
+		{
+			name:     "first capture",
+			profile:  "heap",
+			expected: []string{"heap-20240102T030405Z.pb.gz"},
+		},
+		{
+			name:     "within cooldown",
+			profile:  "heap",
+			after:    30 * time.Second,
+			expected: []string{"heap-20240102T030405Z.pb.gz"},
+		},
+		{
+			name:     "other profile within cooldown",
+			profile:  "goroutine",
+			after:    30 * time.Second,
+			expected: []string{"goroutine-20240102T030435Z.pb.gz"},
+		},
+		{
+			name:     "after cooldown",
+			profile:  "heap",
+			after:    time.Minute,
+			expected: []string{"heap-20240102T030405Z.pb.gz", "heap-20240102T030505Z.pb.gz"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b.capture(cfg, tt.profile, lastCaptured, start.Add(tt.after))
+
+			got := profiles(t, cfg.ProfileDir, tt.profile)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("expected profiles %v, got %v", tt.expected, got)
+			}
+			for i, path := range got {
+				if filepath.Base(path) != tt.expected[i] {
+					t.Fatalf("expected profiles %v, got %v", tt.expected, got)
+				}
+				if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+					t.Fatalf("expected %s to contain a profile, got %v", path, err)
+				}
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@
 package cobrazerolog
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -42,6 +43,7 @@ type Builder struct {
 	asyncSize         int
 	asyncPollInterval time.Duration
 	preRunLevel       zerolog.Level
+	flusher           *cobrautil.Flusher
 }
 
 func (b *Builder) prefix(s string) string {
@@ -58,6 +60,12 @@ func (b *Builder) RegisterFlags(flags *pflag.FlagSet) {
 	flags.String(b.prefix("format"), "auto", `format of logs ("auto", "console", "json")`)
 }
 
+// RegisterNamedFlags adds the flags from RegisterFlags() to the "Logging"
+// section of the provided NamedFlagSets.
+func (b *Builder) RegisterNamedFlags(nfs *cobrautil.NamedFlagSets) {
+	b.RegisterFlags(nfs.FlagSet("Logging"))
+}
+
 // RegisterFlagCompletion adds completion functions supported flags.
 //
 // The following flags are completed:
@@ -79,6 +87,50 @@ func (b *Builder) RegisterFlagCompletion(cmd *cobra.Command) error {
 	return nil
 }
 
+// Config is the configuration of Zerolog resolved from the flags registered
+// by RegisterFlags().
+type Config struct {
+	Level  zerolog.Level
+	Format string
+	Async  bool
+}
+
+// Console returns true if logs are formatted for humans rather than as JSON.
+func (c Config) Console() bool {
+	return c.Format == "console" || c.Format == "auto" && isatty.IsTerminal(os.Stdout.Fd())
+}
+
+// ConfigFromFlags resolves the configuration of Zerolog from the flags
+// registered by RegisterFlags() without configuring anything.
+func (b *Builder) ConfigFromFlags(cmd *cobra.Command) (Config, error) {
+	cfg := Config{
+		Format: cobrautil.MustGetString(cmd, b.prefix("format")),
+		Async:  b.async,
+	}
+
+	level := strings.ToLower(cobrautil.MustGetString(cmd, b.prefix("level")))
+	switch level {
+	case "trace":
+		cfg.Level = zerolog.TraceLevel
+	case "debug":
+		cfg.Level = zerolog.DebugLevel
+	case "info":
+		cfg.Level = zerolog.InfoLevel
+	case "warn":
+		cfg.Level = zerolog.WarnLevel
+	case "error":
+		cfg.Level = zerolog.ErrorLevel
+	case "fatal":
+		cfg.Level = zerolog.FatalLevel
+	case "panic":
+		cfg.Level = zerolog.PanicLevel
+	default:
+		return Config{}, fmt.Errorf("unknown log level: %s", level)
+	}
+
+	return cfg, nil
+}
+
 // RunE returns a Cobra RunFunc that configures Zerolog.
 //
 // The required flags can be added to a command by using RegisterFlags().
@@ -88,42 +140,31 @@ func (b *Builder) RunE() cobrautil.CobraRunFunc {
 			return nil // No-op for builtins
 		}
 
-		var output io.Writer
+		cfg, err := b.ConfigFromFlags(cmd)
+		if err != nil {
+			return err
+		}
 
-		format := cobrautil.MustGetString(cmd, b.prefix("format"))
-		if format == "console" || format == "auto" && isatty.IsTerminal(os.Stdout.Fd()) {
+		var output io.Writer
+		if cfg.Console() {
 			output = zerolog.ConsoleWriter{Out: os.Stderr}
 		} else {
 			output = os.Stderr
 		}
 
-		if b.async {
-			output = diode.NewWriter(output, 1000, 10*time.Millisecond, func(missed int) {
+		if cfg.Async {
+			// Hide any Close method of the output so that closing the diode
+			// to flush it does not close stderr.
+			w := diode.NewWriter(struct{ io.Writer }{output}, 1000, 10*time.Millisecond, func(missed int) {
 				fmt.Printf("Logger Dropped %d messages", missed)
 			})
+			if b.flusher != nil {
+				b.flusher.Register("zerolog", func(context.Context) error { return w.Close() })
+			}
+			output = w
 		}
 
-		l := zerolog.New(output).With().Timestamp().Logger()
-
-		level := strings.ToLower(cobrautil.MustGetString(cmd, b.prefix("level")))
-		switch level {
-		case "trace":
-			l = l.Level(zerolog.TraceLevel)
-		case "debug":
-			l = l.Level(zerolog.DebugLevel)
-		case "info":
-			l = l.Level(zerolog.InfoLevel)
-		case "warn":
-			l = l.Level(zerolog.WarnLevel)
-		case "error":
-			l = l.Level(zerolog.ErrorLevel)
-		case "fatal":
-			l = l.Level(zerolog.FatalLevel)
-		case "panic":
-			l = l.Level(zerolog.PanicLevel)
-		default:
-			return fmt.Errorf("unknown log level: %s", level)
-		}
+		l := zerolog.New(output).With().Timestamp().Logger().Level(cfg.Level)
 
 		if b.target != nil {
 			b.target(l)
@@ -132,10 +173,10 @@ func (b *Builder) RunE() cobrautil.CobraRunFunc {
 		}
 
 		l.WithLevel(b.preRunLevel).
-			Str("format", format).
-			Str("log_level", level).
+			Str("format", cfg.Format).
+			Str("log_level", cfg.Level.String()).
 			Str("provider", "zerolog").
-			Bool("async", b.async).
+			Bool("async", cfg.Async).
 			Msg("configured logging")
 		return nil
 	}
@@ -170,3 +211,12 @@ func WithAsync(size int, pollInterval time.Duration) Option {
 func WithTarget(fn func(zerolog.Logger)) Option {
 	return func(b *Builder) { b.target = fn }
 }
+
+// WithFlusher registers a function that drains the buffer of the async
+// writer with the provided Flusher, so that the last messages logged are
+// written before the process exits.
+//
+// This has no effect unless WithAsync is also provided.
+func WithFlusher(f *cobrautil.Flusher) Option {
+	return func(b *Builder) { b.flusher = f }
+}
@@ -0,0 +1,96 @@
+package cobrautil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-logr/logr"
+	"github.com/joho/godotenv"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// RegisterDotEnvFlags registers the flags used by DotEnvPreRunE.
+//
+// The following flags are added:
+// - "env-file"
+// - "env-search-parents"
+// - "env-search-boundary"
+func RegisterDotEnvFlags(flags *pflag.FlagSet) {
+	flags.String("env-file", ".env", "name of the dotenv file loaded into the environment")
+	flags.Bool("env-search-parents", false, "also load dotenv files found in parent directories of the working directory")
+	flags.String("env-search-boundary", ".git", "name of a file or directory marking the last directory searched for dotenv files")
+}
+
+// DotEnvPreRunE returns a CobraRunFunc that loads dotenv files into the
+// environment as configured by the flags from RegisterDotEnvFlags().
+//
+// When searching parent directories, the search begins in the working
+// directory and walks upward until a directory containing the boundary marker
+// (e.g. the root of a git repository) or the root of the filesystem is
+// reached. Variables already present in the environment are never
+// overwritten and files closer to the working directory take precedence over
+// those further away:
+//
+//	environment > ./.env > ../.env > ... > $BOUNDARY/.env
+//
+// This should be run before cobraviper.SyncPreRunE so that the loaded variables can
+// be used to set flags.
+func DotEnvPreRunE(l logr.Logger) CobraRunFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if IsBuiltinCommand(cmd) {
+			return nil // No-op for builtins
+		}
+
+		name := MustGetStringExpanded(cmd, "env-file")
+		paths := []string{name}
+		if MustGetBool(cmd, "env-search-parents") && !filepath.IsAbs(name) {
+			wd, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to search for dotenv files: %w", err)
+			}
+			paths = findDotEnvFiles(wd, name, MustGetString(cmd, "env-search-boundary"))
+		}
+
+		var loaded []string
+		for _, path := range paths {
+			if err := godotenv.Load(path); err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return fmt.Errorf("failed to load dotenv file %s: %w", path, err)
+			}
+			loaded = append(loaded, path)
+		}
+
+		l.V(2).Info("loaded dotenv files", "paths", loaded)
+		return nil
+	}
+}
+
+// findDotEnvFiles returns the paths of files with the provided name in dir
+// and its parents, ordered from nearest to furthest.
+//
+// The search stops after the first directory containing boundary.
+func findDotEnvFiles(dir, name, boundary string) []string {
+	var paths []string
+	for {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			paths = append(paths, path)
+		}
+
+		if boundary != "" {
+			if _, err := os.Stat(filepath.Join(dir, boundary)); err == nil {
+				return paths
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return paths
+		}
+		dir = parent
+	}
+}
@@ -1,19 +1,157 @@
 package cobrautil_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/jzelinskie/cobrautil/v2"
+	"github.com/jzelinskie/cobrautil/v2/cobraviper"
 )
 
 func ExampleCommandStack() {
 	_ = &cobra.Command{
 		Use: "mycmd",
 		RunE: cobrautil.CommandStack(
-			cobrautil.SyncViperPreRunE("myprogram"),
+			cobraviper.SyncPreRunE("myprogram"),
 			func(cmd *cobra.Command, args []string) error {
 				return nil
 			},
 		),
 	}
 }
+
+func ExampleWriteScaffold() {
+	_ = cobrautil.WriteScaffold(os.Stdout, "myservice", "log", "otel", "grpc")
+}
+
+func ExampleVisitClusterWideFlags() {
+	flags := pflag.NewFlagSet("example", pflag.ContinueOnError)
+	flags.String("datastore-uri", "", "connection string of the datastore")
+	flags.String("addr", ":8080", "address to listen on")
+	_ = cobrautil.MarkFlagsInstanceLocal(flags, "addr")
+
+	cobrautil.VisitClusterWideFlags(flags, func(f *pflag.Flag) {
+		fmt.Println(f.Name)
+	})
+	// Output: datastore-uri
+}
+
+func ExampleWriteKubernetesEnv() {
+	flags := pflag.NewFlagSet("serve", pflag.ContinueOnError)
+	flags.String("grpc-addr", ":50051", "address to listen on")
+	flags.StringSlice("otel-trace-propagator", []string{"w3c"}, "trace propagators")
+	_ = flags.Parse([]string{"--grpc-addr=:9000", "--otel-trace-propagator=b3,w3c"})
+
+	_ = cobrautil.WriteKubernetesEnv(os.Stdout, "env", "myservice", "", flags, false)
+	// Output:
+	// env:
+	// - name: MYSERVICE_GRPC_ADDR
+	//   value: ":9000"
+	// - name: MYSERVICE_OTEL_TRACE_PROPAGATOR
+	//   value: "b3,w3c"
+}
+
+func ExampleExpandEnv() {
+	os.Setenv("DATASTORE_HOST", "db.internal")
+	fmt.Println(cobrautil.ExpandEnv("postgres://${DATASTORE_HOST}:${DATASTORE_PORT:-5432}/app"))
+	// Output: postgres://db.internal:5432/app
+}
+
+func ExampleCommandStackAll() {
+	cmd := &cobra.Command{
+		Use: "mycmd",
+		PreRunE: cobrautil.CommandStackAll(
+			func(cmd *cobra.Command, args []string) error {
+				return errors.New("invalid --grpc-addr")
+			},
+			func(cmd *cobra.Command, args []string) error {
+				return errors.New("invalid --otel-provider")
+			},
+		),
+	}
+
+	err := cmd.PreRunE(cmd, nil)
+	fmt.Println(strings.Count(err.Error(), "\n") + 1)
+	// Output: 2
+}
+
+func ExampleFlusher() {
+	flusher := cobrautil.NewFlusher()
+	flusher.Register("example", func(ctx context.Context) error {
+		time.Sleep(time.Second) // Does not finish in time.
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	fmt.Println(flusher.Flush(ctx))
+	// Output: failed to flush example: timed out: context deadline exceeded
+}
+
+func ExampleFlusher_Execute() {
+	flusher := cobrautil.NewFlusher()
+	cmd := &cobra.Command{
+		Use: "mycmd",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			flusher.Register("example", func(ctx context.Context) error {
+				fmt.Println("flushed")
+				return nil
+			})
+			return errors.New("failed")
+		},
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+	cobrautil.RegisterFlushFlags(cmd.PersistentFlags())
+	cmd.SetArgs(nil)
+
+	fmt.Println(flusher.Execute(context.Background(), cmd))
+	// Output:
+	// flushed
+	// failed
+}
+
+func ExampleRegisterDeprecatedAlias() {
+	flags := pflag.NewFlagSet("example", pflag.ContinueOnError)
+	flags.String("endpoint", "", "endpoint to connect to")
+	_ = cobrautil.RegisterDeprecatedAlias(flags, "legacy-endpoint", "endpoint")
+
+	flags.SetOutput(io.Discard) // Hide the deprecation warning.
+	_ = flags.Parse([]string{"--legacy-endpoint", "localhost:4317"})
+
+	endpoint, _ := flags.GetString("endpoint")
+	fmt.Println(endpoint, flags.Changed("endpoint"))
+	// Output: localhost:4317 true
+}
+
+func ExampleRegisterSecretFlag() {
+	cmd := &cobra.Command{Use: "mycmd"}
+	cobrautil.RegisterSecretFlag(cmd.Flags(), "api-key", "key used to authenticate")
+	_ = cmd.Flags().Parse([]string{"--api-key", "hunter2"})
+
+	fmt.Println(cmd.Flags().Lookup("api-key").Value)
+	fmt.Println(cobrautil.MustGetSecret(cmd, "api-key"))
+	// Output:
+	// REDACTED
+	// hunter2
+}
+
+func ExampleRegisterByteSizeFlag() {
+	cmd := &cobra.Command{Use: "mycmd"}
+	cobrautil.RegisterByteSizeFlag(cmd.Flags(), "max-size", 1<<20, "maximum size of a request")
+	fmt.Println(cmd.Flags().Lookup("max-size").DefValue)
+
+	_ = cmd.Flags().Parse([]string{"--max-size", "10MB"})
+	fmt.Println(cobrautil.MustGetByteSize(cmd, "max-size"))
+	// Output:
+	// 1MiB
+	// 10000000
+}
@@ -0,0 +1,96 @@
+package cobrautil
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// ExpandEnv replaces ${var} or $var in the string according to the values of
+// the current environment variables, like os.ExpandEnv.
+//
+// Additionally, the following shell parameter expansions are supported:
+// - "${var:-default}" expands to default if var is unset or empty
+// - "${var-default}" expands to default if var is unset
+func ExpandEnv(s string) string {
+	return os.Expand(s, func(name string) string {
+		if name, def, ok := strings.Cut(name, ":-"); ok {
+			if value := os.Getenv(name); value != "" {
+				return value
+			}
+			return def
+		}
+		if name, def, ok := strings.Cut(name, "-"); ok {
+			if value, ok := os.LookupEnv(name); ok {
+				return value
+			}
+			return def
+		}
+		return os.Getenv(name)
+	})
+}
+
+// RegisterExpandEnvFlags registers the flags used by ExpandEnvPreRunE.
+//
+// The following flags are added:
+// - "expand-env"
+func RegisterExpandEnvFlags(flags *pflag.FlagSet) {
+	flags.Bool("expand-env", false, "expand environment variables (e.g. $VAR or ${VAR:-default}) in the values of all string flags")
+}
+
+// ExpandEnvPreRunE returns a CobraRunFunc that calls ExpandAll if the
+// "expand-env" flag from RegisterExpandEnvFlags() is set.
+//
+// This should be run after cobraviper.SyncPreRunE so that values set from the
+// environment are also expanded.
+func ExpandEnvPreRunE() CobraRunFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if IsBuiltinCommand(cmd) {
+			return nil // No-op for builtins
+		}
+
+		if !MustGetBool(cmd, "expand-env") {
+			return nil
+		}
+		return ExpandAll(cmd)
+	}
+}
+
+// ExpandAll applies ExpandEnv to the value of every string, string slice, and
+// string array flag of the command.
+//
+// Whether a flag was changed is unaffected. Because values are expanded in
+// place, ExpandAll should only be called once per command invocation.
+func ExpandAll(cmd *cobra.Command) error {
+	var err error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if err != nil {
+			return
+		}
+
+		switch f.Value.Type() {
+		case "string":
+			if expanded := ExpandEnv(f.Value.String()); expanded != f.Value.String() {
+				err = f.Value.Set(expanded)
+			}
+		case "stringSlice", "stringArray":
+			sv, ok := f.Value.(pflag.SliceValue)
+			if !ok {
+				return
+			}
+			values := sv.GetSlice()
+			for i, value := range values {
+				values[i] = ExpandEnv(value)
+			}
+			err = sv.Replace(values)
+		}
+
+		if err != nil {
+			err = fmt.Errorf("failed to expand flag %s: %w", f.Name, err)
+		}
+	})
+	return err
+}
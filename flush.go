@@ -0,0 +1,184 @@
+package cobrautil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// FlushFunc flushes buffered data, such as telemetry, before the process
+// exits, returning once finished or when the provided context is canceled.
+type FlushFunc func(ctx context.Context) error
+
+// Flusher is a registry of FlushFuncs that are run together at the end of a
+// process, so that data buffered by background writers and exporters in the
+// final seconds of a process is not silently lost.
+//
+// Servers can also register functions that drain their in-flight requests,
+// which run before anything is flushed so that the telemetry of those
+// requests is also flushed.
+//
+// The zero value is ready to use.
+type Flusher struct {
+	mu      sync.Mutex
+	drains  namedFuncs
+	flushes namedFuncs
+}
+
+type namedFuncs struct {
+	names []string
+	fns   []FlushFunc
+}
+
+func (n *namedFuncs) add(name string, fn FlushFunc) {
+	n.names = append(n.names, name)
+	n.fns = append(n.fns, fn)
+}
+
+// NewFlusher creates an empty Flusher.
+func NewFlusher() *Flusher {
+	return &Flusher{}
+}
+
+// Register adds a FlushFunc that is run by Flush, identified by name in any
+// errors it returns.
+func (f *Flusher) Register(name string, fn FlushFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flushes.add(name, fn)
+}
+
+// RegisterDrain adds a function that stops a server and waits for its
+// in-flight requests, which is run by Flush before any FlushFuncs.
+func (f *Flusher) RegisterDrain(name string, fn FlushFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.drains.add(name, fn)
+}
+
+// Flush runs every registered drain concurrently, followed by every
+// registered FlushFunc concurrently, and waits for all of them to return or
+// for the provided context to be canceled.
+//
+// The returned error lists every function that failed or had yet to return
+// when the context was canceled. Registrations are removed once run, so that
+// calling Flush again only runs those registered since.
+func (f *Flusher) Flush(ctx context.Context) error {
+	f.mu.Lock()
+	drains, flushes := f.drains, f.flushes
+	f.drains, f.flushes = namedFuncs{}, namedFuncs{}
+	f.mu.Unlock()
+
+	return errors.Join(
+		runConcurrently(ctx, "drain", drains),
+		runConcurrently(ctx, "flush", flushes),
+	)
+}
+
+func runConcurrently(ctx context.Context, verb string, funcs namedFuncs) error {
+	results := make([]chan error, len(funcs.fns))
+	for i, fn := range funcs.fns {
+		results[i] = make(chan error, 1)
+		go func(fn FlushFunc, result chan<- error) { result <- fn(ctx) }(fn, results[i])
+	}
+
+	var errs []error
+	for i, result := range results {
+		var err error
+		select {
+		case err = <-result:
+		case <-ctx.Done():
+			// Prefer the result of any function that finished in time.
+			select {
+			case err = <-result:
+			default:
+				err = fmt.Errorf("timed out: %w", ctx.Err())
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to %s %s: %w", verb, funcs.names[i], err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+const defaultFlushTimeout = 5 * time.Second
+
+// RegisterFlushFlags registers the flags used by Flusher.Execute and
+// Flusher.PostRunE.
+//
+// The following flags are added:
+// - "flush-timeout"
+func RegisterFlushFlags(flags *pflag.FlagSet) {
+	flags.Duration("flush-timeout", defaultFlushTimeout, "maximum time spent draining servers and flushing buffered telemetry before exiting")
+}
+
+// Main executes the root command until the process receives SIGINT or
+// SIGTERM, flushes with the provided Flusher, and exits the process with a
+// non-zero status if either failed.
+//
+// This is the recommended entry point of programs that use a Flusher:
+//
+//	func main() {
+//		flusher := cobrautil.NewFlusher()
+//		cobrautil.Main(rootCmd(flusher), flusher)
+//	}
+func Main(cmd *cobra.Command, f *Flusher) {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := f.Execute(ctx, cmd)
+	cancel()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// Execute executes the root command with the provided context and then runs
+// Flush with the timeout from the flag registered by RegisterFlushFlags(),
+// or 5 seconds if the executed command does not have it.
+//
+// Unlike PostRunE, which Cobra skips when a command returns an error, the
+// telemetry of failed commands is also flushed. Errors of the command and of
+// Flush are both returned.
+func (f *Flusher) Execute(ctx context.Context, cmd *cobra.Command) error {
+	executed, err := cmd.ExecuteContextC(ctx)
+	if executed == nil {
+		executed = cmd
+	}
+
+	timeout, flagErr := executed.Flags().GetDuration("flush-timeout")
+	if flagErr != nil {
+		timeout = defaultFlushTimeout
+	}
+
+	// The command's context may already be canceled, but buffered data should
+	// still be flushed.
+	flushCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return errors.Join(err, f.Flush(flushCtx))
+}
+
+// PostRunE returns a CobraRunFunc that runs Flush with the timeout from the
+// flag registered by RegisterFlushFlags().
+//
+// This is intended to be used as the PersistentPostRunE of the root command.
+// Cobra does not run it when a command returns an error, so prefer Main or
+// Execute, which flush regardless.
+func (f *Flusher) PostRunE() CobraRunFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if IsBuiltinCommand(cmd) {
+			return nil // No-op for builtins
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), MustGetDuration(cmd, "flush-timeout"))
+		defer cancel()
+		return f.Flush(ctx)
+	}
+}
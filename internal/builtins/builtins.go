@@ -0,0 +1,21 @@
+// Package builtins identifies the commands that cobra provides out-of-the-box.
+//
+// It is shared by packages that cannot import the root package without
+// creating an import cycle.
+package builtins
+
+import (
+	"github.com/jzelinskie/stringz"
+	"github.com/spf13/cobra"
+)
+
+// IsBuiltinCommand checks against a hard-coded list of the names of commands
+// that cobra provides out-of-the-box.
+func IsBuiltinCommand(cmd *cobra.Command) bool {
+	return stringz.SliceContains([]string{
+		"help [command]",
+		"completion [command]",
+	},
+		cmd.Use,
+	)
+}
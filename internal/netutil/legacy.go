@@ -0,0 +1,66 @@
+package netutil
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// LegacyListener wraps a net.Listener on an address that is being migrated
+// away from so that connections accepted by it are logged, identifying the
+// clients that have yet to move to the new address.
+//
+// To avoid flooding the logs, a message is logged at most once per interval
+// along with the number of connections accepted since the previous message.
+func LegacyListener(l net.Listener, interval time.Duration, logger logr.Logger) net.Listener {
+	return &legacyListener{Listener: l, interval: interval, logger: logger}
+}
+
+type legacyListener struct {
+	net.Listener
+	interval time.Duration
+	logger   logr.Logger
+
+	mu       sync.Mutex
+	lastLog  time.Time
+	accepted int
+}
+
+func (l *legacyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return conn, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.accepted++
+	if now := time.Now(); now.Sub(l.lastLog) >= l.interval {
+		l.logger.Info(
+			"accepted connection on legacy address; clients should migrate to the new address",
+			"addr", l.Addr().String(),
+			"remote", conn.RemoteAddr().String(),
+			"connections", l.accepted,
+		)
+		l.lastLog = now
+		l.accepted = 0
+	}
+	return conn, nil
+}
+
+// ServeAll calls serve with each of the provided listeners concurrently and
+// returns the result of the first call to return.
+//
+// Servers that support multiple listeners (e.g. *grpc.Server and
+// *http.Server) stop serving all of them when they are stopped, so the
+// remaining calls return shortly after.
+func ServeAll(serve func(net.Listener) error, listeners ...net.Listener) error {
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		l := l
+		go func() { errs <- serve(l) }()
+	}
+	return <-errs
+}
@@ -0,0 +1,98 @@
+// Package netutil implements networking utilities shared by the builders.
+package netutil
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RetryListener wraps a net.Listener so that Accept retries with exponential
+// backoff after errors caused by transient resource exhaustion (e.g. running
+// out of file descriptors) rather than returning them, which would stop the
+// server using the listener.
+//
+// Every retried error is logged and, if retries is not nil, counted.
+func RetryListener(l net.Listener, maxBackoff time.Duration, logger logr.Logger, retries prometheus.Counter) net.Listener {
+	return &retryListener{Listener: l, maxBackoff: maxBackoff, logger: logger, retries: retries}
+}
+
+// NewAcceptRetries registers the counter of the errors retried by the
+// RetryListeners of the server named serviceName, e.g.
+// "grpc_server_accept_retries_total" for the "grpc" subsystem.
+//
+// A counter already registered for the same server, such as by an earlier
+// call for its legacy address, is shared.
+func NewAcceptRetries(registerer prometheus.Registerer, subsystem, serviceName string) (prometheus.Counter, error) {
+	return registerCounter(registerer, prometheus.NewCounter(prometheus.CounterOpts{
+		Subsystem:   subsystem,
+		Name:        "server_accept_retries_total",
+		Help:        "Total number of transient errors accepting connections that were retried, such as running out of file descriptors.",
+		ConstLabels: prometheus.Labels{"server": serviceName},
+	}))
+}
+
+// registerCounter registers the counter, returning the existing counter if
+// an identical one is already registered.
+func registerCounter(registerer prometheus.Registerer, counter prometheus.Counter) (prometheus.Counter, error) {
+	if err := registerer.Register(counter); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if errors.As(err, &registered) {
+			if existing, ok := registered.ExistingCollector.(prometheus.Counter); ok {
+				return existing, nil
+			}
+		}
+		return nil, err
+	}
+	return counter, nil
+}
+
+type retryListener struct {
+	net.Listener
+	maxBackoff time.Duration
+	logger     logr.Logger
+	retries    prometheus.Counter
+}
+
+func (l *retryListener) Accept() (net.Conn, error) {
+	var backoff time.Duration
+	for {
+		conn, err := l.Listener.Accept()
+		if err == nil || !isTransient(err) {
+			return conn, err
+		}
+
+		if backoff == 0 {
+			backoff = 5 * time.Millisecond
+		} else if backoff *= 2; backoff > l.maxBackoff {
+			backoff = l.maxBackoff
+		}
+
+		l.logger.Error(err, "failed to accept connection; retrying", "addr", l.Addr().String(), "backoff", backoff)
+		if l.retries != nil {
+			l.retries.Inc()
+		}
+		time.Sleep(backoff)
+	}
+}
+
+// isTransient returns true for errors that are expected to resolve without
+// intervention.
+func isTransient(err error) bool {
+	if errors.Is(err, net.ErrClosed) {
+		return false
+	}
+
+	for _, errno := range []syscall.Errno{syscall.EMFILE, syscall.ENFILE, syscall.ENOBUFS, syscall.ENOMEM, syscall.ECONNABORTED} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+
+	var netErr interface{ Temporary() bool }
+	return errors.As(err, &netErr) && netErr.Temporary()
+}
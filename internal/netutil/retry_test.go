@@ -0,0 +1,65 @@
+package netutil
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// failingListener fails to accept connections with the provided errors
+// before accepting a connection.
+type failingListener struct {
+	net.Listener
+	errs []error
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	if len(l.errs) > 0 {
+		err := l.errs[0]
+		l.errs = l.errs[1:]
+		return nil, err
+	}
+	server, client := net.Pipe()
+	client.Close()
+	return server, nil
+}
+
+func (l *failingListener) Addr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+}
+
+func TestRetryListener(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	retries, err := NewAcceptRetries(registry, "grpc", "myservice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shared, err := NewAcceptRetries(registry, "grpc", "myservice"); err != nil || shared != retries {
+		t.Fatalf("expected the registered counter to be shared, got %v", err)
+	}
+
+	l := RetryListener(&failingListener{
+		errs: []error{&net.OpError{Op: "accept", Err: syscall.EMFILE}, syscall.ENFILE},
+	}, 0, logr.Discard(), retries)
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	if count := testutil.ToFloat64(retries); count != 2 {
+		t.Fatalf("expected 2 retries to be counted, got %v", count)
+	}
+
+	l = RetryListener(&failingListener{errs: []error{net.ErrClosed}}, 0, logr.Discard(), retries)
+	if _, err := l.Accept(); err != net.ErrClosed {
+		t.Fatalf("expected the listener to be closed, got %v", err)
+	}
+	if count := testutil.ToFloat64(retries); count != 2 {
+		t.Fatalf("expected errors that are not transient not to be counted, got %v", count)
+	}
+}
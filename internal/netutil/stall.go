@@ -0,0 +1,233 @@
+package netutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrStalled is returned by the Accept method of listeners created by
+// StallListener once they have been stopped because they stalled.
+var ErrStalled = errors.New("listener stopped accepting connections")
+
+// stallThreshold is the number of consecutive failed checks after which a
+// listener created by StallListener is stopped.
+const stallThreshold = 3
+
+// StallListener wraps a TCP listener so that it is checked every interval by
+// dialing its own address and verifying that the connection is returned by
+// Accept, catching wedged accept loops that health checks served on another
+// port would miss. The connections of the checks are closed by Accept rather
+// than returned to the server.
+//
+// Every failed check is logged and, if stalls is not nil, counted. If stop is
+// true, the listener is closed after three consecutive failed checks and
+// Accept returns ErrStalled, so that the server stops serving and its process
+// can be restarted by its supervisor.
+//
+// Listeners that are not TCP, such as unix sockets, are returned unchanged.
+func StallListener(l net.Listener, interval time.Duration, stop bool, logger logr.Logger, stalls prometheus.Counter) net.Listener {
+	addr, ok := l.Addr().(*net.TCPAddr)
+	if !ok || interval <= 0 {
+		return l
+	}
+
+	host := addr.IP.String()
+	if addr.IP == nil || addr.IP.IsUnspecified() {
+		// Dials both loopback addresses, as listeners on "[::]" may only
+		// accept IPv6 connections.
+		host = "localhost"
+	}
+
+	sl := &stallListener{
+		Listener: l,
+		target:   net.JoinHostPort(host, strconv.Itoa(addr.Port)),
+		interval: interval,
+		timeout:  min(interval, 5*time.Second),
+		stop:     stop,
+		logger:   logger,
+		stalls:   stalls,
+		done:     make(chan struct{}),
+	}
+	go sl.check()
+	return sl
+}
+
+// NewStalls registers the counter of the failed checks of the StallListeners
+// of the server named serviceName, e.g. "grpc_server_stalls_total" for the
+// "grpc" subsystem.
+//
+// A counter already registered for the same server, such as by an earlier
+// call for its legacy address, is shared.
+func NewStalls(registerer prometheus.Registerer, subsystem, serviceName string) (prometheus.Counter, error) {
+	return registerCounter(registerer, prometheus.NewCounter(prometheus.CounterOpts{
+		Subsystem:   subsystem,
+		Name:        "server_stalls_total",
+		Help:        "Total number of checks that found that a listener was not accepting connections.",
+		ConstLabels: prometheus.Labels{"server": serviceName},
+	}))
+}
+
+type stallListener struct {
+	net.Listener
+	target   string
+	interval time.Duration
+	timeout  time.Duration
+	stop     bool
+	logger   logr.Logger
+	stalls   prometheus.Counter
+
+	mu      sync.Mutex
+	probe   *probe
+	stalled bool
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// probe is a connection dialed by a check.
+type probe struct {
+	// dialed is closed once the dial has returned, after which addr is the
+	// local address of the connection, or nil if the dial failed.
+	dialed   chan struct{}
+	addr     *net.TCPAddr
+	accepted chan struct{}
+	once     sync.Once
+}
+
+func (l *stallListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.mu.Lock()
+			stalled := l.stalled
+			l.mu.Unlock()
+			if stalled {
+				return nil, ErrStalled
+			}
+			return conn, err
+		}
+
+		if !l.isProbe(conn) {
+			return conn, nil
+		}
+		conn.Close()
+	}
+}
+
+// isProbe returns true if the connection was dialed by the check in flight,
+// marking it as accepted.
+func (l *stallListener) isProbe(conn net.Conn) bool {
+	l.mu.Lock()
+	p := l.probe
+	l.mu.Unlock()
+	if p == nil {
+		return false
+	}
+
+	remote, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok || !remote.IP.IsLoopback() && !remote.IP.Equal(addrIP(l.Addr())) {
+		return false
+	}
+
+	// The connection may be accepted before the dial returns with its
+	// address, which is bounded by the timeout of the dial.
+	<-p.dialed
+	if p.addr == nil || p.addr.Port != remote.Port || !p.addr.IP.Equal(remote.IP) {
+		return false
+	}
+	p.once.Do(func() { close(p.accepted) })
+	return true
+}
+
+func addrIP(addr net.Addr) net.IP {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp.IP
+	}
+	return nil
+}
+
+func (l *stallListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// check runs a check every interval until the listener is closed.
+func (l *stallListener) check() {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	var failures int
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+		}
+
+		err := l.probeOnce()
+		if err == nil {
+			failures = 0
+			continue
+		}
+
+		failures++
+		if l.stalls != nil {
+			l.stalls.Inc()
+		}
+		l.logger.Error(err, "listener is not accepting connections", "addr", l.Addr().String(), "failures", failures)
+
+		if l.stop && failures >= stallThreshold {
+			l.logger.Error(ErrStalled, "stopping stalled listener", "addr", l.Addr().String())
+			l.mu.Lock()
+			l.stalled = true
+			l.mu.Unlock()
+			l.Close()
+			return
+		}
+	}
+}
+
+// probeOnce dials the listener and waits for Accept to return the
+// connection.
+func (l *stallListener) probeOnce() error {
+	p := &probe{dialed: make(chan struct{}), accepted: make(chan struct{})}
+	l.mu.Lock()
+	l.probe = p
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.probe = nil
+		l.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", l.target)
+	if err == nil {
+		defer conn.Close()
+		p.addr, _ = conn.LocalAddr().(*net.TCPAddr)
+	}
+	close(p.dialed)
+	if err != nil {
+		return fmt.Errorf("failed to dial %s: %w", l.target, err)
+	}
+
+	select {
+	case <-p.accepted:
+		return nil
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("connection to %s was not accepted within %s", l.target, l.timeout)
+	}
+}
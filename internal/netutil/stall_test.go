@@ -0,0 +1,125 @@
+package netutil
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func stallCounter(t *testing.T) prometheus.Counter {
+	t.Helper()
+
+	stalls, err := NewStalls(prometheus.NewRegistry(), "grpc", "myservice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stalls
+}
+
+func TestStallListenerAccepting(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stalls := stallCounter(t)
+	l := StallListener(inner, 100*time.Millisecond, true, logr.Discard(), stalls)
+	defer l.Close()
+
+	accepted := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	// Several checks pass without their connections being returned.
+	select {
+	case conn := <-accepted:
+		t.Fatalf("expected the connections of checks not to be accepted, got %v", conn.RemoteAddr())
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	client, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	select {
+	case conn := <-accepted:
+		if conn.RemoteAddr().String() != client.LocalAddr().String() {
+			t.Errorf("expected the connection of the client, got %v", conn.RemoteAddr())
+		}
+		conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the connection of the client to be accepted")
+	}
+
+	if count := testutil.ToFloat64(stalls); count != 0 {
+		t.Fatalf("expected no failed checks, got %v", count)
+	}
+}
+
+func TestStallListenerStalled(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stalls := stallCounter(t)
+
+	// Nothing calls Accept until the listener is stopped, like a wedged
+	// server.
+	l := StallListener(inner, 10*time.Millisecond, true, logr.Discard(), stalls)
+	defer l.Close()
+	for deadline := time.Now().Add(5 * time.Second); testutil.ToFloat64(stalls) < stallThreshold; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the checks to fail")
+		}
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				result <- err
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, ErrStalled) {
+			t.Fatalf("expected %v, got %v", ErrStalled, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the stalled listener to be stopped")
+	}
+
+	if count := testutil.ToFloat64(stalls); count != stallThreshold {
+		t.Fatalf("expected %d failed checks, got %v", stallThreshold, count)
+	}
+}
+
+func TestStallListenerUnix(t *testing.T) {
+	inner, err := net.Listen("unix", t.TempDir()+"/test.sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inner.Close()
+
+	if l := StallListener(inner, time.Millisecond, true, logr.Discard(), nil); l != inner {
+		t.Fatalf("expected unix listeners not to be checked")
+	}
+}
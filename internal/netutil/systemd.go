@@ -0,0 +1,106 @@
+package netutil
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SystemdNetwork is the network that inherits a listener passed by systemd
+// socket activation rather than creating one.
+const SystemdNetwork = "systemd"
+
+// fdAddrPrefix prefixes addresses of listeners passed by systemd.
+const fdAddrPrefix = "fd://"
+
+// listenFDsStart is the first file descriptor passed by systemd, following
+// stdin, stdout, and stderr.
+const listenFDsStart = 3
+
+// IsSystemdListener returns true if the network or address refer to a
+// listener passed by systemd socket activation.
+func IsSystemdListener(network, addr string) bool {
+	return network == SystemdNetwork || strings.HasPrefix(addr, fdAddrPrefix)
+}
+
+type listenFD struct {
+	file *os.File
+	name string
+}
+
+// listenFDs returns the file descriptors passed by systemd, which are kept
+// open for the lifetime of the process so that they can be used for any
+// number of listeners.
+var listenFDs = sync.OnceValues(func() ([]listenFD, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, errors.New("no sockets were passed by systemd: LISTEN_PID is not set to this process")
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, errors.New("no sockets were passed by systemd: LISTEN_FDS is not set")
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	fds := make([]listenFD, count)
+	for i := range fds {
+		fd := listenFDsStart + i
+		fds[i].name = "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			fds[i].name = names[i]
+		}
+		fds[i].file = os.NewFile(uintptr(fd), fds[i].name)
+	}
+	return fds, nil
+})
+
+// SystemdListener returns a listener passed by systemd socket activation,
+// selected by the address:
+// - "fd://" or any address that is not one of the following uses the only
+// socket passed, failing if there are several
+// - "fd://3" uses the socket with that file descriptor
+// - "fd://name" or "name" uses the socket with that FileDescriptorName
+func SystemdListener(addr string) (net.Listener, error) {
+	fds, err := listenFDs()
+	if err != nil {
+		return nil, err
+	}
+
+	selector := strings.TrimPrefix(addr, fdAddrPrefix)
+	fd, err := selectListenFD(fds, selector, strings.HasPrefix(addr, fdAddrPrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := net.FileListener(fd.file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on socket %s passed by systemd: %w", fd.name, err)
+	}
+	return l, nil
+}
+
+func selectListenFD(fds []listenFD, selector string, explicit bool) (listenFD, error) {
+	for _, fd := range fds {
+		if selector != "" && fd.name == selector {
+			return fd, nil
+		}
+	}
+
+	if n, err := strconv.Atoi(selector); err == nil && explicit {
+		if i := n - listenFDsStart; i >= 0 && i < len(fds) {
+			return fds[i], nil
+		}
+		return listenFD{}, fmt.Errorf("file descriptor %d was not passed by systemd", n)
+	}
+
+	if explicit && selector != "" {
+		return listenFD{}, fmt.Errorf("no socket named %q was passed by systemd", selector)
+	}
+	if len(fds) > 1 {
+		return listenFD{}, fmt.Errorf("%d sockets were passed by systemd; select one with an address of the form fd://name", len(fds))
+	}
+	return fds[0], nil
+}
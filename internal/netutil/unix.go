@@ -0,0 +1,116 @@
+package netutil
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IsUnixNetwork returns true for the networks that listen on a socket file.
+func IsUnixNetwork(network string) bool {
+	return network == "unix" || network == "unixpacket"
+}
+
+// RemoveStaleSocket removes the socket file at path if nothing is listening
+// on it, such as one left behind by a process that did not exit cleanly.
+//
+// An error is returned if the path exists but is not a socket or if another
+// process is still listening on it.
+func RemoveStaleSocket(network, path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to stat socket %s: %w", path, err)
+	}
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("failed to remove stale socket %s: not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout(network, path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("failed to remove stale socket %s: another process is listening on it", path)
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+	}
+	return nil
+}
+
+// ParseSocketMode parses the permissions of a socket file written in octal
+// (e.g. "0660"). An empty string returns zero, leaving the permissions as
+// determined by the umask.
+func ParseSocketMode(mode string) (fs.FileMode, error) {
+	if mode == "" {
+		return 0, nil
+	}
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || m > 0o777 {
+		return 0, fmt.Errorf("invalid socket mode %q: must be octal permissions such as 0660", mode)
+	}
+	return fs.FileMode(m), nil
+}
+
+// ChmodChownSocket sets the permissions and owner of the socket file at path.
+//
+// A zero mode leaves the permissions unchanged. The owner is of the form
+// "user[:group]" where each may be a name or a numeric ID; an empty string
+// leaves the owner unchanged.
+func ChmodChownSocket(path string, mode fs.FileMode, owner string) error {
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			return fmt.Errorf("failed to set permissions of socket %s: %w", path, err)
+		}
+	}
+
+	if owner == "" {
+		return nil
+	}
+	uid, gid, err := lookupOwner(owner)
+	if err != nil {
+		return err
+	}
+	if err := os.Chown(path, uid, gid); err != nil {
+		return fmt.Errorf("failed to set owner of socket %s: %w", path, err)
+	}
+	return nil
+}
+
+// lookupOwner resolves "user[:group]" to numeric IDs, returning -1 for the
+// group if it is omitted so that it is left unchanged.
+func lookupOwner(owner string) (uid, gid int, err error) {
+	userName, groupName, _ := strings.Cut(owner, ":")
+
+	uid, err = strconv.Atoi(userName)
+	if err != nil {
+		u, err := user.Lookup(userName)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid socket owner %q: %w", owner, err)
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return 0, 0, fmt.Errorf("invalid socket owner %q: non-numeric uid %s", owner, u.Uid)
+		}
+	}
+
+	if groupName == "" {
+		return uid, -1, nil
+	}
+	gid, err = strconv.Atoi(groupName)
+	if err != nil {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid socket owner %q: %w", owner, err)
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return 0, 0, fmt.Errorf("invalid socket owner %q: non-numeric gid %s", owner, g.Gid)
+		}
+	}
+	return uid, gid, nil
+}
@@ -0,0 +1,24 @@
+// Package otelctx passes the OpenTelemetry providers configured by cobraotel
+// to the other builders through the context of a command, without the
+// builders depending on one another.
+package otelctx
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracerProviderKey struct{}
+
+// WithTracerProvider returns a copy of the context carrying the provided
+// TracerProvider.
+func WithTracerProvider(ctx context.Context, tp trace.TracerProvider) context.Context {
+	return context.WithValue(ctx, tracerProviderKey{}, tp)
+}
+
+// TracerProvider returns the TracerProvider carried by the context, if any.
+func TracerProvider(ctx context.Context) (trace.TracerProvider, bool) {
+	tp, ok := ctx.Value(tracerProviderKey{}).(trace.TracerProvider)
+	return tp, ok
+}
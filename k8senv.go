@@ -0,0 +1,148 @@
+package cobrautil
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// NewPrintKubernetesEnvCommand creates a command that accepts the flags of
+// the target command and prints their values as environment variables in a
+// Kubernetes manifest snippet.
+//
+// The names of the environment variables use the same mapping as
+// cobraviper.SyncPreRunE with the provided prefix, so the output can be used to
+// configure the target command when it is deployed.
+//
+// The flags include those inherited by the target from the persistent flags of
+// its parents, so the target must already have been added to them.
+//
+// The following flags are added in addition to those of the target:
+// - "k8s-format"
+// - "k8s-all"
+// - "k8s-configmap-name"
+func NewPrintKubernetesEnvCommand(prefix string, target *cobra.Command) *cobra.Command {
+	flags := pflag.NewFlagSet(target.Name(), pflag.ContinueOnError)
+	flags.AddFlagSet(target.Flags())
+	flags.AddFlagSet(target.InheritedFlags())
+
+	cmd := &cobra.Command{
+		Use:   "print-k8s-env",
+		Short: "print the values of the flags of " + target.Name() + " as a Kubernetes manifest snippet",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return WriteKubernetesEnv(
+				cmd.OutOrStdout(),
+				MustGetString(cmd, "k8s-format"),
+				prefix,
+				MustGetString(cmd, "k8s-configmap-name"),
+				flags,
+				MustGetBool(cmd, "k8s-all"),
+			)
+		},
+	}
+
+	cmd.Flags().AddFlagSet(flags)
+	cmd.Flags().String("k8s-format", "env", `format of the printed manifest snippet ("env", "configmap")`)
+	cmd.Flags().Bool("k8s-all", false, "include flags that were not explicitly set")
+	cmd.Flags().String("k8s-configmap-name", target.Root().Name(), "name of the printed ConfigMap")
+
+	if err := cmd.RegisterFlagCompletionFunc("k8s-format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"env", "configmap"}, cobra.ShellCompDirectiveDefault
+	}); err != nil {
+		panic("failed to register flag completion: " + err.Error())
+	}
+
+	return cmd
+}
+
+// WriteKubernetesEnv writes the values of the provided flags as either the
+// "env" block of a container or a ConfigMap manifest.
+//
+// Unless all is true, only flags that were explicitly set are written.
+//
+// An error is returned for flags whose values cannot be parsed from a single
+// environment variable, such as string arrays with several values.
+func WriteKubernetesEnv(w io.Writer, format, prefix, configMapName string, flags *pflag.FlagSet, all bool) error {
+	prefix = strings.ReplaceAll(strings.ToUpper(prefix), "-", "_")
+
+	type envVar struct{ name, value string }
+	var vars []envVar
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		// Aliases share the value of the flag they refer to and the values
+		// of secrets are redacted.
+		if err != nil || f.Name == "help" || AliasOf(f) != "" || IsSecretFlag(f) || !all && !f.Changed {
+			return
+		}
+
+		var value string
+		if value, err = flagValueString(f); err != nil {
+			return
+		}
+		vars = append(vars, envVar{
+			name:  prefix + "_" + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_")),
+			value: value,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	switch format {
+	case "env":
+		sb.WriteString("env:\n")
+		for _, v := range vars {
+			fmt.Fprintf(&sb, "- name: %s\n  value: %s\n", v.name, strconv.Quote(v.value))
+		}
+	case "configmap":
+		fmt.Fprintf(&sb, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\ndata:\n", strconv.Quote(configMapName))
+		for _, v := range vars {
+			fmt.Fprintf(&sb, "  %s: %s\n", v.name, strconv.Quote(v.value))
+		}
+	default:
+		return fmt.Errorf("unknown Kubernetes manifest format: %s", format)
+	}
+
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+// flagValueString returns the value of a flag in the form that it is parsed
+// from an environment variable.
+func flagValueString(f *pflag.Flag) (string, error) {
+	switch f.Value.Type() {
+	case "stringArray":
+		// Each value is parsed as a single element, so several values cannot
+		// be distinguished from one containing commas.
+		values := f.Value.(pflag.SliceValue).GetSlice()
+		if len(values) > 1 {
+			return "", fmt.Errorf("failed to write --%s: several values of a string array cannot be set by one environment variable", f.Name)
+		}
+		return strings.Join(values, ""), nil
+	case "stringSlice":
+		// Values are parsed as CSV, so values containing commas are quoted.
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if err := w.Write(f.Value.(pflag.SliceValue).GetSlice()); err != nil {
+			return "", fmt.Errorf("failed to write --%s: %w", f.Name, err)
+		}
+		w.Flush()
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+	case "stringToString", "stringToInt", "stringToInt64":
+		// Maps are formatted in brackets that cannot be parsed.
+		return strings.TrimSuffix(strings.TrimPrefix(f.Value.String(), "["), "]"), nil
+	}
+
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		return strings.Join(sv.GetSlice(), ","), nil
+	}
+	return f.Value.String(), nil
+}
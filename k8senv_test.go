@@ -0,0 +1,103 @@
+package cobrautil_test
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/jzelinskie/cobrautil/v2"
+)
+
+func testKubernetesEnvFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.StringSlice("slice", nil, "")
+	flags.StringArray("array", nil, "")
+	return flags
+}
+
+func TestWriteKubernetesEnv(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		args        []string
+		flag        string
+		value       string
+		expectedErr string
+	}{
+		{
+			name:  "string slice",
+			args:  []string{"--slice=a,b", `--slice="c,d"`},
+			flag:  "slice",
+			value: `a,b,"c,d"`,
+		},
+		{
+			name:  "string array",
+			args:  []string{"--array=^(a|b){1,3}$"},
+			flag:  "array",
+			value: "^(a|b){1,3}$",
+		},
+		{
+			name:        "string array with several values",
+			args:        []string{"--array=a", "--array=b"},
+			expectedErr: "failed to write --array: several values of a string array cannot be set by one environment variable",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := testKubernetesEnvFlags()
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			err := cobrautil.WriteKubernetesEnv(&buf, "env", "test", "", flags, false)
+			if tt.expectedErr != "" {
+				if err == nil || err.Error() != tt.expectedErr {
+					t.Fatalf("expected error %q, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := "env:\n- name: TEST_" + strings.ToUpper(tt.flag) + "\n  value: " + strconv.Quote(tt.value) + "\n"
+			if buf.String() != expected {
+				t.Fatalf("expected %q, got %q", expected, buf.String())
+			}
+
+			// The value is parsed back like it is from the environment by
+			// cobraviper.SyncPreRunE.
+			parsed := testKubernetesEnvFlags()
+			if err := parsed.Set(tt.flag, tt.value); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := parsed.Lookup(tt.flag).Value.String(), flags.Lookup(tt.flag).Value.String(); got != want {
+				t.Fatalf("expected the value to be parsed as %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestPrintKubernetesEnvInheritedFlags(t *testing.T) {
+	root := &cobra.Command{Use: "root"}
+	root.PersistentFlags().String("log-level", "info", "")
+	serve := &cobra.Command{Use: "serve", Run: func(*cobra.Command, []string) {}}
+	serve.Flags().String("addr", ":8080", "")
+	root.AddCommand(serve)
+
+	cmd := cobrautil.NewPrintKubernetesEnvCommand("myservice", serve)
+	var buf bytes.Buffer
+	cmd.SetOut(&buf)
+	cmd.SetArgs([]string{"--log-level=debug", "--addr=:9000"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "env:\n- name: MYSERVICE_ADDR\n  value: \":9000\"\n- name: MYSERVICE_LOG_LEVEL\n  value: \"debug\"\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+}
@@ -0,0 +1,35 @@
+package cobrautil
+
+import (
+	"go/build"
+	"strings"
+	"testing"
+)
+
+// TestLiteImports ensures that building with the "cobrautil_lite" tag leaves
+// only the minimal surface of the root package, which must not depend on any
+// of the heavier libraries used by the subpackages.
+func TestLiteImports(t *testing.T) {
+	ctx := build.Default
+	ctx.BuildTags = append(ctx.BuildTags, "cobrautil_lite")
+
+	pkg, err := ctx.ImportDir(".", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	denied := []string{
+		"github.com/spf13/viper",
+		"github.com/rs/zerolog",
+		"go.opentelemetry.io/",
+		"google.golang.org/grpc",
+		"github.com/jzelinskie/cobrautil/v2/cobra",
+	}
+	for _, imp := range pkg.Imports {
+		for _, prefix := range denied {
+			if strings.HasPrefix(imp, prefix) {
+				t.Errorf("lite build imports %s", imp)
+			}
+		}
+	}
+}
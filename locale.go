@@ -0,0 +1,60 @@
+package cobrautil
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// RegisterLocaleFlags registers the flags used by LocalePreRunE.
+//
+// The following flags are added:
+// - "timezone"
+// - "lang"
+func RegisterLocaleFlags(flags *pflag.FlagSet) {
+	flags.String("timezone", "", `IANA time zone used as the process's local time zone (e.g. "UTC", "America/New_York"; system default if empty)`)
+	flags.String("lang", "", `locale exported as $LANG for the process (e.g. "en_US.UTF-8"; unchanged if empty)`)
+}
+
+// localeRegexp matches POSIX locale names of the form
+// language[_territory][.codeset][@modifier], as well as "C" and "POSIX".
+var localeRegexp = regexp.MustCompile(`^(C|POSIX|[a-zA-Z]{2,3}([_-][a-zA-Z0-9]{2,8})*)(\.[a-zA-Z0-9-]+)?(@[a-zA-Z0-9]+)?$`)
+
+// LocalePreRunE returns a CobraRunFunc that applies the time zone and locale
+// configured by the flags from RegisterLocaleFlags() to the whole process.
+//
+// The time zone replaces time.Local, so all times formatted in local time
+// honor the operator's configuration regardless of the configuration of the
+// host or container.
+func LocalePreRunE(l logr.Logger) CobraRunFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if IsBuiltinCommand(cmd) {
+			return nil // No-op for builtins
+		}
+
+		if tz := MustGetString(cmd, "timezone"); tz != "" {
+			loc, err := time.LoadLocation(tz)
+			if err != nil {
+				return fmt.Errorf("invalid --timezone %q: %w", tz, err)
+			}
+			time.Local = loc
+		}
+
+		if lang := MustGetString(cmd, "lang"); lang != "" {
+			if !localeRegexp.MatchString(lang) {
+				return fmt.Errorf("invalid --lang %q: must be a locale name such as \"en_US.UTF-8\"", lang)
+			}
+			if err := os.Setenv("LANG", lang); err != nil {
+				return fmt.Errorf("failed to set LANG: %w", err)
+			}
+		}
+
+		l.Info("configured locale", "timezone", time.Local.String(), "lang", os.Getenv("LANG"))
+		return nil
+	}
+}
@@ -2,16 +2,15 @@ package cobrautil
 
 import (
 	"net"
-	"os"
 	"time"
 
 	"github.com/spf13/cobra"
 )
 
 // MustGetStringExpanded returns the string value of a flag with the given name,
-// calls os.Expand on it, and panics if that flag was never defined.
+// calls ExpandEnv on it, and panics if that flag was never defined.
 func MustGetStringExpanded(cmd *cobra.Command, name string) string {
-	return os.ExpandEnv(MustGetString(cmd, name))
+	return ExpandEnv(MustGetString(cmd, name))
 }
 
 // MustGetBool returns the bool value of a flag with the given name and panics
@@ -254,6 +253,16 @@ func MustGetString(cmd *cobra.Command, name string) string {
 	return value
 }
 
+// MustGetStringArray returns the []string value of a flag with the given name
+// and panics if that flag was never defined.
+func MustGetStringArray(cmd *cobra.Command, name string) []string {
+	value, err := cmd.Flags().GetStringArray(name)
+	if err != nil {
+		panic("failed to find cobra flag: " + name)
+	}
+	return value
+}
+
 // MustGetStringSlice returns the []string value of a flag with the given name
 // and panics if that flag was never defined.
 func MustGetStringSlice(cmd *cobra.Command, name string) []string {
@@ -265,11 +274,11 @@ func MustGetStringSlice(cmd *cobra.Command, name string) []string {
 }
 
 // MustGetStringSlice returns the []string value of a flag with the given name,
-// calls os.ExpandEnv on values, and panics if that flag was never defined.
+// calls ExpandEnv on values, and panics if that flag was never defined.
 func MustGetStringSliceExpanded(cmd *cobra.Command, name string) []string {
 	slice := MustGetStringSlice(cmd, name)
 	for i, str := range slice {
-		slice[i] = os.ExpandEnv(str)
+		slice[i] = ExpandEnv(str)
 	}
 	return slice
 }
@@ -0,0 +1,298 @@
+package cobrautil
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"text/template"
+
+	"github.com/jzelinskie/stringz"
+	"github.com/spf13/cobra"
+)
+
+// ScaffoldBuilders is the list of builders that can be wired into a
+// generated main.go by WriteScaffold.
+var ScaffoldBuilders = []string{"log", "otel", "grpc", "http", "limits", "health"}
+
+// NewScaffoldCommand creates a command that generates a main.go for a new
+// service wiring together the builders provided by this module.
+//
+// The following flags are added:
+// - "name"
+// - "builders"
+// - "output"
+func NewScaffoldCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "scaffold",
+		Short: "generate a main.go wiring the cobrautil builders for a new service",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := MustGetString(cmd, "name")
+			builders := MustGetStringSlice(cmd, "builders")
+
+			output := MustGetStringExpanded(cmd, "output")
+			if output == "" || output == "-" {
+				return WriteScaffold(cmd.OutOrStdout(), name, builders...)
+			}
+
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create scaffold output: %w", err)
+			}
+			defer f.Close()
+
+			return WriteScaffold(f, name, builders...)
+		},
+	}
+
+	cmd.Flags().String("name", "myservice", "name of the program being generated")
+	cmd.Flags().StringSlice("builders", ScaffoldBuilders, `builders to wire into the program ("log", "otel", "grpc", "http", "limits", "health")`)
+	cmd.Flags().String("output", "-", `path to write the generated main.go ("-" for stdout)`)
+
+	if err := cmd.RegisterFlagCompletionFunc("builders", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return ScaffoldBuilders, cobra.ShellCompDirectiveDefault
+	}); err != nil {
+		panic("failed to register flag completion: " + err.Error())
+	}
+
+	return cmd
+}
+
+// WriteScaffold renders a gofmt'd main.go for a program with the provided
+// name that wires together the provided builders.
+//
+// The generated program registers each builder's flags into its own section
+// of a NamedFlagSets, synchronizes flags with environment variables, and
+// gracefully shuts down any servers within their "$PREFIX-shutdown-grace-period"
+// when it receives SIGINT or SIGTERM. The "health" builder enables the health
+// endpoints of the servers by default.
+func WriteScaffold(w io.Writer, programName string, builders ...string) error {
+	data := scaffoldData{Name: stringz.DefaultEmpty(programName, "myservice")}
+	for _, builder := range builders {
+		switch builder {
+		case "log":
+			data.Log = true
+		case "otel":
+			data.Otel = true
+		case "grpc":
+			data.GRPC = true
+		case "http":
+			data.HTTP = true
+		case "limits":
+			data.Limits = true
+		case "health":
+			data.Health = true
+		default:
+			return fmt.Errorf("unknown scaffold builder %q: must be one of %v", builder, ScaffoldBuilders)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := scaffoldTemplate.Execute(&buf, data); err != nil {
+		return fmt.Errorf("failed to render scaffold: %w", err)
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to format scaffold: %w", err)
+	}
+
+	_, err = w.Write(src)
+	return err
+}
+
+type scaffoldData struct {
+	Name   string
+	Log    bool
+	Otel   bool
+	GRPC   bool
+	HTTP   bool
+	Limits bool
+	Health bool
+}
+
+// BothServers returns true when the generated program serves gRPC and HTTP
+// concurrently.
+func (d scaffoldData) BothServers() bool { return d.GRPC && d.HTTP }
+
+var scaffoldTemplate = template.Must(template.New("main.go").Parse(`// Generated by cobrautil scaffold.
+
+package main
+
+import (
+	{{- if or (not .Otel) .BothServers}}
+	"context"
+	{{- end}}
+	{{- if .BothServers}}
+	"errors"
+	{{- end}}
+	{{- if not .Otel}}
+	"os"
+	"os/signal"
+	"syscall"
+	{{- end}}
+
+	"github.com/jzelinskie/cobrautil/v2"
+	{{- if .GRPC}}
+	"github.com/jzelinskie/cobrautil/v2/cobragrpc"
+	{{- end}}
+	{{- if .HTTP}}
+	"github.com/jzelinskie/cobrautil/v2/cobrahttp"
+	{{- end}}
+	{{- if .Otel}}
+	"github.com/jzelinskie/cobrautil/v2/cobraotel"
+	{{- end}}
+	{{- if .Limits}}
+	"github.com/jzelinskie/cobrautil/v2/cobraproclimits"
+	{{- end}}
+	"github.com/jzelinskie/cobrautil/v2/cobraviper"
+	{{- if .Log}}
+	"github.com/jzelinskie/cobrautil/v2/cobrazerolog"
+	{{- end}}
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	{{- if .Otel}}
+	// Servers are drained before the telemetry of their final requests is
+	// flushed, all within --flush-timeout, even if the command fails.
+	flusher := cobrautil.NewFlusher()
+	cobrautil.Main(rootCmd(flusher), flusher)
+	{{- else}}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if err := rootCmd().ExecuteContext(ctx); err != nil {
+		os.Exit(1)
+	}
+	{{- end}}
+}
+
+{{if .Otel -}}
+func rootCmd(flusher *cobrautil.Flusher) *cobra.Command {
+{{- else -}}
+func rootCmd() *cobra.Command {
+{{- end}}
+	{{- if .Log}}
+	zl := cobrazerolog.New()
+	{{- end}}
+	{{- if .Otel}}
+	otel := cobraotel.New("{{.Name}}", cobraotel.WithFlusher(flusher))
+	{{- end}}
+	{{- if .GRPC}}
+	// TODO: register gRPC services with cobragrpc.WithServiceRegistrar.
+	grpcb := cobragrpc.New("{{.Name}}",
+		cobragrpc.WithDefaultEnabled(true),
+		{{- if .Health}}
+		cobragrpc.WithDefaultHealthEnabled(true),
+		{{- end}}
+		{{- if .Otel}}
+		cobragrpc.WithFlusher(flusher),
+		{{- end}}
+	)
+	{{- end}}
+	{{- if .HTTP}}
+	// TODO: serve {{.Name}} with cobrahttp.WithHandler or cobrahttp.WithRoute.
+	httpb := cobrahttp.New("{{.Name}}",
+		cobrahttp.WithDefaultEnabled(true),
+		{{- if .Health}}
+		cobrahttp.WithDefaultHealthEnabled(true),
+		{{- end}}
+	)
+	{{- end}}
+
+	cmd := &cobra.Command{
+		Use:   "{{.Name}}",
+		Short: "{{.Name}} service",
+		PersistentPreRunE: cobrautil.CommandStack(
+			cobraviper.SyncPreRunE("{{.Name}}"),
+			{{- if .Log}}
+			zl.RunE(),
+			{{- end}}
+			{{- if .Otel}}
+			otel.RunE(),
+			{{- end}}
+			{{- if .Limits}}
+			cobraproclimits.SetMemLimitRunE(),
+			cobraproclimits.SetProcLimitRunE(),
+			{{- end}}
+		),
+		{{- if .BothServers}}
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return serve(cmd, grpcb, httpb)
+		},
+		{{- else if .GRPC}}
+		// Serves until the command's context is canceled.
+		RunE: grpcb.RunE(),
+		{{- else if .HTTP}}
+		// Serves until the command's context is canceled.
+		RunE: httpb.RunE(),
+		{{- else}}
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// TODO: implement {{.Name}}
+			return nil
+		},
+		{{- end}}
+	}
+	{{- if .Otel}}
+	cobrautil.RegisterFlushFlags(cmd.PersistentFlags())
+	{{- end}}
+
+	nfs := cobrautil.NewNamedFlagSets(cmd)
+	{{- if .Log}}
+	zl.RegisterNamedFlags(nfs)
+	{{- end}}
+	{{- if .Otel}}
+	otel.RegisterNamedFlags(nfs)
+	{{- end}}
+	{{- if .GRPC}}
+	grpcb.RegisterNamedFlags(nfs)
+	{{- end}}
+	{{- if .HTTP}}
+	httpb.RegisterNamedFlags(nfs)
+	{{- end}}
+	nfs.AddFlagSets(cmd)
+
+	versionCmd := &cobra.Command{
+		Use:   "version",
+		Short: "display the version of {{.Name}}",
+		RunE:  cobrautil.VersionRunFunc("{{.Name}}"),
+	}
+	cobrautil.RegisterVersionFlags(versionCmd.Flags())
+	cmd.AddCommand(versionCmd)
+
+	return cmd
+}
+{{- if .BothServers}}
+
+// serve runs the gRPC and HTTP servers until the command's context is
+// canceled or either of them fails, gracefully stopping both within the grace
+// periods configured by their flags.
+func serve(cmd *cobra.Command, grpcb *cobragrpc.Builder, httpb *cobrahttp.Builder) error {
+	grpcSrv, err := grpcb.ServerFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	httpSrv := httpb.ServerFromFlags(cmd)
+
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+	cmd.SetContext(ctx)
+
+	results := make(chan error, 2)
+	go func() { results <- grpcb.ListenFromFlags(cmd, grpcSrv) }()
+	go func() { results <- httpb.ListenFromFlags(cmd, httpSrv) }()
+
+	var errs []error
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			cancel() // Stop the other server.
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+{{- end}}
+`))
@@ -0,0 +1,67 @@
+package cobrautil
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// FlagScopeAnnotation is the key of the pflag annotation used to record the
+// FlagScope of a flag.
+const FlagScopeAnnotation = "cobrautil_flag_scope"
+
+// FlagScope describes whether the value of a flag is expected to be identical
+// across every instance of a program in a fleet.
+//
+// Tooling that compares the configuration of instances (e.g. to detect
+// configuration drift) should only compare flags that are cluster-wide.
+type FlagScope string
+
+const (
+	// FlagScopeCluster is the scope of flags that are expected to be identical
+	// across a fleet. Flags without a scope are considered cluster-wide.
+	FlagScopeCluster FlagScope = "cluster"
+
+	// FlagScopeInstance is the scope of flags that are expected to differ
+	// between instances, such as listen addresses.
+	FlagScopeInstance FlagScope = "instance"
+)
+
+// MarkFlagsInstanceLocal is a convenient way to mark flags as instance-local
+// in bulk.
+func MarkFlagsInstanceLocal(flags *pflag.FlagSet, names ...string) error {
+	return markFlagsScope(flags, FlagScopeInstance, names...)
+}
+
+// MarkFlagsClusterWide is a convenient way to mark flags as cluster-wide in
+// bulk.
+func MarkFlagsClusterWide(flags *pflag.FlagSet, names ...string) error {
+	return markFlagsScope(flags, FlagScopeCluster, names...)
+}
+
+func markFlagsScope(flags *pflag.FlagSet, scope FlagScope, names ...string) error {
+	for _, name := range names {
+		if err := flags.SetAnnotation(name, FlagScopeAnnotation, []string{string(scope)}); err != nil {
+			return fmt.Errorf("failed to mark flag as %s scoped: %w", scope, err)
+		}
+	}
+	return nil
+}
+
+// ScopeOf returns the FlagScope of the provided flag.
+func ScopeOf(f *pflag.Flag) FlagScope {
+	if values := f.Annotations[FlagScopeAnnotation]; len(values) > 0 {
+		return FlagScope(values[0])
+	}
+	return FlagScopeCluster
+}
+
+// VisitClusterWideFlags calls fn for each flag in the FlagSet that is not
+// instance-local, in lexicographical order.
+func VisitClusterWideFlags(flags *pflag.FlagSet, fn func(*pflag.Flag)) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		if ScopeOf(f) == FlagScopeCluster {
+			fn(f)
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package cobrautil
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// secretValue is a string flag value that is redacted whenever it is printed,
+// e.g. in help output or logs.
+type secretValue string
+
+func (s *secretValue) Set(value string) error {
+	*s = secretValue(value)
+	return nil
+}
+
+func (s *secretValue) Type() string { return "secret" }
+
+func (s *secretValue) String() string {
+	if *s == "" {
+		return ""
+	}
+	return "REDACTED"
+}
+
+// RegisterSecretFlag adds a flag for a sensitive string, such as a password
+// or token, that has no default and whose value is never printed.
+//
+// Values must be read with MustGetSecret. Secret flags are not expanded by
+// ExpandAll and are omitted by WriteKubernetesEnv, since they belong in a
+// Kubernetes Secret rather than a manifest.
+func RegisterSecretFlag(flags *pflag.FlagSet, name, usage string) {
+	flags.Var(new(secretValue), name, usage)
+}
+
+// IsSecretFlag returns true if the flag was added by RegisterSecretFlag.
+func IsSecretFlag(f *pflag.Flag) bool {
+	_, ok := f.Value.(*secretValue)
+	return ok
+}
+
+// MustGetSecret returns the value of a flag added by RegisterSecretFlag with
+// the given name and panics if that flag was never defined.
+func MustGetSecret(cmd *cobra.Command, name string) string {
+	f := cmd.Flags().Lookup(name)
+	if f == nil || !IsSecretFlag(f) {
+		panic("failed to find cobra flag: " + name)
+	}
+	return string(*f.Value.(*secretValue))
+}
@@ -0,0 +1,51 @@
+package cobrautil
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// requireTLSAnnotation is the key of the command annotation set by RequireTLS.
+const requireTLSAnnotation = "cobrautil_require_tls"
+
+// RegisterRequireTLSFlags registers the flag used by TLSRequired.
+//
+// The following flags are added:
+// - "require-tls"
+func RegisterRequireTLSFlags(flags *pflag.FlagSet) {
+	flags.Bool("require-tls", false, "refuse to serve or export telemetry without TLS")
+}
+
+// RequireTLS returns a CobraRunFunc that requires TLS for every builder
+// configured by the command, regardless of the "require-tls" flag.
+//
+// This allows organizations to enforce encryption-in-transit policy in their
+// builds. It must run before the RunFuncs of any builders.
+func RequireTLS() CobraRunFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if cmd.Annotations == nil {
+			cmd.Annotations = make(map[string]string)
+		}
+		cmd.Annotations[requireTLSAnnotation] = "true"
+		return nil
+	}
+}
+
+// TLSRequired returns true if the command requires servers and exporters to
+// use TLS, either because of the "require-tls" flag or because RequireTLS was
+// run for the command or one of its parents.
+//
+// When TLS is required, the builders in this module refuse to start plaintext
+// servers or to export telemetry insecurely.
+func TLSRequired(cmd *cobra.Command) bool {
+	if f := cmd.Flags().Lookup("require-tls"); f != nil && f.Value.String() == "true" {
+		return true
+	}
+
+	for c := cmd; c != nil; c = c.Parent() {
+		if c.Annotations[requireTLSAnnotation] == "true" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+//go:build !cobrautil_lite
+
+package cobrautil
+
+import (
+	"github.com/go-logr/logr"
+
+	"github.com/jzelinskie/cobrautil/v2/cobraviper"
+)
+
+// SyncViperPreRunE returns a CobraRunFunc that synchronizes Viper environment
+// flags with the provided prefix.
+//
+// This is omitted when building with the "cobrautil_lite" tag.
+//
+// Deprecated: Use cobraviper.SyncPreRunE.
+func SyncViperPreRunE(prefix string) CobraRunFunc {
+	return cobraviper.SyncPreRunE(prefix)
+}
+
+// SyncViperDotEnvPreRunE returns a CobraRunFunc that loads a .dotenv file
+// before synchronizing Viper environment flags with the provided prefix.
+//
+// This is omitted when building with the "cobrautil_lite" tag.
+//
+// Deprecated: Use cobraviper.SyncDotEnvPreRunE.
+func SyncViperDotEnvPreRunE(prefix, envfilePath string, l logr.Logger) CobraRunFunc {
+	return cobraviper.SyncDotEnvPreRunE(prefix, envfilePath, l)
+}